@@ -46,9 +46,222 @@
 //	-stderrthreshold=ERROR
 //		Log events at or above this severity are logged to standard
 //		error as well as to files.
+//	-filethreshold=INFO
+//		Log events at or above this severity are logged to files. No file
+//		is created for the severities below it.
+//	-log_immediate_flush_threshold=ERROR
+//		Log events at or above this severity are flushed to their files
+//		as they are written, rather than when the flush daemon runs.
 //	-log_dir=""
 //		Log files will be written to this directory instead of the
-//		default temporary directory.
+//		default temporary directory. The directory is created if it
+//		does not exist. SetLogDir changes it after startup.
+//	-log_dir_info="", -log_dir_warning="", -log_dir_error="", -log_dir_fatal=""
+//		Log files of the given severity will be written to this directory
+//		instead of -log_dir.
+//	-log_pid_file=false
+//		If true, the process ID is written to prog.pid, in the directory
+//		of the first log file, when that is created, replacing any file
+//		left there by an earlier run. Shutdown removes it.
+//	-log_single_file=false
+//		If true, the logs of all severities are written to one file,
+//		named as the INFO log, instead of to a file per severity.
+//	-log_info_shards=0
+//		If positive, InfoShard spreads its INFO lines across this many
+//		files, tagged INFO.0, INFO.1 and so on, by a hash of its key.
+//	-log_dir_strict=false
+//		If true, log files are only written to the directories named by
+//		-log_dir and -log_dir_<severity>, never to the temporary directory
+//		when those cannot be used. If no log file can be created, an error
+//		is reported and logs go to standard error only.
+//	-log_max_size=16MB
+//		A log file is rotated once it would grow beyond this size.
+//		The value may carry a KB, MB or GB suffix.
+//	-log_buffer_size=256KB
+//		The size of the buffer in which lines for each log file gather
+//		before they are written to it. A larger buffer makes fewer
+//		writes, at the cost of lines waiting longer to reach the file:
+//		until the buffer fills, the flush daemon runs, per
+//		-log_flush_interval, or a line at or above
+//		-log_immediate_flush_threshold is logged. The value may carry
+//		a KB, MB or GB suffix.
+//	-log_max_files=4
+//		At most this many log files are kept in the log directory;
+//		older files are deleted when a file is rotated. Zero disables
+//		deletion entirely. FATAL log files do not count, and are kept,
+//		unless -log_prune_fatal is set.
+//	-log_prune_fatal=false
+//		If true, -log_max_files applies to FATAL log files too.
+//	-log_audit_chain=false
+//		If true, each line of the AUDIT log, written by Audit, ends with
+//		a hash chained from that of the line before, so that editing or
+//		removing lines can be detected.
+//	-log_file_mode=0644
+//		Log files are created with these permission bits, in octal.
+//	-log_dir_mode=0755
+//		Log directories glog creates get these permission bits, in octal.
+//	-log_max_total_size=0
+//		If non-zero, the oldest log files in the log directory are
+//		deleted when a file is rotated, until the total size of those
+//		left is at most this, but the newest file is always kept. The
+//		value may carry a KB, MB or GB suffix.
+//	-log_append=false
+//		If true, a log file whose name is already taken, as when the
+//		program restarts within the same second, is appended to rather
+//		than left alone in favour of a new, disambiguated name. FATAL
+//		log files are never appended to.
+//	-log_file_pattern="{program}[{time:2006-01-02 15-04-05}].log"
+//		Log file names are built from this template, in which {program},
+//		{tag}, {host} and {pid} stand for the program name, severity,
+//		host name and process ID, and {time:layout} for the time the file
+//		was created, formatted as by time.Time.Format. {utctime:layout}
+//		formats that time in UTC, and {unixtime} gives it in seconds
+//		since 1970. Without {tag}, FATAL files are named with .FATAL
+//		after the program name, as in prog.FATAL[2023-01-02 03-04-05].log,
+//		so that they can be kept apart from the others.
+//	-log_name_style=bracket
+//		Sets -log_file_pattern to one of three styles of name: bracket,
+//		the default, as in prog[2023-01-02 03-04-05].log; unix, as in
+//		prog.1672628645.log; or rfc3339, as in
+//		prog.2023-01-02T03-04-05Z.log. The latter two have no spaces
+//		or brackets to trouble shells and globs.
+//	-log_rotate_interval=0
+//		If non-zero, a log file is also rotated once it has been open
+//		this long, for instance 24h, regardless of its size.
+//	-log_max_age=0
+//		If non-zero, log files last modified longer ago than this are
+//		deleted when a file is rotated, however many there are.
+//	-log_prune_dry_run=false
+//		If true, the log files that -log_max_files, -log_max_total_size
+//		and -log_max_age would delete are instead logged at WARNING, and
+//		kept, to try out a retention policy.
+//	-log_compress=false
+//		If true, rotated log files are compressed in the background
+//		with gzip, replacing name.log with name.log.gz.
+//	-log_reopen_on_sighup=false
+//		If true, the log files are closed and opened anew, as by
+//		ReopenFiles, when the process receives SIGHUP, as logrotate
+//		sends after renaming them. SIGHUP is not sent on Windows or
+//		Plan 9.
+//
+//	-log_timestamp_precision=us
+//		The time in log headers is given to this resolution: s, ms,
+//		us or ns.
+//	-log_utc=false
+//		If true, log headers and log file names carry UTC rather than
+//		local time.
+//	-log_timezone=""
+//		If set, log headers and log file names carry the time in this
+//		zone, named as in the IANA time zone database, such as
+//		America/New_York, or UTC or Local. It overrides -log_utc.
+//	-log_goroutine_id=false
+//		If true, log headers carry the ID of the logging goroutine, as
+//		g123, after the process ID. Finding it takes a little time.
+//	-log_seq=false
+//		If true, log headers carry a sequence number, as #42, after the
+//		process ID, and JSON lines have it as the "seq" field. Numbers
+//		count up from 1 in the order the lines' headers are written, with
+//		no gaps, so that lines that reach a sink out of order, through
+//		-log_async or -log_network, can be put back in order.
+//	-log_func_name=false
+//		If true, log headers carry the package-qualified name of the
+//		function that logged, after the file and line number, as in
+//		"file.go:12 example.com/pkg.(*T).Method]", and JSON lines have
+//		it as the "func" field. It is off by default, for speed.
+//	-log_label=""
+//		If set, this label follows the file and line number in log
+//		headers, and is the "label" field of JSON lines, to tell apart
+//		instances of a program. SetLabel changes it while running.
+//	-log_sample_rate=0
+//		If greater than one, only every Nth call to V at each call site
+//		logs, for levels above zero. Other lines are never sampled.
+//	-log_rate_limit=0
+//		If non-zero, at most this many lines per second are logged from
+//		any one source line. The first line logged from there in a later
+//		second is preceded by one reporting how many were dropped, or
+//		the report is written at the next flush, whichever is sooner.
+//		FATAL lines are never dropped.
+//	-log_burst_window=0
+//		If non-zero, of a burst of identical lines from one source line
+//		within this long, only the first is written at once. The last is
+//		written when the burst ends, with the next such line after the
+//		window, or on a flush, followed by a count of those between.
+//	-log_dedup_window=0
+//		If non-zero, a line with the same message as the last line of
+//		its severity, logged within this long of it, is dropped. How
+//		many were is reported in a "last message repeated N times" line
+//		before the next line of another message, or on a flush. FATAL
+//		lines are never dropped.
+//	-log_network_only=false
+//		If true, while SetNetworkOutput has a collector installed, log
+//		lines are sent only there rather than to log files as well.
+//	-log_flush_interval=30s
+//		Buffered log lines are flushed to the log files at least this
+//		often. FATAL lines, and Exit, flush and sync the files at once.
+//	-log_fatal_all_stacks=true
+//		If true, Fatal writes the stack traces of all goroutines to the
+//		log files; if false, only that of the goroutine that called it.
+//	-log_fatal_to_stderr=true
+//		If false, FATAL lines and the stack of the goroutine that logged
+//		them are not copied to standard error, but only written to the
+//		log files, unless -logtostderr is set.
+//	-log_fatal_stack_file=false
+//		If true, Fatal writes the stack traces it dumps to a file of their
+//		own, prog.FATAL.stack.<time>.txt, beside the FATAL log file, and
+//		only a line naming that file to the log files, so that they hold
+//		one line per message. If the file cannot be written, the traces go
+//		to the log files as usual.
+//	-log_fatal_timeout=10s
+//		The longest a Fatal or Exit may take to write its line and stack
+//		traces, flush the logs and run the exit hooks. A process that is
+//		still at it then exits anyway, with the same status. Zero or less
+//		waits for as long as it takes.
+//	-log_async=false
+//		If true, log lines are queued, and written by a separate
+//		goroutine, so that logging does not wait for the outputs.
+//		FATAL lines are always written at once, after the queued lines.
+//	-log_async_queue_size=1024
+//		The number of lines -log_async can queue. Lines that do not fit
+//		are dropped.
+//	-log_async_drop_oldest=false
+//		If true, a full -log_async queue drops its oldest line to make
+//		room for a new one, rather than dropping the new one.
+//	-log_drop_regex=""
+//		A comma-separated list of regular expressions. Lines whose
+//		message matches any of them are dropped, and counted in
+//		Stats.Dropped. FATAL lines are never dropped.
+//	-log_max_line_bytes=0
+//		If positive, log messages longer than this many bytes are cut
+//		short, and end with a mark of how many bytes were dropped.
+//		FATAL lines and stack traces are never cut.
+//	-log_format=text
+//		Log lines are written in the classic text format, or as one
+//		JSON object per line if set to json. If set to framed, each
+//		JSON object is preceded by its length as a 4-byte big-endian
+//		number instead of followed by a newline, so that messages may
+//		hold newlines; log files then have no banner, and a Fatal
+//		writes its stack traces as a record of their own.
+//	-log_color=auto
+//		When to color the severity letter of lines written to standard
+//		error, by severity: WARNING yellow, ERROR and FATAL red. auto
+//		colors them if standard error is a terminal; always and never
+//		override that. Log files are never colored.
+//	-log_file_path=short
+//		How the file of the logging call is named in log headers: short
+//		gives its base name, file.go; package adds its directory,
+//		pkg/file.go; and full gives its whole path, to tell apart files
+//		that share a base name.
+//	-log_header_template=""
+//		If set, the header of text log lines follows this template, as
+//		described at SetHeaderTemplate, such as
+//		"{time} {sev} {file}:{line}: {msg}", instead of the built-in one.
+//	-log_no_header=false
+//		If true, text log lines hold just the message, without the
+//		header of severity, time, pid and file:line, for outputs that
+//		add their own. It is ignored by -log_format=json.
+//	-log_json_build_info=false
+//		If true, JSON log lines include the version and commit of the
+//		program, as set by SetBuildInfo or embedded by the go command.
 //
 //	Other flags provide aids to debugging.
 //
@@ -59,6 +272,9 @@
 //		a stack trace will be written to the Info log whenever execution
 //		hits that statement. (Unlike with -vmodule, the ".go" must be
 //		present.)
+//	-log_error_stacks=false
+//		If true, every ERROR line is followed by the stack trace of the
+//		goroutine that logged it, from the logging call down.
 //	-v=0
 //		Enable V-leveled logging at the specified level.
 //	-vmodule=""
@@ -72,6 +288,8 @@ package glog
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -81,6 +299,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -104,24 +323,33 @@ type GLogFileEntry struct {
 	Message    string `json:"Message"`
 }
 
-// severity identifies the sort of log: info, warning etc. It also implements
-// the flag.Value interface. The -stderrthreshold flag is of type severity and
+// Severity identifies the sort of log: info, warning etc. It also implements
+// the flag.Value interface. The -stderrthreshold flag is of type Severity and
 // should be modified only through the flag.Value interface. The values match
 // the corresponding constants in C++.
-type severity int32 // sync/atomic int32
+type Severity int32 // sync/atomic int32
 
 // These constants identify the log levels in order of increasing severity.
 // A message written to a high-severity log file is also written to each
 // lower-severity log file.
 const (
-	infoLog severity = iota
+	infoLog Severity = iota
 	warningLog
 	errorLog
 	fatalLog
 	numSeverity = 4
 )
 
-const severityChar = "IWEF"
+// These are the exported names of the log levels, for use with functions
+// such as SetOutputBySeverity.
+const (
+	InfoLevel    = infoLog
+	WarningLevel = warningLog
+	ErrorLevel   = errorLog
+	FatalLevel   = fatalLog
+)
+
+var severityChar = []byte("IWEF")
 
 var severityName = []string{
 	infoLog:    "INFO",
@@ -131,47 +359,60 @@ var severityName = []string{
 }
 
 // get returns the value of the severity.
-func (s *severity) get() severity {
-	return severity(atomic.LoadInt32((*int32)(s)))
+func (s *Severity) get() Severity {
+	return Severity(atomic.LoadInt32((*int32)(s)))
 }
 
 // set sets the value of the severity.
-func (s *severity) set(val severity) {
+func (s *Severity) set(val Severity) {
 	atomic.StoreInt32((*int32)(s), int32(val))
 }
 
-// String is part of the flag.Value interface.
-func (s *severity) String() string {
-	return strconv.FormatInt(int64(*s), 10)
+// String returns the name of the severity, such as "INFO", or its number if
+// it is not a known level. It is also part of the flag.Value interface.
+func (s Severity) String() string {
+	if s.valid() {
+		return severityName[s]
+	}
+	return strconv.FormatInt(int64(s), 10)
 }
 
 // Get is part of the flag.Value interface.
-func (s *severity) Get() interface{} {
+func (s *Severity) Get() interface{} {
 	return *s
 }
 
 // Set is part of the flag.Value interface.
-func (s *severity) Set(value string) error {
-	var threshold severity
+func (s *Severity) Set(value string) error {
+	var threshold Severity
 	// Is it a known name?
-	if v, ok := severityByName(value); ok {
+	if v, err := ParseSeverity(value); err == nil {
 		threshold = v
 	} else {
 		v, err := strconv.Atoi(value)
 		if err != nil {
 			return err
 		}
-		threshold = severity(v)
+		threshold = Severity(v)
 	}
-	logging.stderrThreshold.set(threshold)
+	s.set(threshold)
 	return nil
 }
 
-func severityByName(s string) (severity, bool) {
+// ParseSeverity returns the severity with the given name, which is one of
+// "INFO", "WARNING", "ERROR" and "FATAL" in any case.
+func ParseSeverity(s string) (Severity, error) {
+	if v, ok := severityByName(s); ok {
+		return v, nil
+	}
+	return 0, fmt.Errorf("unknown severity %q: expect one of %s", s, strings.Join(severityName, ", "))
+}
+
+func severityByName(s string) (Severity, bool) {
 	s = strings.ToUpper(s)
 	for i, name := range severityName {
 		if name == s {
-			return severity(i), true
+			return Severity(i), true
 		}
 	}
 	return 0, false
@@ -194,15 +435,25 @@ func (s *OutputStats) Bytes() int64 {
 }
 
 // Stats tracks the number of lines of output and number of bytes
-// per severity level. Values must be read with atomic.LoadInt64.
+// per severity level, and of the lines dropped by -log_drop_regex.
+// Values must be read with atomic.LoadInt64.
 var Stats struct {
-	Info, Warning, Error OutputStats
+	Info, Warning, Error, Fatal OutputStats
+	Dropped                     OutputStats
 }
 
-var severityStats = [numSeverity]*OutputStats{
+var severityStats = [maxSeverity]*OutputStats{
 	infoLog:    &Stats.Info,
 	warningLog: &Stats.Warning,
 	errorLog:   &Stats.Error,
+	fatalLog:   &Stats.Fatal,
+}
+
+// LineCounts returns the number of lines written so far at each severity,
+// as a convenience for exporting them to a metrics system such as Prometheus.
+// Lines suppressed by V levels are not counted.
+func LineCounts() (infos, warnings, errors, fatals uint64) {
+	return uint64(Stats.Info.Lines()), uint64(Stats.Warning.Lines()), uint64(Stats.Error.Lines()), uint64(Stats.Fatal.Lines())
 }
 
 // Level is exported because it appears in the arguments to V and is
@@ -251,6 +502,19 @@ func (l *Level) Set(value string) error {
 	return nil
 }
 
+// SetVerbosity sets the V logging level, as the -v flag does. It is safe to
+// call at any time; subsequent calls to V in all goroutines observe the new level.
+func SetVerbosity(level int) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.setVState(Level(level), logging.vmodule.filter, false)
+}
+
+// VerbosityLevel returns the current V logging level.
+func VerbosityLevel() int {
+	return int(logging.verbosity.get())
+}
+
 // moduleSpec represents the setting of the -vmodule flag.
 type moduleSpec struct {
 	filter []modulePat
@@ -328,6 +592,14 @@ func (m *moduleSpec) Set(value string) error {
 	return nil
 }
 
+// SetVModule sets the per-file V logging levels, as the -vmodule flag does,
+// using the same comma-separated pattern=N syntax. The V level cached for each
+// call site is discarded. If pattern is malformed, an error is returned and the
+// current setting is left unchanged.
+func SetVModule(pattern string) error {
+	return logging.vmodule.Set(pattern)
+}
+
 // isLiteral reports whether the pattern is a literal string, that is, has no metacharacters
 // that require filepath.Match to be called to match the pattern.
 func isLiteral(pattern string) bool {
@@ -404,6 +676,220 @@ func (t *traceLocation) Set(value string) error {
 	return nil
 }
 
+// logFormat selects how log lines are rendered. It implements the flag.Value
+// interface; the -log_format flag is of type logFormat.
+type logFormat int32 // sync/atomic int32
+
+const (
+	textFormat   logFormat = iota // The classic Lmmdd hh:mm:ss.uuuuuu header.
+	jsonFormat                    // One JSON object per line.
+	framedFormat                  // JSON objects, each after its 4-byte big-endian length.
+)
+
+var logFormatName = []string{
+	textFormat:   "text",
+	jsonFormat:   "json",
+	framedFormat: "framed",
+}
+
+// get returns the value of the logFormat.
+func (f *logFormat) get() logFormat {
+	return logFormat(atomic.LoadInt32((*int32)(f)))
+}
+
+// set sets the value of the logFormat.
+func (f *logFormat) set(val logFormat) {
+	atomic.StoreInt32((*int32)(f), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (f *logFormat) String() string {
+	return logFormatName[f.get()]
+}
+
+// Get is part of the flag.Getter interface.
+func (f *logFormat) Get() interface{} {
+	return f.get()
+}
+
+// Syntax: -log_format=text, -log_format=json or -log_format=framed
+func (f *logFormat) Set(value string) error {
+	for i, name := range logFormatName {
+		if strings.EqualFold(name, value) {
+			f.set(logFormat(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown log format %q: expect one of %s", value, strings.Join(logFormatName, ", "))
+}
+
+// colorMode selects when lines written to standard error are colored. It
+// implements the flag.Value interface; the -log_color flag is of type
+// colorMode.
+type colorMode int32 // sync/atomic int32
+
+const (
+	colorAuto   colorMode = iota // Color if standard error is a terminal.
+	colorAlways                  // Always color.
+	colorNever                   // Never color.
+)
+
+var colorModeName = []string{
+	colorAuto:   "auto",
+	colorAlways: "always",
+	colorNever:  "never",
+}
+
+// get returns the value of the colorMode.
+func (m *colorMode) get() colorMode {
+	return colorMode(atomic.LoadInt32((*int32)(m)))
+}
+
+// set sets the value of the colorMode.
+func (m *colorMode) set(val colorMode) {
+	atomic.StoreInt32((*int32)(m), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (m *colorMode) String() string {
+	return colorModeName[m.get()]
+}
+
+// Get is part of the flag.Getter interface.
+func (m *colorMode) Get() interface{} {
+	return m.get()
+}
+
+// Syntax: -log_color=auto, -log_color=always or -log_color=never
+func (m *colorMode) Set(value string) error {
+	for i, name := range colorModeName {
+		if strings.EqualFold(name, value) {
+			m.set(colorMode(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown color mode %q: expect one of %s", value, strings.Join(colorModeName, ", "))
+}
+
+// filePathMode selects how much of the path of the logging call's file is
+// written in log headers. It implements the flag.Value interface; the
+// -log_file_path flag is of type filePathMode.
+type filePathMode int32 // sync/atomic int32
+
+const (
+	shortPath   filePathMode = iota // The base name, file.go.
+	packagePath                     // The directory and base name, pkg/file.go.
+	fullPath                        // The whole path.
+)
+
+var filePathModeName = []string{
+	shortPath:   "short",
+	packagePath: "package",
+	fullPath:    "full",
+}
+
+// get returns the value of the filePathMode.
+func (m *filePathMode) get() filePathMode {
+	return filePathMode(atomic.LoadInt32((*int32)(m)))
+}
+
+// set sets the value of the filePathMode.
+func (m *filePathMode) set(val filePathMode) {
+	atomic.StoreInt32((*int32)(m), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (m *filePathMode) String() string {
+	return filePathModeName[m.get()]
+}
+
+// Get is part of the flag.Getter interface.
+func (m *filePathMode) Get() interface{} {
+	return m.get()
+}
+
+// Syntax: -log_file_path=short, -log_file_path=package or -log_file_path=full
+func (m *filePathMode) Set(value string) error {
+	for i, name := range filePathModeName {
+		if strings.EqualFold(name, value) {
+			m.set(filePathMode(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown file path mode %q: expect one of %s", value, strings.Join(filePathModeName, ", "))
+}
+
+// trim returns as much of the path of a caller's file as m calls for.
+func (m filePathMode) trim(path string) string {
+	if m == fullPath {
+		return path
+	}
+	slash := strings.LastIndex(path, "/")
+	if slash >= 0 && m == packagePath {
+		slash = strings.LastIndex(path[:slash], "/")
+	}
+	return path[slash+1:]
+}
+
+// timestampPrecision selects the resolution of the time in log headers. It
+// implements the flag.Value interface; the -log_timestamp_precision flag is
+// of type timestampPrecision.
+type timestampPrecision int32 // sync/atomic int32
+
+const (
+	secondPrecision      timestampPrecision = iota // hh:mm:ss
+	millisecondPrecision                           // hh:mm:ss.mmm
+	microsecondPrecision                           // hh:mm:ss.uuuuuu
+	nanosecondPrecision                            // hh:mm:ss.nnnnnnnnn
+)
+
+var timestampPrecisionName = []string{
+	secondPrecision:      "s",
+	millisecondPrecision: "ms",
+	microsecondPrecision: "us",
+	nanosecondPrecision:  "ns",
+}
+
+// timestampPrecisionDigits holds the number of fractional digits of the
+// seconds written for each timestampPrecision.
+var timestampPrecisionDigits = []int{
+	secondPrecision:      0,
+	millisecondPrecision: 3,
+	microsecondPrecision: 6,
+	nanosecondPrecision:  9,
+}
+
+// get returns the value of the timestampPrecision.
+func (p *timestampPrecision) get() timestampPrecision {
+	return timestampPrecision(atomic.LoadInt32((*int32)(p)))
+}
+
+// set sets the value of the timestampPrecision.
+func (p *timestampPrecision) set(val timestampPrecision) {
+	atomic.StoreInt32((*int32)(p), int32(val))
+}
+
+// String is part of the flag.Value interface.
+func (p *timestampPrecision) String() string {
+	return timestampPrecisionName[p.get()]
+}
+
+// Get is part of the flag.Getter interface.
+func (p *timestampPrecision) Get() interface{} {
+	return p.get()
+}
+
+// Syntax: -log_timestamp_precision=ms
+func (p *timestampPrecision) Set(value string) error {
+	for i, name := range timestampPrecisionName {
+		if strings.EqualFold(name, value) {
+			p.set(timestampPrecision(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown timestamp precision %q: expect one of %s", value, strings.Join(timestampPrecisionName, ", "))
+}
+
 // flushSyncWriter is the interface satisfied by logging destinations.
 type flushSyncWriter interface {
 	Flush() error
@@ -416,19 +902,141 @@ func init() {
 	flag.BoolVar(&logging.alsoToStderr, "alsologtostderr", false, "log to standard error as well as files")
 	flag.Var(&logging.verbosity, "v", "log level for V logs")
 	flag.Var(&logging.stderrThreshold, "stderrthreshold", "logs at or above this threshold go to stderr")
+	flag.Var(&logging.fileThreshold, "filethreshold", "logs at or above this threshold go to files")
+	flag.Var(&logging.flushThreshold, "log_immediate_flush_threshold", "logs at or above this threshold are flushed to files as they are written")
+	flag.Var(&flushInterval, "log_flush_interval", "interval between periodic flushes of the log file buffers")
 	flag.Var(&logging.vmodule, "vmodule", "comma-separated list of pattern=N settings for file-filtered logging")
 	flag.Var(&logging.traceLocation, "log_backtrace_at", "when logging hits line file:N, emit a stack trace")
+	flag.Var(&logging.format, "log_format", "format of log lines: text, json or framed")
+	flag.Var(&logging.color, "log_color", "when to color the severity of lines on stderr: auto, always or never")
+	flag.Var(&logging.filePath, "log_file_path", "how the file is named in log headers: short, package or full")
+	flag.Var(&logging.precision, "log_timestamp_precision", "resolution of the time in log headers: s, ms, us or ns")
+	flag.BoolVar(&logging.utc, "log_utc", false, "use UTC rather than local time in log headers and file names")
+	flag.Var(&logging.zone, "log_timezone", "time zone of log headers and file names: an IANA name such as America/New_York, UTC or Local; overrides -log_utc")
+	flag.BoolVar(&logging.goroutineID, "log_goroutine_id", false, "include the ID of the logging goroutine in log headers")
+	flag.BoolVar(&logging.seq, "log_seq", false, "include a sequence number, increasing by one each line, in log headers")
+	flag.BoolVar(&logging.funcName, "log_func_name", false, "include the name of the logging function in log headers")
+	flag.BoolVar(&logging.noHeader, "log_no_header", false, "write text log lines without a header")
 
 	// Default stderrThreshold is ERROR.
 	logging.stderrThreshold = errorLog
+	// Default flushThreshold is ERROR.
+	logging.flushThreshold = errorLog
+	// Default precision is microseconds, as in C++.
+	logging.precision = microsecondPrecision
 
 	logging.setVState(0, nil, false)
-	go logging.flushDaemon()
+	logging.startFlushDaemon()
 }
 
-// Flush flushes all pending log I/O.
+// Flush flushes all pending log I/O, including the lines queued by -log_async.
+// It waits however long that takes; FlushTimeout gives up.
 func Flush() {
-	logging.lockAndFlushAll()
+	FlushTimeout(0)
+}
+
+// FlushTimeout is like Flush, but returns context.DeadlineExceeded if the
+// flush has not completed within timeout, as when a file or writer blocks,
+// so that a program shutting down need not hang on it. The flush goes on in
+// the background, and logging waits for it meanwhile. A timeout of zero or
+// less waits for as long as Flush does.
+func FlushTimeout(timeout time.Duration) error {
+	if timeout <= 0 {
+		drainAsync()
+		logging.lockAndFlushAll()
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		Flush()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return context.DeadlineExceeded
+	}
+}
+
+// writerSink adapts an io.Writer installed by SetOutput to flushSyncWriter.
+// It flushes and syncs the writer if it knows how.
+type writerSink struct {
+	io.Writer
+}
+
+func (w writerSink) Flush() error {
+	if f, ok := w.Writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (w writerSink) Sync() error {
+	if f, ok := w.Writer.(interface{ Sync() error }); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+// SetOutput directs the logs of every severity to w instead of to files,
+// as SetOutputBySeverity does for a single severity.
+func SetOutput(w io.Writer) {
+	for s := numSeverities() - 1; s >= infoLog; s-- {
+		SetOutputBySeverity(s, w)
+	}
+}
+
+// SetOutputBySeverity directs the log of severity sev to w instead of to a
+// file. No log file is created or rotated for sev while w is installed;
+// the -logtostderr and -stderrthreshold flags still apply as they do to files.
+// Any log file already open for sev is flushed and closed. Calling it with a
+// nil w restores logging to a file, which is created when next needed.
+func SetOutputBySeverity(sev Severity, w io.Writer) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if sb, ok := logging.file[sev].(*syncBuffer); ok {
+		sb.Flush()
+		if !logging.sharesFile(sev) {
+			sb.file.Close()
+		}
+	}
+	if w == nil {
+		logging.file[sev] = nil
+		return
+	}
+	logging.file[sev] = writerSink{w}
+}
+
+// AddTeeWriter has each line logged at sev also written to w, in addition
+// to wherever it goes already: the log file, standard error, or a writer
+// installed by SetOutput. Each call adds another writer; they are written in
+// the order they were added, after the file. An error writing to w is
+// reported on standard error and otherwise ignored.
+func AddTeeWriter(sev Severity, w io.Writer) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.tees[sev] = append(logging.tees[sev], &teeWriter{w: w})
+}
+
+// teeWriter is a writer added by AddTeeWriter.
+type teeWriter struct {
+	w      io.Writer
+	failed bool // Whether the last write failed, so the next failure goes unreported.
+}
+
+// writeTees writes the formatted line data of severity s to its tee writers.
+// l.mu is held.
+func (l *loggingT) writeTees(s Severity, data []byte) {
+	for _, t := range l.tees[s] {
+		_, err := t.w.Write(data)
+		if err != nil && !t.failed {
+			fmt.Fprintf(os.Stderr, "log: cannot write %s log to tee writer: %v\n", severityName[s], err)
+		}
+		t.failed = err != nil
+	}
 }
 
 // loggingT collects all the global state of the logging setup.
@@ -436,24 +1044,36 @@ type loggingT struct {
 	// Boolean flags. Not handled atomically because the flag.Value interface
 	// does not let us avoid the =true, and that shorthand is necessary for
 	// compatibility. TODO: does this matter enough to fix? Seems unlikely.
-	toStderr     bool // The -logtostderr flag.
-	alsoToStderr bool // The -alsologtostderr flag.
+	toStderr     bool     // The -logtostderr flag.
+	alsoToStderr bool     // The -alsologtostderr flag.
+	utc          bool     // The -log_utc flag.
+	zone         timeZone // The -log_timezone flag.
+	goroutineID  bool     // The -log_goroutine_id flag.
+	seq          bool     // The -log_seq flag.
+	funcName     bool     // The -log_func_name flag.
+	noHeader     bool     // The -log_no_header flag.
 
 	// Level flag. Handled atomically.
-	stderrThreshold severity // The -stderrthreshold flag.
+	stderrThreshold Severity // The -stderrthreshold flag.
+	fileThreshold   Severity // The -filethreshold flag.
+	flushThreshold  Severity // The -log_immediate_flush_threshold flag.
+
+	// Format flags. Handled atomically.
+	format    logFormat          // The -log_format flag.
+	color     colorMode          // The -log_color flag.
+	filePath  filePathMode       // The -log_file_path flag.
+	precision timestampPrecision // The -log_timestamp_precision flag.
 
-	// freeList is a list of byte buffers, maintained under freeListMu.
-	freeList *buffer
-	// freeListMu maintains the free list. It is separate from the main mutex
-	// so buffers can be grabbed and printed to without holding the main lock,
-	// for better parallelization.
-	freeListMu sync.Mutex
+	// bufferPool holds byte buffers for reuse. It is separate from the main
+	// mutex so buffers can be grabbed and printed to without holding the
+	// main lock, for better parallelization.
+	bufferPool sync.Pool
 
 	// mu protects the remaining elements of this structure and is
 	// used to synchronize logging.
 	mu sync.Mutex
 	// file holds writer for each of the log types.
-	file [numSeverity]flushSyncWriter
+	file [maxSeverity]flushSyncWriter
 	// pcs is used in V to avoid an allocation when computing the caller's PC.
 	pcs [1]uintptr
 	// vmap is a cache of the V Level for each V() call site, identified by PC.
@@ -469,13 +1089,55 @@ type loggingT struct {
 	// safely using atomic.LoadInt32.
 	vmodule   moduleSpec // The state of the -vmodule flag.
 	verbosity Level      // V logging level, the value of the -v flag/
+	// hooks are the callbacks registered by AddHook, in registration order.
+	hooks []logHook
+	// tees are the writers added by AddTeeWriter for each severity.
+	tees [maxSeverity][]*teeWriter
+	// rotateHooks are the callbacks registered by OnRotate.
+	rotateHooks []func(RotateEvent)
+	// ring holds the recent lines kept by EnableRingBuffer, if any.
+	ring *ringBuffer
+	// pruneReports are the log files spared by -log_prune_dry_run that are
+	// yet to be logged, and reportingPrunes is set while they are.
+	pruneReports    []string
+	reportingPrunes bool
+	// net is the collector installed by SetNetworkOutput, if any.
+	net *netSink
+	// ttyFile is the standard error that tty was last found for, so that
+	// -log_color=auto checks again only when os.Stderr is replaced.
+	ttyFile *os.File
+	tty     bool
+	// writingRaw is set while the bytes of a RawWriter are written, which
+	// are never colored.
+	writingRaw bool
+	// flushStop stops the running flushDaemon when closed. It is nil after
+	// Shutdown, until a log file is next created.
+	flushStop chan struct{}
 }
 
 // buffer holds a byte Buffer for reuse. The zero value is ready for use.
 type buffer struct {
 	bytes.Buffer
-	tmp  [64]byte // temporary byte array for creating headers.
-	next *buffer
+	tmp [64]byte // temporary byte array for creating headers.
+
+	// In -log_format=json mode the header can only be written once the
+	// message is known, so formatHeader records its fields here instead
+	// and output renders the whole line with formatJSON.
+	json      bool
+	sev       Severity
+	now       time.Time
+	file      string
+	line      int
+	goroutine uint64        // The goroutine ID, with -log_goroutine_id, or 0.
+	seq       uint64        // The sequence number, with -log_seq, or 0.
+	label     string        // The -log_label, if any.
+	fn        string        // The calling function, with -log_func_name, or "".
+	kv        []interface{} // Key/value pairs to render as JSON fields.
+
+	msg int // The offset of the message, after the header written by formatHeader.
+
+	raw   bool // The bytes of a RawWriter, to be written as they are.
+	audit bool // An Audit line, whose severity in the header or JSON is AUDIT.
 }
 
 var logging loggingT
@@ -502,34 +1164,124 @@ func (l *loggingT) setVState(verbosity Level, filter []modulePat, setFilter bool
 
 // getBuffer returns a new, ready-to-use buffer.
 func (l *loggingT) getBuffer() *buffer {
-	l.freeListMu.Lock()
-	b := l.freeList
-	if b != nil {
-		l.freeList = b.next
-	}
-	l.freeListMu.Unlock()
+	b, _ := l.bufferPool.Get().(*buffer)
 	if b == nil {
-		b = new(buffer)
-	} else {
-		b.next = nil
-		b.Reset()
+		return new(buffer)
 	}
+	b.json = false
+	b.raw = false
+	b.audit = false
+	b.kv = nil
+	b.msg = 0
+	b.Reset()
 	return b
 }
 
-// putBuffer returns a buffer to the free list.
+// putBuffer returns a buffer to the pool. The buffer must not be used
+// afterwards; the hooks and outputs that saw its bytes have copied what they
+// keep.
 func (l *loggingT) putBuffer(b *buffer) {
 	if b.Len() >= 256 {
 		// Let big buffers die a natural death.
 		return
 	}
-	l.freeListMu.Lock()
-	b.next = l.freeList
-	l.freeList = b
-	l.freeListMu.Unlock()
+	b.kv = nil // Do not keep the values alive.
+	l.bufferPool.Put(b)
+}
+
+// clock is a source of the current time. Everything that depends on it, from
+// the times in log headers and file names to rotation by -log_rotate_interval
+// and pruning by -log_max_age, reads it through timeNow, so that tests can
+// substitute a clock they control.
+type clock interface {
+	now() time.Time
+}
+
+// wallClock is the clock of the system, normally in use.
+type wallClock struct{}
+
+func (wallClock) now() time.Time { return time.Now() }
+
+var timeNow = wallClock{}.now // Stubbed out for testing.
+
+// setClockForTesting makes c the clock, and returns a function that restores
+// the previous one.
+func setClockForTesting(c clock) (restore func()) {
+	previous := timeNow
+	timeNow = c.now
+	return func() { timeNow = previous }
+}
+
+// logTime returns t in the zone used for log headers and file names: that
+// of -log_timezone if it is set, UTC if -log_utc is, and otherwise t's own
+// zone, normally local time.
+func (l *loggingT) logTime(t time.Time) time.Time {
+	if loc := l.zone.get(); loc != nil {
+		return t.In(loc)
+	}
+	if l.utc {
+		return t.UTC()
+	}
+	return t
+}
+
+// logLocation returns the zone of the times given by logTime, for reading
+// them back.
+func (l *loggingT) logLocation() *time.Location {
+	if loc := l.zone.get(); loc != nil {
+		return loc
+	}
+	if l.utc {
+		return time.UTC
+	}
+	return time.Local
+}
+
+// timeZone is the zone of the times in log headers and file names. It
+// implements the flag.Value interface; the -log_timezone flag is of type
+// timeZone. It is replaced atomically, so that it can be set while logging.
+type timeZone struct {
+	v atomic.Value // *time.Location
 }
 
-var timeNow = time.Now // Stubbed out for testing.
+// get returns the zone, or nil if none is set.
+func (z *timeZone) get() *time.Location {
+	loc, _ := z.v.Load().(*time.Location)
+	return loc
+}
+
+// String is part of the flag.Value interface.
+func (z *timeZone) String() string {
+	if loc := z.get(); loc != nil {
+		return loc.String()
+	}
+	return ""
+}
+
+// Get is part of the flag.Getter interface.
+func (z *timeZone) Get() interface{} {
+	return z.get()
+}
+
+// Syntax: -log_timezone=America/New_York, -log_timezone=UTC or
+// -log_timezone=Local; an empty value unsets it.
+func (z *timeZone) Set(value string) error {
+	var loc *time.Location
+	switch {
+	case value == "":
+	case strings.EqualFold(value, "local"):
+		loc = time.Local
+	case strings.EqualFold(value, "utc"):
+		loc = time.UTC
+	default:
+		var err error
+		if loc, err = time.LoadLocation(value); err != nil {
+			return err
+		}
+	}
+	z.v.Store(loc)
+	return nil
+}
 
 /*
 header formats a log header as defined by the C++ implementation.
@@ -550,38 +1302,47 @@ where the fields are defined as follows:
 	file             The file name
 	line             The line number
 	msg              The user-supplied message
+
+The function, with -log_func_name, and the -log_label, if set, follow the
+line number, as in "file:line pkg.func label]".
 */
-func (l *loggingT) header(s severity, depth int) (*buffer, string, int) {
-	_, file, line, ok := runtime.Caller(3 + depth)
+func (l *loggingT) header(s Severity, depth int) (*buffer, string, int) {
+	return l.headerFor(s, false, depth+1)
+}
+
+// headerFor is header for a line of severity s, or for an Audit line if
+// audit is set, whose severity letter is that of AUDIT.
+func (l *loggingT) headerFor(s Severity, audit bool, depth int) (*buffer, string, int) {
+	pc, file, line, ok := runtime.Caller(3 + depth)
+	var fn string
 	if !ok {
 		file = "???"
 		line = 1
 	} else {
-		slash := strings.LastIndex(file, "/")
-		if slash >= 0 {
-			file = file[slash+1:]
+		file = l.filePath.get().trim(file)
+		if l.funcName {
+			if f := runtime.FuncForPC(pc); f != nil {
+				fn = f.Name()
+			}
 		}
 	}
-	return l.formatHeader(s, file, line), file, line
+	return l.formatHeaderFunc(s, audit, file, line, fn), file, line
 }
 
-func (l *loggingT) createEntry(s severity, depth int, entry GLogEntry) (*buffer, string, int) {
+func (l *loggingT) createEntry(s Severity, depth int, entry GLogEntry) (*buffer, string, int) {
 	_, file, line, ok := runtime.Caller(3 + depth)
 	if !ok {
 		file = "???"
 		line = 1
 	} else {
-		slash := strings.LastIndex(file, "/")
-		if slash >= 0 {
-			file = file[slash+1:]
-		}
+		file = l.filePath.get().trim(file)
 	}
 
-	now := timeNow()
+	now := l.logTime(timeNow())
 	if line < 0 {
 		line = 0 // not a real line number, but acceptable to someDigits
 	}
-	if s > fatalLog {
+	if !s.valid() {
 		s = infoLog // for safety.
 	}
 	buf := l.getBuffer()
@@ -612,50 +1373,287 @@ func (l *loggingT) createEntry(s severity, depth int, entry GLogEntry) (*buffer,
 }
 
 // formatHeader formats a log header using the provided file name and line number.
-func (l *loggingT) formatHeader(s severity, file string, line int) *buffer {
-	now := timeNow()
+func (l *loggingT) formatHeader(s Severity, file string, line int) *buffer {
+	return l.formatHeaderFunc(s, false, file, line, "")
+}
+
+// formatHeaderFunc is formatHeader with the name of the calling function,
+// fn, for -log_func_name; it is left out if empty. If audit is set, the
+// header is that of an Audit line.
+func (l *loggingT) formatHeaderFunc(s Severity, audit bool, file string, line int, fn string) *buffer {
+	now := l.logTime(timeNow())
 	if line < 0 {
 		line = 0 // not a real line number, but acceptable to someDigits
 	}
-	if s > fatalLog {
+	if !s.valid() {
 		s = infoLog // for safety.
 	}
 	buf := l.getBuffer()
+	buf.audit = audit
+	if f := l.format.get(); f == jsonFormat || f == framedFormat {
+		buf.json = true
+		buf.sev, buf.now, buf.file, buf.line = s, now, file, line
+		buf.goroutine, buf.seq = 0, 0
+		if l.seq {
+			buf.seq = nextSeq()
+		}
+		if l.goroutineID {
+			buf.goroutine = buf.goroutineID()
+		}
+		buf.label = logLabel.get()
+		buf.fn = fn
+		return buf
+	}
+	if l.noHeader {
+		return buf
+	}
+	if t := logHeader.get(); t != nil {
+		t.render(l, buf, s, now, file, line, fn)
+		buf.msg = buf.Len()
+		return buf
+	}
 
 	// Avoid Fprintf, for speed. The format is so simple that we can do it quickly by hand.
 	// It's worth about 3X. Fprintf is hard.
-	_, month, day := now.Date()
-	hour, minute, second := now.Clock()
 	// Lmmdd hh:mm:ss.uuuuuu threadid file:line]
-	buf.tmp[0] = severityChar[s]
-	buf.twoDigits(1, int(month))
-	buf.twoDigits(3, day)
-	buf.tmp[5] = ' '
-	buf.twoDigits(6, hour)
-	buf.tmp[8] = ':'
-	buf.twoDigits(9, minute)
-	buf.tmp[11] = ':'
-	buf.twoDigits(12, second)
-	buf.tmp[14] = '.'
-	buf.nDigits(6, 15, now.Nanosecond()/1000, '0')
-	buf.tmp[21] = ' '
-	buf.nDigits(7, 22, pid, ' ') // TODO: should be TID
-	buf.tmp[29] = ' '
-	buf.Write(buf.tmp[:30])
+	buf.tmp[0] = buf.severityChar(s)
+	i := buf.formatTime(1, now, timestampPrecisionDigits[l.precision.get()])
+	buf.tmp[i] = ' '
+	buf.nDigits(7, i+1, pid, ' ') // TODO: should be TID
+	buf.tmp[i+8] = ' '
+	buf.Write(buf.tmp[:i+9])
+	if l.seq {
+		buf.Write(append(strconv.AppendUint(append(buf.tmp[:0], '#'), nextSeq(), 10), ' '))
+	}
+	if l.goroutineID {
+		id := buf.goroutineID()
+		buf.Write(append(strconv.AppendUint(append(buf.tmp[:0], 'g'), id, 10), ' '))
+	}
 	buf.WriteString(file)
 	buf.tmp[0] = ':'
 	n := buf.someDigits(1, line)
-	buf.tmp[n+1] = ']'
-	buf.tmp[n+2] = ' '
-	buf.Write(buf.tmp[:n+3])
+	buf.Write(buf.tmp[:n+1])
+	if fn != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(fn)
+	}
+	if label := logLabel.get(); label != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(label)
+	}
+	buf.WriteString("] ")
+	buf.msg = buf.Len()
 	return buf
 }
 
+// severityChar returns the letter of severity s that starts the header of
+// the line in buf, or that of AUDIT for an Audit line.
+func (buf *buffer) severityChar(s Severity) byte {
+	if buf.audit {
+		return auditTag[0]
+	}
+	return severityChar[s]
+}
+
+// lineSeq is the last sequence number given to a line with -log_seq.
+var lineSeq uint64
+
+// nextSeq returns the sequence number of a new line.
+func nextSeq() uint64 {
+	return atomic.AddUint64(&lineSeq, 1)
+}
+
+// endLine ends the line in buf with a newline, unless it has one already.
+// The buffer may be empty, as in -log_format=json mode, which writes the
+// header later, and with -log_no_header.
+func (buf *buffer) endLine() {
+	if b := buf.Bytes(); len(b) == 0 || b[len(b)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
+
+// formatTime writes now into buf.tmp at i as "mmdd hh:mm:ss", followed by
+// the given number of digits of the fraction of a second, if any, and
+// returns the index after it.
+func (buf *buffer) formatTime(i int, now time.Time, digits int) int {
+	_, month, day := now.Date()
+	hour, minute, second := now.Clock()
+	buf.twoDigits(i, int(month))
+	buf.twoDigits(i+2, day)
+	buf.tmp[i+4] = ' '
+	buf.twoDigits(i+5, hour)
+	buf.tmp[i+7] = ':'
+	buf.twoDigits(i+8, minute)
+	buf.tmp[i+10] = ':'
+	buf.twoDigits(i+11, second)
+	i += 13
+	if digits > 0 {
+		buf.tmp[i] = '.'
+		buf.nDigits(digits, i+1, now.Nanosecond()/pow10[9-digits], '0')
+		i += 1 + digits
+	}
+	return i
+}
+
+// goroutineID returns the ID of the calling goroutine, which it reads from
+// the first line of its stack trace, "goroutine 123 [running]:", using
+// buf.tmp as scratch space. It returns 0 if the line cannot be parsed.
+func (buf *buffer) goroutineID() uint64 {
+	line := buf.tmp[:runtime.Stack(buf.tmp[:], false)]
+	line = bytes.TrimPrefix(line, []byte("goroutine "))
+	var id uint64
+	for _, c := range line {
+		if c < '0' || c > '9' {
+			break
+		}
+		id = id*10 + uint64(c-'0')
+	}
+	return id
+}
+
+// formatJSON renders the message held in buf, whose header fields were
+// recorded by formatHeader, as a single-line JSON object:
+//
+//	{"severity":"INFO","time":"2006-01-02T15:04:05.999999999-07:00","pid":1234,"file":"file.go","line":12,"msg":"..."}
+//
+// With -log_format=framed the object is instead preceded by its length, as
+// a 4-byte big-endian number, and not followed by a newline, so that lines
+// can be told apart however many newlines their messages hold.
+//
+// It returns a new buffer holding the line and releases buf.
+func (l *loggingT) formatJSON(buf *buffer) *buffer {
+	msg := bytes.TrimSuffix(buf.Bytes(), []byte{'\n'})
+	out := l.getBuffer()
+	framed := l.format.get() == framedFormat
+	if framed {
+		out.Write(out.tmp[:4]) // The length, filled in below.
+	}
+	out.WriteString(`{"severity":"`)
+	if buf.audit {
+		out.WriteString(auditTag)
+	} else {
+		out.WriteString(severityName[buf.sev])
+	}
+	out.WriteString(`","time":"`)
+	out.Write(buf.now.AppendFormat(out.tmp[:0], time.RFC3339Nano))
+	out.WriteString(`","pid":`)
+	out.Write(strconv.AppendInt(out.tmp[:0], int64(pid), 10))
+	if buf.seq != 0 {
+		out.WriteString(`,"seq":`)
+		out.Write(strconv.AppendUint(out.tmp[:0], buf.seq, 10))
+	}
+	if buf.goroutine != 0 {
+		out.WriteString(`,"goroutine":`)
+		out.Write(strconv.AppendUint(out.tmp[:0], buf.goroutine, 10))
+	}
+	if *jsonBuildInfo {
+		if version, commit := programBuild(); version != "" || commit != "" {
+			out.WriteString(`,"version":`)
+			writeJSONString(out, version)
+			out.WriteString(`,"commit":`)
+			writeJSONString(out, commit)
+		}
+	}
+	out.WriteString(`,"file":`)
+	writeJSONString(out, buf.file)
+	out.WriteString(`,"line":`)
+	out.Write(strconv.AppendInt(out.tmp[:0], int64(buf.line), 10))
+	if buf.fn != "" {
+		out.WriteString(`,"func":`)
+		writeJSONString(out, buf.fn)
+	}
+	if buf.label != "" {
+		out.WriteString(`,"label":`)
+		writeJSONString(out, buf.label)
+	}
+	out.WriteString(`,"msg":`)
+	writeJSONString(out, string(msg))
+	for i := 0; i < len(buf.kv); i += 2 {
+		out.WriteByte(',')
+		writeJSONString(out, fmt.Sprint(buf.kv[i]))
+		out.WriteByte(':')
+		writeJSONValue(out, kvValue(buf.kv, i+1))
+	}
+	if framed {
+		out.WriteByte('}')
+		binary.BigEndian.PutUint32(out.Bytes(), uint32(out.Len()-4))
+	} else {
+		out.WriteString("}\n")
+	}
+	l.putBuffer(buf)
+	return out
+}
+
+// framedStacks returns the stack traces in trace as a -log_format=framed
+// record, {"severity":"FATAL","stacks":"..."}, so that writing them to a log
+// file keeps its records intact.
+func (l *loggingT) framedStacks(trace []byte) []byte {
+	out := l.getBuffer()
+	out.Write(out.tmp[:4])
+	out.WriteString(`{"severity":"FATAL","stacks":`)
+	writeJSONString(out, string(trace))
+	out.WriteByte('}')
+	binary.BigEndian.PutUint32(out.Bytes(), uint32(out.Len()-4))
+	framed := append([]byte(nil), out.Bytes()...)
+	l.putBuffer(out)
+	return framed
+}
+
+// writeJSONValue writes v to buf as JSON. Errors and Stringers are written
+// as strings, as is anything encoding/json cannot represent.
+func writeJSONValue(buf *buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		writeJSONString(buf, v)
+		return
+	case error:
+		writeJSONString(buf, v.Error())
+		return
+	case fmt.Stringer:
+		writeJSONString(buf, v.String())
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeJSONString(buf, fmt.Sprint(v))
+		return
+	}
+	buf.Write(b)
+}
+
+// writeJSONString writes s to buf as a quoted JSON string. Invalid UTF-8 is
+// replaced by U+FFFD.
+func writeJSONString(buf *buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(buf, `\u%04x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
+
 // Some custom tiny helper functions to print the log header efficiently.
 
 const digits = "0123456789"
 
 // twoDigits formats a zero-prefixed two-digit integer at buf.tmp[i].
+// pow10 holds the powers of ten by which nanoseconds are scaled down to the
+// -log_timestamp_precision.
+var pow10 = [...]int{1, 10, 100, 1000, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9}
+
 func (buf *buffer) twoDigits(i, d int) {
 	buf.tmp[i+1] = digits[d%10]
 	d /= 10
@@ -692,145 +1690,469 @@ func (buf *buffer) someDigits(i, d int) int {
 	return copy(buf.tmp[i:], buf.tmp[j:])
 }
 
-func (l *loggingT) println(s severity, args ...interface{}) {
+func (l *loggingT) println(s Severity, args ...interface{}) {
 	buf, file, line := l.header(s, 0)
 	fmt.Fprintln(buf, args...)
 	l.output(s, buf, file, line, false)
 }
 
-func (l *loggingT) print(s severity, args ...interface{}) {
+func (l *loggingT) print(s Severity, args ...interface{}) {
 	l.printDepth(s, 1, args...)
 }
 
-func (l *loggingT) printDepth(s severity, depth int, args ...interface{}) {
+func (l *loggingT) printDepth(s Severity, depth int, args ...interface{}) {
 	buf, file, line := l.header(s, depth)
 	fmt.Fprint(buf, args...)
-	if buf.Bytes()[buf.Len()-1] != '\n' {
-		buf.WriteByte('\n')
-	}
+	buf.endLine()
 	l.output(s, buf, file, line, false)
 }
 
-func (l *loggingT) printDepthEntry(s severity, depth int, arg interface{}) {
+func (l *loggingT) printDepthEntry(s Severity, depth int, arg interface{}) {
 	if e, ok := arg.(GLogEntry); ok {
 		buf, file, line := l.createEntry(s, depth, e)
 
-		if buf.Bytes()[buf.Len()-1] != '\n' {
-			buf.WriteByte('\n')
-		}
+		buf.endLine()
 
 		//structured logs use the same log file
 		l.output(infoLog, buf, file, line, false)
 	}
 }
 
-func (l *loggingT) printf(s severity, format string, args ...interface{}) {
-	buf, file, line := l.header(s, 0)
-	fmt.Fprintf(buf, format, args...)
-	if buf.Bytes()[buf.Len()-1] != '\n' {
-		buf.WriteByte('\n')
+// missingValue stands in for the value of a trailing key without one.
+const missingValue = "(MISSING)"
+
+// kvValue returns the value at kv[i], or missingValue if kv has odd length
+// and i is past its end.
+func kvValue(kv []interface{}, i int) interface{} {
+	if i < len(kv) {
+		return kv[i]
+	}
+	return missingValue
+}
+
+// writeKV appends the key/value pairs to buf as " key=value", quoting values
+// that would otherwise be ambiguous.
+func writeKV(buf *buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		buf.WriteByte(' ')
+		fmt.Fprint(buf, kv[i])
+		buf.WriteByte('=')
+		v := fmt.Sprint(kvValue(kv, i+1))
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
 	}
-	l.output(s, buf, file, line, false)
 }
 
-// printWithFileLine behaves like print but uses the provided file and line number.  If
-// alsoLogToStderr is true, the log message always appears on standard error; it
-// will also appear in the log file unless --logtostderr is set.
-func (l *loggingT) printWithFileLine(s severity, file string, line int, alsoToStderr bool, args ...interface{}) {
+// printKV logs msg followed by the key/value pairs in kv, which are
+// rendered as JSON fields in -log_format=json mode.
+func (l *loggingT) printKV(s Severity, depth int, msg string, kv ...interface{}) {
+	buf, file, line := l.header(s, depth)
+	l.outputKV(s, buf, file, line, msg, kv)
+}
+
+// printErr logs msg followed by the key/value pairs describing err that
+// errorKV returns.
+func (l *loggingT) printErr(s Severity, depth int, msg string, err error) {
+	buf, file, line := l.header(s, depth)
+	l.outputKV(s, buf, file, line, msg, errorKV(err, buf.json))
+}
+
+// errorFields is the JSON rendering of an error logged by ErrorErr.
+type errorFields struct {
+	Msg    string   `json:"msg"`
+	Causes []string `json:"causes,omitempty"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+// errorKV returns the key/value pairs that describe err and the errors it
+// wraps, for ErrorErr, as a single errorFields value if asJSON is true.
+func errorKV(err error, asJSON bool) []interface{} {
+	if err == nil {
+		return nil
+	}
+	f := errorFields{Msg: err.Error()}
+	for e, outer := err, true; e != nil; e, outer = unwrapError(e), false {
+		if !outer {
+			f.Causes = append(f.Causes, e.Error())
+		}
+		if f.Detail == "" {
+			if detail := fmt.Sprintf("%+v", e); detail != e.Error() {
+				f.Detail = detail
+			}
+		}
+	}
+	if asJSON {
+		return []interface{}{"error", f}
+	}
+	kv := []interface{}{"error", f.Msg}
+	for _, cause := range f.Causes {
+		kv = append(kv, "cause", cause)
+	}
+	if f.Detail != "" {
+		kv = append(kv, "detail", f.Detail)
+	}
+	return kv
+}
+
+// unwrapError returns the error that err wraps, as errors.Unwrap does, or
+// nil if there is none.
+func unwrapError(err error) error {
+	if u, ok := err.(interface{ Unwrap() error }); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// outputKV appends msg and the key/value pairs in kv to the header in buf
+// and writes the line.
+func (l *loggingT) outputKV(s Severity, buf *buffer, file string, line int, msg string, kv []interface{}) {
+	buf.WriteString(msg)
+	if buf.json {
+		buf.kv = kv
+	} else {
+		writeKV(buf, kv)
+	}
+	buf.WriteByte('\n')
+	l.output(s, buf, file, line, false)
+}
+
+func (l *loggingT) printf(s Severity, format string, args ...interface{}) {
+	buf, file, line := l.header(s, 0)
+	fmt.Fprintf(buf, format, args...)
+	buf.endLine()
+	l.output(s, buf, file, line, false)
+}
+
+// printWithFileLine behaves like print but uses the provided file and line number.  If
+// alsoLogToStderr is true, the log message always appears on standard error; it
+// will also appear in the log file unless --logtostderr is set.
+func (l *loggingT) printWithFileLine(s Severity, file string, line int, alsoToStderr bool, args ...interface{}) {
 	buf := l.formatHeader(s, file, line)
 	fmt.Fprint(buf, args...)
-	if buf.Bytes()[buf.Len()-1] != '\n' {
-		buf.WriteByte('\n')
-	}
+	buf.endLine()
 	l.output(s, buf, file, line, alsoToStderr)
 }
 
-// output writes the data to the log files and releases the buffer.
-func (l *loggingT) output(s severity, buf *buffer, file string, line int, alsoToStderr bool) {
+// output writes the data to the log files and releases the buffer. With
+// -log_async it queues the data for the asynchronous writer instead, but for
+// FATAL lines, which are written once the lines queued before them are.
+func (l *loggingT) output(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
+	if buf.raw {
+		l.outputRaw(s, buf)
+		return
+	}
+	if s.exits() {
+		startFatalWatchdog()
+	}
+	if !s.exits() && dropLine(buf) {
+		l.putBuffer(buf)
+		return
+	}
+	redactLine(buf)
+	if !s.exits() {
+		truncateLine(buf)
+	}
+	if *errorStacks && s == errorLog {
+		buf.Write(callerStack(file, line))
+	}
+	if *logAsync {
+		// The trace requested by -log_backtrace_at must be of the caller's
+		// goroutine, so such lines are written synchronously too.
+		if !s.exits() && !l.traceLocation.isSet() {
+			l.outputAsync(asyncEntry{s, buf, file, line, alsoToStderr})
+			return
+		}
+		stopAsync()
+	}
+	l.outputSync(s, buf, file, line, alsoToStderr)
+}
+
+// outputRaw is output for the bytes of a RawWriter, which it writes as they
+// are, or queues with -log_async.
+func (l *loggingT) outputRaw(s Severity, buf *buffer) {
+	if *logAsync {
+		l.outputAsync(asyncEntry{s: s, buf: buf})
+		return
+	}
+	l.outputSync(s, buf, "", 0, false)
+}
+
+// outputSync writes the data to the log files and releases the buffer.
+func (l *loggingT) outputSync(s Severity, buf *buffer, file string, line int, alsoToStderr bool) {
 	l.mu.Lock()
+	if buf.raw {
+		l.writingRaw = true
+		l.write(s, file, line, buf.Bytes(), false)
+		l.writingRaw = false
+		l.putBuffer(buf)
+		l.mu.Unlock()
+		return
+	}
+	if *rateLimit > 0 && !s.exits() {
+		ok, suppressed := l.allowLine(s, file, line, timeNow())
+		if suppressed > 0 {
+			l.writeSuppressed(s, file, line, suppressed)
+		}
+		if !ok {
+			l.putBuffer(buf)
+			l.mu.Unlock()
+			return
+		}
+	}
+	if *burstWindow > 0 && !s.exits() && !l.burstLine(s, buf, file, line, alsoToStderr, timeNow()) {
+		l.mu.Unlock()
+		return
+	}
+	if *dedupWindow > 0 && !s.exits() && !l.dedupLine(s, buf, file, line, timeNow()) {
+		l.putBuffer(buf)
+		l.mu.Unlock()
+		return
+	}
 	if l.traceLocation.isSet() {
 		if l.traceLocation.match(file, line) {
 			buf.Write(stacks(false))
 		}
 	}
-	data := buf.Bytes()
-	if !flag.Parsed() {
-		os.Stderr.Write([]byte("ERROR: logging before flag.Parse: "))
-		os.Stderr.Write(data)
-	} else if l.toStderr {
-		os.Stderr.Write(data)
-	} else {
-		if alsoToStderr || l.alsoToStderr || s >= l.stderrThreshold.get() {
-			os.Stderr.Write(data)
-		}
-		if l.file[s] == nil {
-			if err := l.createFiles(s); err != nil {
-				os.Stderr.Write(data) // Make sure the message appears somewhere.
-				l.exit(err)
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.write(s, file, line, buf.Bytes(), alsoToStderr)
+	if s.exits() {
+		if t := currentTestLogger(); t != nil {
+			// Under SetTestLogger, fail the test rather than exit.
+			if atomic.SwapUint32(&fatalNoStacks, 0) == 0 {
+				t.Log(string(stacks(false)))
 			}
+			l.putBuffer(buf)
+			l.mu.Unlock()
+			t.Fatal("log: test failed by a FATAL line")
+			return
 		}
-		switch s {
-		case fatalLog:
-			l.file[fatalLog].Write(data)
-		case errorLog:
-			l.file[errorLog].Write(data)
-		case warningLog:
-			l.file[warningLog].Write(data)
-		case infoLog:
-			l.file[infoLog].Write(data)
-		}
-	}
-	if s == fatalLog {
 		// If we got here via Exit rather than Fatal, print no stacks.
 		if atomic.LoadUint32(&fatalNoStacks) > 0 {
+			// Flush and sync the files before anything else can go wrong;
+			// timeoutFlush below only catches what the exit hooks log.
+			l.flushAll()
 			l.mu.Unlock()
-			timeoutFlush(10 * time.Second)
-			os.Exit(1)
+			finishExit()
+			os.Exit(int(atomic.LoadInt32(&exitStatus)))
 		}
 		// Dump all goroutine stacks before exiting.
 		// First, make sure we see the trace for the current goroutine on standard error.
 		// If -logtostderr has been specified, the loop below will do that anyway
 		// as the first stack in the full dump.
-		if !l.toStderr {
+		if !l.toStderr && *fatalToStderr {
 			os.Stderr.Write(stacks(false))
 		}
-		// Write the stack trace for all goroutines to the files.
-		trace := stacks(true)
+		// Write the stack trace for all goroutines, or just this one, to the files.
+		trace := stacks(*fatalAllStacks)
+		if *fatalStackFile {
+			if name, err := l.writeStackFile(trace, timeNow()); err == nil {
+				trace = []byte("Stack traces written to " + name + "\n")
+			}
+		}
+		if l.format.get() == framedFormat {
+			trace = l.framedStacks(trace)
+		}
 		logExitFunc = func(error) {} // If we get a write error, we'll still exit below.
-		for log := fatalLog; log >= infoLog; log-- {
-			if f := l.file[log]; f != nil { // Can be nil if -logtostderr is set.
+		for log := numSeverities() - 1; log >= infoLog; log-- {
+			if f := l.file[log]; f != nil && !l.sharesLaterFile(log) { // Can be nil if -logtostderr is set.
 				f.Write(trace)
 			}
 		}
+		l.flushAll()
 		l.mu.Unlock()
-		timeoutFlush(10 * time.Second)
+		finishExit()
 		os.Exit(255) // C++ uses -1, which is silly because it's anded with 255 anyway.
 	}
 	l.putBuffer(buf)
 	l.mu.Unlock()
+}
+
+// reportPrunes logs at WARNING the files that -log_prune_dry_run has
+// spared, with the header location file:line of the line whose writing
+// spared them. Writing the reports can create a log file, and so spare more,
+// which are reported too. l.mu is held.
+func (l *loggingT) reportPrunes(file string, line int) {
+	l.reportingPrunes = true
+	for len(l.pruneReports) > 0 {
+		path := l.pruneReports[0]
+		l.pruneReports = l.pruneReports[1:]
+		buf := l.formatHeader(warningLog, file, line)
+		fmt.Fprintf(buf, "-log_prune_dry_run: would delete %s\n", path)
+		if buf.json {
+			buf = l.formatJSON(buf)
+		}
+		l.write(warningLog, file, line, buf.Bytes(), false)
+		l.putBuffer(buf)
+	}
+	l.reportingPrunes = false
+}
+
+// ANSI escapes for -log_color.
+const (
+	colorYellow = "\x1b[33m"
+	colorRed    = "\x1b[31m"
+	colorReset  = "\x1b[0m"
+)
+
+// writeStderr writes the formatted line data of severity s to standard
+// error, coloring the severity letter of a text header if -log_color says to.
+// The letter is found where the -log_header_template puts it.
+// l.mu is held.
+func (l *loggingT) writeStderr(s Severity, data []byte) {
+	var color string
+	switch b := s.base(); {
+	case b.atLeast(errorLog):
+		color = colorRed
+	case b == warningLog:
+		color = colorYellow
+	}
+	i := 0
+	if t := logHeader.get(); t != nil {
+		i = t.severityIndex(l, data)
+	}
+	if color == "" || l.noHeader || l.writingRaw || i < 0 || i >= len(data) || data[i] != severityChar[s] || !l.colorStderr() {
+		os.Stderr.Write(data)
+		return
+	}
+	colored := make([]byte, 0, len(color)+len(data)+len(colorReset))
+	colored = append(colored, data[:i]...)
+	colored = append(colored, color...)
+	colored = append(colored, data[i])
+	colored = append(colored, colorReset...)
+	colored = append(colored, data[i+1:]...)
+	os.Stderr.Write(colored)
+}
+
+// colorStderr reports whether -log_color calls for coloring standard error.
+// l.mu is held.
+func (l *loggingT) colorStderr() bool {
+	switch l.color.get() {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+	if l.ttyFile != os.Stderr {
+		l.ttyFile = os.Stderr
+		fi, err := os.Stderr.Stat()
+		l.tty = err == nil && fi.Mode()&os.ModeCharDevice != 0
+	}
+	return l.tty
+}
+
+// write sends the formatted line data of severity s, logged at file:line, to
+// the hooks and to the log outputs, and counts it. l.mu is held.
+func (l *loggingT) write(s Severity, file string, line int, data []byte, alsoToStderr bool) {
+	l.runHooks(s, data)
+	if l.net != nil {
+		l.net.send(data)
+	}
+	if t := currentTestLogger(); t != nil {
+		t.Log(string(bytes.TrimSuffix(data, []byte{'\n'})))
+	} else if !flag.Parsed() {
+		os.Stderr.Write([]byte("ERROR: logging before flag.Parse: "))
+		os.Stderr.Write(data)
+	} else if l.toStderr {
+		l.writeStderr(s, data)
+	} else {
+		toStderr := (alsoToStderr || l.alsoToStderr || s.atLeast(l.stderrThreshold.get())) && (*fatalToStderr || !s.exits())
+		if toStderr {
+			l.writeStderr(s, data)
+		}
+		if s.atLeast(l.fileThreshold.get()) && (l.net == nil || !*networkOnly) {
+			if l.file[s] == nil {
+				if err := l.createFiles(s); err != nil && *logDirStrict {
+					// Give up on files, as -logtostderr does, rather than
+					// look for them anywhere but the configured directories.
+					fmt.Fprintf(os.Stderr, "log: cannot create log file, logging to standard error instead: %v\n", err)
+					l.toStderr = true
+					atomic.AddUint64(&fileErrors, 1)
+					if !toStderr {
+						l.writeStderr(s, data)
+					}
+				} else if err != nil {
+					atomic.AddUint64(&fileErrors, 1)
+					os.Stderr.Write(data) // Make sure the message appears somewhere.
+					l.exit(err)
+				}
+			}
+			if f := l.file[s]; f != nil && !l.toStderr {
+				f.Write(data)
+				flush := s.atLeast(l.flushThreshold.get())
+				if s >= numSeverity {
+					// A registered level also goes to the file of its built-in level.
+					if b := s.base(); b.atLeast(l.fileThreshold.get()) && l.file[b] != nil && !*singleFile {
+						l.file[b].Write(data)
+						if flush {
+							l.file[b].Flush()
+						}
+					}
+				}
+				if flush {
+					f.Flush()
+				}
+			}
+		}
+	}
+	l.writeTees(s, data)
+	if l.ring != nil {
+		l.ring.add(data)
+	}
+	if len(l.pruneReports) > 0 && !l.reportingPrunes {
+		l.reportPrunes(file, line)
+	}
+	// Count the line now, since a fatal log never returns.
 	if stats := severityStats[s]; stats != nil {
 		atomic.AddInt64(&stats.lines, 1)
 		atomic.AddInt64(&stats.bytes, int64(len(data)))
 	}
 }
 
-// timeoutFlush calls Flush and returns when it completes or after timeout
-// elapses, whichever happens first.  This is needed because the hooks invoked
+// timeoutFlush calls FlushTimeout and reports on standard error if the
+// flush took longer than timeout, if positive.  This is needed because the hooks invoked
 // by Flush may deadlock when glog.Fatal is called from a hook that holds
 // a lock.
 func timeoutFlush(timeout time.Duration) {
-	done := make(chan bool, 1)
-	go func() {
-		Flush() // calls logging.lockAndFlushAll()
-		done <- true
-	}()
-	select {
-	case <-done:
-	case <-time.After(timeout):
+	if err := FlushTimeout(timeout); err != nil {
 		fmt.Fprintln(os.Stderr, "glog: Flush took longer than", timeout)
 	}
 }
 
+// errorStacks is set by the -log_error_stacks flag.
+var errorStacks = flag.Bool("log_error_stacks", false, "If true, follow each ERROR line with a stack trace of the logging goroutine")
+
+// callerStack returns the stack trace of the calling goroutine without the
+// frames above the one at file:line, the caller named in a log header, so
+// that glog's own frames are left out. If there is no such frame, the whole
+// trace is returned.
+func callerStack(file string, line int) []byte {
+	trace := stacks(false)
+	// The trace is a "goroutine N [running]:" line followed by two lines
+	// per frame: the function, and its "\t/path/file.go:123 +0x1d".
+	lines := bytes.SplitAfter(trace, []byte{'\n'})
+	at := []byte(fmt.Sprintf("%s:%d", file, line))
+	for i := 2; i < len(lines); i += 2 {
+		loc := bytes.TrimPrefix(bytes.TrimRight(lines[i], "\n"), []byte{'\t'})
+		if sp := bytes.LastIndexByte(loc, ' '); sp >= 0 {
+			loc = loc[:sp]
+		}
+		// file may be a base name or a partial path, so match it only at
+		// a path element boundary.
+		if bytes.HasSuffix(loc, at) && (len(loc) == len(at) || loc[len(loc)-len(at)-1] == '/') {
+			skip := 0
+			for _, l := range lines[1 : i-1] {
+				skip += len(l)
+			}
+			return append(trace[:len(lines[0])], trace[len(lines[0])+skip:]...)
+		}
+	}
+	return trace
+}
+
 // stacks is a wrapper for runtime.Stack that attempts to recover the data for all goroutines.
 func stacks(all bool) []byte {
 	// We don't know how big the traces are, so grow a few times if they don't fit. Start large, though.
@@ -877,107 +2199,399 @@ func (l *loggingT) exit(err error) {
 type syncBuffer struct {
 	logger *loggingT
 	*bufio.Writer
-	file   *os.File
-	sev    severity
-	nbytes uint64 // The number of bytes written to this file
+	file    *os.File
+	sev     Severity
+	tag     string    // The tag of the files, if not the severity name, as for a shard.
+	nbytes  uint64    // The number of bytes written to this file
+	created time.Time // When this file was created, for -log_rotate_interval
+
+	failing  bool      // Whether writes go to standard error, after an error.
+	failedAt time.Time // When writing last failed.
 }
 
 func (sb *syncBuffer) Sync() error {
 	return sb.file.Sync()
 }
 
+// tagName returns the tag of the syncBuffer's files.
+func (sb *syncBuffer) tagName() string {
+	if sb.tag != "" {
+		return sb.tag
+	}
+	return severityName[sb.sev]
+}
+
+// fileRetryInterval is how long a syncBuffer that failed to write its file
+// sends its lines to standard error before it tries a new file.
+const fileRetryInterval = 10 * time.Second
+
+// Write writes p to the log file, rotating it first if it is due. If the
+// file cannot be written, as when the disk is full, the syncBuffer warns once
+// on standard error and falls back to writing there, until a new file, tried
+// every fileRetryInterval, can be written again.
 func (sb *syncBuffer) Write(p []byte) (n int, err error) {
-	if sb.nbytes+uint64(len(p)) >= MaxSize {
-		if err := sb.rotateFile(time.Now()); err != nil {
-			sb.logger.exit(err)
+	now := timeNow()
+	if sb.failing {
+		if now.Sub(sb.failedAt) < fileRetryInterval {
+			atomic.AddUint64(&fileErrors, 1)
+			return os.Stderr.Write(p)
+		}
+		if err := sb.rotateFile(now, openedRetry); err != nil {
+			sb.fail(now, err)
+			atomic.AddUint64(&fileErrors, 1)
+			return os.Stderr.Write(p)
+		}
+		sb.failing = false
+		fmt.Fprintf(os.Stderr, "log: writing %s log to %s again\n", sb.tagName(), sb.file.Name())
+	} else if reason := sb.rotateReason(now, len(p)); reason != "" {
+		if err := sb.rotateFile(now, reason); err != nil {
+			sb.fail(now, err)
+			atomic.AddUint64(&fileErrors, 1)
+			return os.Stderr.Write(p)
 		}
 	}
-	n, err = sb.Writer.Write(p)
+	return sb.writeFile(now, p)
+}
+
+// writeFile writes p to the log file, which is not due for rotation.
+func (sb *syncBuffer) writeFile(now time.Time, p []byte) (int, error) {
+	n, err := sb.Writer.Write(p)
 	sb.nbytes += uint64(n)
 	if err != nil {
-		sb.logger.exit(err)
+		sb.fail(now, err)
+		atomic.AddUint64(&fileErrors, 1)
+		os.Stderr.Write(p[n:])
 	}
-	return
+	return len(p), nil
 }
 
-// rotateFile closes the syncBuffer's file and starts a new one.
-func (sb *syncBuffer) rotateFile(now time.Time) error {
+// fail switches the syncBuffer to writing to standard error after err.
+func (sb *syncBuffer) fail(now time.Time, err error) {
+	if !sb.failing {
+		fmt.Fprintf(os.Stderr, "log: cannot write %s log, writing to standard error instead: %v\n", sb.tagName(), err)
+	}
+	sb.failing, sb.failedAt = true, now
+}
+
+// intervalElapsed reports whether the file is due for rotation because
+// -log_rotate_interval has passed since it was created.
+func (sb *syncBuffer) intervalElapsed(now time.Time) bool {
+	interval := *rotateInterval
+	return interval > 0 && !now.Before(sb.created.Add(interval))
+}
+
+// The reasons for opening a log file, which its banner records.
+const (
+	openedStartup = "startup"
+	openedSize    = "size rotation"
+	openedTime    = "time rotation"
+	openedRetry   = "retry after a write error"
+)
+
+// rotateReason returns why the file is due for rotation before n more bytes
+// are written to it, or "" if it is not.
+func (sb *syncBuffer) rotateReason(now time.Time, n int) string {
+	switch {
+	case sb.nbytes+uint64(n) >= MaxSize:
+		return openedSize
+	case sb.intervalElapsed(now):
+		return openedTime
+	}
+	return ""
+}
+
+// rotateFile closes the syncBuffer's file and starts a new one, whose banner
+// gives reason as the reason it was opened.
+func (sb *syncBuffer) rotateFile(now time.Time, reason string) error {
+	ev := RotateEvent{Severity: sb.sev, Bytes: sb.nbytes, Reason: reason}
 	if sb.file != nil {
+		ev.OldName = sb.file.Name()
 		sb.Flush()
 		sb.file.Close()
+		if *compress && reason != openedReopen && sb.tag != auditTag {
+			queueCompression(sb.file.Name())
+		}
 	}
 	var err error
-	sb.file, _, err = create(severityName[sb.sev], now)
+	sb.file, _, err = create(sb.tagName(), now)
 	sb.nbytes = 0
+	sb.created = now
 	if err != nil {
 		return err
 	}
+	// With -log_append the file may already hold data, which counts
+	// towards MaxSize.
+	if fi, err := sb.file.Stat(); err == nil {
+		sb.nbytes = uint64(fi.Size())
+	}
 
+	// A MaxFileCount of zero (or less) disables count-based deletion of old
+	// files, but -log_max_age may still apply. AUDIT files are never deleted.
 	maxFileCount := MaxFileCount
-	if maxFileCount < 2 {
+	if maxFileCount > 0 && maxFileCount < 2 {
 		maxFileCount = 2
 	}
-
-	logFileCount := maxFileCount + 1 //force to enter the for loop at least once
-	safety := 10
-
-	for logFileCount > maxFileCount {
-		logFileCount, err = deleteOldLogFile(severityName[infoLog], maxFileCount)
-		if err != nil {
+	if sb.sev == fatalLog && !*pruneFatal {
+		maxFileCount = 0 // Keep the record of every crash.
+	}
+	if (maxFileCount > 0 || *maxAge > 0 || MaxTotalSize > 0) && sb.tag != auditTag {
+		if _, _, err = deleteOldLogFile(sb.tagName(), maxFileCount); err != nil {
 			return err
 		}
-		safety--
-		if safety < 0 {
-			break
-		}
 	}
 
-	sb.Writer = bufio.NewWriterSize(sb.file, bufferSize)
+	sb.Writer = bufio.NewWriterSize(sb.file, int(bufferSize))
 
 	// Write header.
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "Log file created at: %s\n", now.Format("2006/01/02 15:04:05"))
+	fmt.Fprintf(&buf, "Log file created at: %s\n", logging.logTime(now).Format("2006/01/02 15:04:05"))
 	fmt.Fprintf(&buf, "Running on machine: %s\n", host)
 	fmt.Fprintf(&buf, "Binary: Built with %s %s for %s/%s\n", runtime.Compiler, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&buf, "Running as: %s, pid %d\n", program, pid)
+	fmt.Fprintf(&buf, "Opened for: %s\n", reason)
+	if version, commit := programBuild(); version != "" || commit != "" {
+		fmt.Fprintf(&buf, "Build: version %s, commit %s\n", orUnknown(version), orUnknown(commit))
+	}
 	fmt.Fprintf(&buf, "--------------------|JSON|--------------------\n")
 	// fmt.Fprintf(&buf, "Log line format: [IWEF]mmdd hh:mm:ss.uuuuuu threadid file:line] msg\n")
-	n, err := sb.file.Write(buf.Bytes())
-	sb.nbytes += uint64(n)
+	// The banner is not counted towards MaxSize, so that a small MaxSize
+	// cannot make every line start a new file. A -log_format=framed file
+	// has none, to hold nothing but records.
+	if sb.logger.format.get() != framedFormat {
+		if _, err = sb.file.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	ev.NewName = sb.file.Name()
+	sb.logger.runRotateHooks(ev)
+	return nil
+}
 
-	return err
+// orUnknown returns s, or "unknown" if it is empty.
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
 }
 
 // bufferSize sizes the buffer associated with each log file. It's large
 // so that log records can accumulate without the logging thread blocking
-// on disk I/O. The flushDaemon will block instead.
-const bufferSize = 256 * 1024
-
-// createFiles creates all the log files for severity from sev down to infoLog.
-// l.mu is held.
-func (l *loggingT) createFiles(sev severity) error {
-	now := time.Now()
+// on disk I/O. The flushDaemon will block instead. It is set by the
+// -log_buffer_size flag, and applies to the files opened after it is set.
+var bufferSize uint64 = 256 * 1024
+
+// createFiles creates all the log files for severity from sev down to infoLog,
+// or to the -filethreshold if that is higher. For a registered severity, that
+// is its own file and those from its built-in level down. l.mu is held.
+func (l *loggingT) createFiles(sev Severity) error {
+	now := timeNow()
+	l.startFlushDaemon()
+	startReopenHandler()
+	if *singleFile {
+		return l.createSingleFile(now)
+	}
+	if sev >= numSeverity {
+		if err := l.createFile(sev, now); err != nil {
+			return err
+		}
+		sev = sev.base()
+	}
 	// Files are created in decreasing severity order, so as soon as we find one
 	// has already been created, we can stop.
-	for s := sev; s >= infoLog && l.file[s] == nil; s-- {
-		sb := &syncBuffer{
+	for s := sev; s >= infoLog && s.atLeast(l.fileThreshold.get()) && l.file[s] == nil; s-- {
+		if err := l.createFile(s, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSingleFile creates the one log file that -log_single_file shares
+// among the severities at or above the -filethreshold, named as the INFO log,
+// or shares the one already created with the severities without a file.
+// l.mu is held.
+func (l *loggingT) createSingleFile(now time.Time) error {
+	var shared *syncBuffer
+	for _, w := range l.file {
+		if sb, ok := w.(*syncBuffer); ok {
+			shared = sb
+			break
+		}
+	}
+	if shared == nil {
+		shared = &syncBuffer{
 			logger: l,
-			sev:    s,
+			sev:    infoLog,
 		}
-		if err := sb.rotateFile(now); err != nil {
+		if err := shared.rotateFile(now, openedStartup); err != nil {
 			return err
 		}
-		l.file[s] = sb
+		writePIDFile(shared)
+	}
+	for s := infoLog; s < numSeverities(); s++ {
+		if l.file[s] == nil && s.atLeast(l.fileThreshold.get()) {
+			l.file[s] = shared
+		}
 	}
 	return nil
 }
 
-const flushInterval = 30 * time.Second
+// sameFile reports whether severities s and t write to the same syncBuffer,
+// as with -log_single_file. l.mu is held.
+func (l *loggingT) sameFile(s, t Severity) bool {
+	sb, ok := l.file[s].(*syncBuffer)
+	return ok && l.file[t] == flushSyncWriter(sb)
+}
+
+// sharesFile reports whether any other severity writes to the same syncBuffer
+// as severity s. l.mu is held.
+func (l *loggingT) sharesFile(s Severity) bool {
+	for t := infoLog; t < numSeverities(); t++ {
+		if t != s && l.sameFile(s, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesLaterFile reports whether the log file of severity s is also that of
+// a severity numbered after it, so that the loops over the files, which run
+// from the last severity down, visit each file once. l.mu is held.
+func (l *loggingT) sharesLaterFile(s Severity) bool {
+	for t := s + 1; t < numSeverities(); t++ {
+		if l.sameFile(s, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// createFile creates the log file for severity s. l.mu is held.
+func (l *loggingT) createFile(s Severity, now time.Time) error {
+	sb := &syncBuffer{
+		logger: l,
+		sev:    s,
+	}
+	// Install sb first, so that pruning the other files for its tag
+	// treats its new file as open.
+	l.file[s] = sb
+	if err := sb.rotateFile(now, openedStartup); err != nil {
+		l.file[s] = nil
+		return err
+	}
+	writePIDFile(sb)
+	return nil
+}
+
+// defaultFlushInterval is the default -log_flush_interval.
+const defaultFlushInterval = 30 * time.Second
+
+// flushInterval is set by the -log_flush_interval flag. The flushDaemon,
+// started by init, reads it while flag.Parse may be setting it.
+var flushInterval = atomicDuration(defaultFlushInterval)
+
+// atomicDuration is a time.Duration that is read and set atomically. It
+// implements the flag.Value interface; the -log_flush_interval flag is of
+// type atomicDuration.
+type atomicDuration int64 // sync/atomic int64
+
+// get returns the value of the atomicDuration.
+func (d *atomicDuration) get() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(d)))
+}
+
+// set sets the value of the atomicDuration.
+func (d *atomicDuration) set(val time.Duration) {
+	atomic.StoreInt64((*int64)(d), int64(val))
+}
+
+// String is part of the flag.Value interface.
+func (d *atomicDuration) String() string {
+	return d.get().String()
+}
+
+// Get is part of the flag.Getter interface.
+func (d *atomicDuration) Get() interface{} {
+	return d.get()
+}
+
+// Syntax: -log_flush_interval=10s
+func (d *atomicDuration) Set(value string) error {
+	val, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.set(val)
+	return nil
+}
+
+// flushPeriod returns the -log_flush_interval, or its default if the flag
+// is not positive.
+func flushPeriod() time.Duration {
+	if d := flushInterval.get(); d > 0 {
+		return d
+	}
+	return defaultFlushInterval
+}
+
+// flushDaemon periodically flushes the log file buffers. It also compresses
+// rotated log files queued by rotateFile when -log_compress is set. The
+// period is read anew after each flush, so that it follows flag.Parse.
+func (l *loggingT) flushDaemon(stop chan struct{}) {
+	timer := time.NewTimer(flushPeriod())
+	defer timer.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+			l.lockAndFlushAll()
+			timer.Reset(flushPeriod())
+		case name := <-compressQueue:
+			if err := compressLogFile(name); err != nil {
+				fmt.Fprintf(os.Stderr, "log: cannot compress %s: %v\n", name, err)
+			}
+		}
+	}
+}
+
+// startFlushDaemon starts the flushDaemon unless it is already running.
+// l.mu is held.
+func (l *loggingT) startFlushDaemon() {
+	if l.flushStop == nil {
+		l.flushStop = make(chan struct{})
+		go l.flushDaemon(l.flushStop)
+	}
+}
 
-// flushDaemon periodically flushes the log file buffers.
-func (l *loggingT) flushDaemon() {
-	for range time.NewTicker(flushInterval).C {
-		l.lockAndFlushAll()
+// Shutdown prepares the logs for the program to exit: it stops the
+// goroutine that periodically flushes them, flushes all pending log I/O,
+// and syncs and closes the open log files. Rotated files still waiting to be
+// compressed are left as they are. Lines queued by -log_async are written
+// first, as are lines begun on a Writer without their newline. Lines logged
+// after Shutdown open new log files, as on first use, and restart the
+// periodic flushing. The -log_pid_file is removed. Shutdown may be called
+// more than once, and from any goroutine, such as one handling signals.
+func Shutdown() {
+	partialWriters.flush()
+	stopAsync()
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if logging.flushStop != nil {
+		close(logging.flushStop)
+		logging.flushStop = nil
+	}
+	logging.flushAll()
+	for s, w := range logging.file {
+		if sb, ok := w.(*syncBuffer); ok {
+			sb.file.Close() // ignore error
+			logging.file[s] = nil
+		}
 	}
+	closeShards()
+	closeAudit()
+	removePIDFile()
 }
 
 // lockAndFlushAll is like flushAll but locks l.mu first.
@@ -990,14 +2604,24 @@ func (l *loggingT) lockAndFlushAll() {
 // flushAll flushes all the logs and attempts to "sync" their data to disk.
 // l.mu is held.
 func (l *loggingT) flushAll() {
+	if len(bursts) > 0 {
+		l.endBursts()
+	}
+	if *dedupWindow > 0 {
+		l.endAllRepeats()
+	}
+	if len(rateWindows) > 0 {
+		l.endRateWindows(timeNow())
+	}
 	// Flush from fatal down, in case there's trouble flushing.
-	for s := fatalLog; s >= infoLog; s-- {
+	for s := numSeverities() - 1; s >= infoLog; s-- {
 		file := l.file[s]
-		if file != nil {
+		if file != nil && !l.sharesLaterFile(s) {
 			file.Flush() // ignore error
 			file.Sync()  // ignore error
 		}
 	}
+	flushShards()
 }
 
 // CopyStandardLogTo arranges for messages written to the Go "log" package's
@@ -1020,20 +2644,26 @@ func CopyStandardLogTo(name string) {
 
 // logBridge provides the Write method that enables CopyStandardLogTo to connect
 // Go's standard logs to the logs provided by this package.
-type logBridge severity
+type logBridge Severity
 
 // Write parses the standard logging line and passes its components to the
 // logger for severity(lb).
 func (lb logBridge) Write(b []byte) (n int, err error) {
-	var (
-		file = "???"
-		line = 1
-		text string
-	)
-	// Split "d.go:23: message" into "d.go", "23", and "message".
+	file, line, text := parseStandardLog(b)
+	// printWithFileLine with alsoToStderr=true, so standard log messages
+	// always appear on standard error.
+	logging.printWithFileLine(Severity(lb), file, line, true, text)
+	return len(b), nil
+}
+
+// parseStandardLog splits a line of the standard log, "d.go:23: message",
+// into "d.go", 23, and "message".
+func parseStandardLog(b []byte) (file string, line int, text string) {
+	file, line = "???", 1
 	if parts := bytes.SplitN(b, []byte{':'}, 3); len(parts) != 3 || len(parts[0]) < 1 || len(parts[2]) < 1 {
 		text = fmt.Sprintf("bad log format: %s", b)
 	} else {
+		var err error
 		file = string(parts[0])
 		text = string(parts[2][1:]) // skip leading space
 		line, err = strconv.Atoi(string(parts[1]))
@@ -1042,9 +2672,212 @@ func (lb logBridge) Write(b []byte) (n int, err error) {
 			line = 1
 		}
 	}
-	// printWithFileLine with alsoToStderr=true, so standard log messages
-	// always appear on standard error.
-	logging.printWithFileLine(severity(lb), file, line, true, text)
+	return file, line, text
+}
+
+// CopyStandardLogToWithMapping is like CopyStandardLogTo, but chooses the
+// severity of each message by its prefix: a message starting with a key of
+// prefixMap, such as "[WARN]", goes to the log of that key's severity, with
+// the prefix and the spaces after it removed. The longest matching prefix
+// wins. Other messages go to the log of defaultSev. CopyStandardLogToWithMapping
+// panics if any of the severities is not known.
+func CopyStandardLogToWithMapping(defaultSev Severity, prefixMap map[string]Severity) {
+	bridge := mappedLogBridge{defaultSev: defaultSev}
+	for prefix, sev := range prefixMap {
+		bridge.prefixes = append(bridge.prefixes, prefixSeverity{prefix, sev})
+	}
+	for _, p := range append(bridge.prefixes, prefixSeverity{"", defaultSev}) {
+		if !p.sev.valid() {
+			panic(fmt.Sprintf("log.CopyStandardLogToWithMapping: unknown severity %d", p.sev))
+		}
+	}
+	sort.Slice(bridge.prefixes, func(i, j int) bool {
+		return len(bridge.prefixes[i].prefix) > len(bridge.prefixes[j].prefix)
+	})
+	stdLog.SetFlags(stdLog.Lshortfile)
+	stdLog.SetOutput(bridge)
+}
+
+// prefixSeverity pairs a message prefix with the severity it selects.
+type prefixSeverity struct {
+	prefix string
+	sev    Severity
+}
+
+// mappedLogBridge is the standard log's output installed by
+// CopyStandardLogToWithMapping. The prefixes are sorted longest first.
+type mappedLogBridge struct {
+	defaultSev Severity
+	prefixes   []prefixSeverity
+}
+
+// Write parses the standard logging line and passes its components to the
+// logger for the severity its message prefix selects.
+func (mb mappedLogBridge) Write(b []byte) (n int, err error) {
+	file, line, text := parseStandardLog(b)
+	sev := mb.defaultSev
+	for _, p := range mb.prefixes {
+		if strings.HasPrefix(text, p.prefix) {
+			sev, text = p.sev, strings.TrimLeft(text[len(p.prefix):], " ")
+			break
+		}
+	}
+	logging.printWithFileLine(sev, file, line, true, text)
+	return len(b), nil
+}
+
+// Writer returns an io.Writer that logs each line written to it at severity
+// sev, for libraries that log to an io.Writer of their own:
+//
+//	srv.ErrorLog = log.New(glog.Writer(glog.ErrorLevel), "", 0)
+//
+// As with the standard log package, a line is logged once its newline is
+// written, so a line may be written in pieces; each line gets its own header.
+// The header names the first caller outside the standard log and fmt packages
+// of the Write that completed the line. A line still without its newline is
+// logged by Close, or by Shutdown.
+func Writer(sev Severity) io.WriteCloser {
+	if !sev.valid() {
+		sev = infoLog
+	}
+	return &severityWriter{sev: sev}
+}
+
+// severityWriter is the io.WriteCloser returned by Writer.
+type severityWriter struct {
+	sev Severity
+
+	mu      sync.Mutex
+	partial []byte // The start of a line, written without its newline.
+	file    string // The file and line of the caller that last added to partial.
+	line    int
+}
+
+func (w *severityWriter) Write(b []byte) (n int, err error) {
+	file, line := writerCaller()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, wasPartial := b, len(w.partial) > 0
+	if wasPartial {
+		data = append(w.partial, b...)
+		w.partial = w.partial[:0]
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		logging.printWithFileLine(w.sev, file, line, false, string(data[:i]))
+		data = data[i+1:]
+	}
+	if len(data) > 0 {
+		w.partial = append(w.partial[:0], data...)
+		w.file, w.line = file, line
+		partialWriters.add(w)
+	} else if wasPartial {
+		partialWriters.remove(w)
+	}
+	return len(b), nil
+}
+
+// Close logs the line written so far without its newline, if any. The
+// writer may still be used afterwards.
+func (w *severityWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushPartial()
+	partialWriters.remove(w)
+	return nil
+}
+
+// flushPartial logs the line written so far without its newline, if any.
+// w.mu is held.
+func (w *severityWriter) flushPartial() {
+	if len(w.partial) > 0 {
+		logging.printWithFileLine(w.sev, w.file, w.line, false, string(w.partial))
+		w.partial = w.partial[:0]
+	}
+}
+
+// partialWriters is the set of severityWriters holding part of a line, for
+// Shutdown to log.
+var partialWriters writerSet
+
+// writerSet is a set of severityWriters, safe for concurrent use.
+type writerSet struct {
+	mu sync.Mutex
+	m  map[*severityWriter]bool
+}
+
+func (s *writerSet) add(w *severityWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = make(map[*severityWriter]bool)
+	}
+	s.m[w] = true
+}
+
+func (s *writerSet) remove(w *severityWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, w)
+}
+
+// flush logs the partial line of each writer in the set, and empties it.
+func (s *writerSet) flush() {
+	s.mu.Lock()
+	writers := s.m
+	s.m = nil
+	s.mu.Unlock()
+	for w := range writers {
+		w.mu.Lock()
+		w.flushPartial()
+		w.mu.Unlock()
+	}
+}
+
+// writerCaller returns the file and line of the caller of
+// severityWriter.Write, skipping the log and fmt packages.
+func writerCaller() (string, int) {
+	var pcs [16]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for more := true; more; {
+		var f runtime.Frame
+		f, more = frames.Next()
+		if f.Function == "" || strings.HasPrefix(f.Function, "log.") || strings.HasPrefix(f.Function, "fmt.") {
+			continue
+		}
+		return logging.filePath.get().trim(f.File), f.Line
+	}
+	return "???", 1
+}
+
+// RawWriter returns an io.Writer that sends the bytes written to it to the
+// outputs of severity sev just as they are: with no header, no newline added
+// or removed, and none of the filtering, redaction, truncation or sampling
+// applied to log lines. The outputs are chosen as for a line logged at sev,
+// by -logtostderr, -stderrthreshold, -filethreshold and the like, and the
+// hooks see each write. Each Write is sent whole, in order with the lines
+// logged around it, even with -log_async. Writing to a FATAL RawWriter does
+// not end the program.
+func RawWriter(sev Severity) io.Writer {
+	if !sev.valid() {
+		sev = infoLog
+	}
+	return rawWriter{sev}
+}
+
+// rawWriter is the io.Writer returned by RawWriter.
+type rawWriter struct {
+	sev Severity
+}
+
+func (w rawWriter) Write(b []byte) (n int, err error) {
+	buf := logging.getBuffer()
+	buf.raw = true
+	buf.Write(b)
+	logging.output(w.sev, buf, "", 0, false)
 	return len(b), nil
 }
 
@@ -1090,18 +2923,42 @@ type Verbose bool
 //	glog.V(2).Info("log this")
 //
 // The second form is shorter but the first is cheaper if logging is off because it does
-// not evaluate its arguments.
+// not evaluate its arguments. The first may also be written
+//
+//	if v := glog.V(2); v.Enabled() { v.Info("log this", expensive()) }
+//
+// When logging is off at the level, V and the methods of the Verbose it
+// returns are small enough to be inlined, and cost no more than the check.
 //
 // Whether an individual call to V generates a log record depends on the setting of
 // the -v and --vmodule flags; both are off by default. If the level in the call to
 // V is at most the value of -v, or of -vmodule for the source file containing the
-// call, the V call will log.
+// call, the V call will log. With -log_sample_rate=N, only every Nth call at a
+// call site that would log at a level above zero does.
 func V(level Level) Verbose {
 	// This function tries hard to be cheap unless there's work to do.
-	// The fast path is two atomic loads and compares.
+	// The fast path is two atomic loads and compares, and leaves the rest
+	// to verbose so that V can be inlined; it loads the verbosity itself
+	// rather than by logging.verbosity.get() to stay within the inlining
+	// budget.
+	if atomic.LoadInt32((*int32)(&logging.verbosity)) >= int32(level) || atomic.LoadInt32(&logging.filterLength) > 0 {
+		return verbose(level)
+	}
+	return Verbose(false)
+}
 
+// verbose is V for when V logging may be on at level, globally or by
+// -vmodule. It must be called directly from V, for the call depth.
+func verbose(level Level) Verbose {
 	// Here is a cheap but safe test to see if V logging is enabled globally.
 	if logging.verbosity.get() >= level {
+		if level > 0 && *sampleRate > 1 {
+			var pcs [1]uintptr
+			if runtime.Callers(3, pcs[:]) == 0 {
+				return Verbose(true)
+			}
+			return Verbose(sampleV(pcs[0]))
+		}
 		return Verbose(true)
 	}
 
@@ -1113,18 +2970,28 @@ func V(level Level) Verbose {
 		// but if V logging is enabled we're slow anyway.
 		logging.mu.Lock()
 		defer logging.mu.Unlock()
-		if runtime.Callers(2, logging.pcs[:]) == 0 {
+		if runtime.Callers(3, logging.pcs[:]) == 0 {
 			return Verbose(false)
 		}
 		v, ok := logging.vmap[logging.pcs[0]]
 		if !ok {
 			v = logging.setV(logging.pcs[0])
 		}
+		if v >= level && level > 0 && *sampleRate > 1 {
+			return Verbose(sampleV(logging.pcs[0]))
+		}
 		return Verbose(v >= level)
 	}
 	return Verbose(false)
 }
 
+// Enabled reports whether v logs, so that the arguments of an expensive log
+// line need be computed only if it does. See the documentation of V for
+// usage.
+func (v Verbose) Enabled() bool {
+	return bool(v)
+}
+
 // Info is equivalent to the global Info function, guarded by the value of v.
 // See the documentation of V for usage.
 func (v Verbose) Info(args ...interface{}) {
@@ -1149,6 +3016,14 @@ func (v Verbose) Infof(format string, args ...interface{}) {
 	}
 }
 
+// InfoDepth is equivalent to the global InfoDepth function, guarded by the value of v.
+// See the documentation of V for usage.
+func (v Verbose) InfoDepth(depth int, args ...interface{}) {
+	if v {
+		logging.printDepth(infoLog, depth, args...)
+	}
+}
+
 // structured logging
 func InfoStructuredDepth(depth int, arg interface{}) {
 	logging.printDepthEntry(infoLog, depth, arg)
@@ -1190,6 +3065,13 @@ func Infof(format string, args ...interface{}) {
 	logging.printf(infoLog, format, args...)
 }
 
+// InfoKV logs msg to the INFO log, followed by the alternating keys and
+// values in kv as key=value pairs, or as fields in -log_format=json mode.
+// A key without a value is given the value "(MISSING)".
+func InfoKV(msg string, kv ...interface{}) {
+	logging.printKV(infoLog, 0, msg, kv...)
+}
+
 // Warning logs to the WARNING and INFO logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Warning(args ...interface{}) {
@@ -1214,6 +3096,12 @@ func Warningf(format string, args ...interface{}) {
 	logging.printf(warningLog, format, args...)
 }
 
+// WarningKV logs msg and the key/value pairs in kv to the WARNING and INFO logs.
+// See InfoKV for how kv is rendered.
+func WarningKV(msg string, kv ...interface{}) {
+	logging.printKV(warningLog, 0, msg, kv...)
+}
+
 // Error logs to the ERROR, WARNING, and INFO logs.
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Error(args ...interface{}) {
@@ -1238,6 +3126,22 @@ func Errorf(format string, args ...interface{}) {
 	logging.printf(errorLog, format, args...)
 }
 
+// ErrorKV logs msg and the key/value pairs in kv to the ERROR, WARNING, and INFO logs.
+// See InfoKV for how kv is rendered.
+func ErrorKV(msg string, kv ...interface{}) {
+	logging.printKV(errorLog, 0, msg, kv...)
+}
+
+// ErrorErr logs msg and err to the ERROR, WARNING, and INFO logs. The error is
+// rendered as error="..." followed by a cause="..." for each error it wraps,
+// as found by its Unwrap methods, and by detail="..." if formatting one of
+// them with %+v gives more, such as a stack trace. In -log_format=json mode
+// these are the fields msg, causes and detail of an "error" object. If err is
+// nil, only msg is logged.
+func ErrorErr(msg string, err error) {
+	logging.printErr(errorLog, 0, msg, err)
+}
+
 // Fatal logs to the FATAL, ERROR, WARNING, and INFO logs,
 // including a stack trace of all running goroutines, then calls os.Exit(255).
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
@@ -1269,6 +3173,90 @@ func Fatalf(format string, args ...interface{}) {
 // It allows Exit and relatives to use the Fatal logs.
 var fatalNoStacks uint32
 
+// exitStatus is the status with which Exit and relatives end the process.
+// It is 1 but for ExitCode and ExitCodef.
+var exitStatus int32 = 1
+
+// fatalAllStacks is set by the -log_fatal_all_stacks flag.
+var fatalAllStacks = flag.Bool("log_fatal_all_stacks", true, "If false, Fatal writes only the stack trace of the goroutine that called it, not those of all goroutines")
+
+// fatalToStderr is set by the -log_fatal_to_stderr flag.
+var fatalToStderr = flag.Bool("log_fatal_to_stderr", true, "If false, FATAL lines and their stack trace go only to the log files, not also to standard error")
+
+// fatalTimeout is set by the -log_fatal_timeout flag.
+var fatalTimeout = flag.Duration("log_fatal_timeout", 10*time.Second, "If positive, the longest Fatal or Exit may take before the process exits anyway")
+
+// testLogger is the part of testing.TB that SetTestLogger sends log lines
+// to.
+type testLogger interface {
+	Log(args ...interface{})
+	Fatal(args ...interface{})
+}
+
+// testOutput holds the testSink installed by SetTestLogger. It is read
+// without locks, so that the Fatal path can check it however stuck the
+// logging is.
+var testOutput atomic.Value // testSink
+
+// testSink wraps the testLogger in testOutput, nil if there is none.
+type testSink struct {
+	t testLogger
+}
+
+// currentTestLogger returns the testLogger installed by SetTestLogger, if
+// any.
+func currentTestLogger() testLogger {
+	sink, _ := testOutput.Load().(testSink)
+	return sink.t
+}
+
+// fatalStart is when the first Fatal or Exit began, in nanoseconds since
+// 1970, or 0. It is handled atomically.
+var fatalStart int64
+
+// startFatalWatchdog makes sure the process exits within -log_fatal_timeout
+// of a Fatal or Exit starting, should the logging, stack dump, flush or exit
+// hooks hang. The timer takes no locks and writes nothing, since whatever
+// holds up the exit may well be holding those too.
+func startFatalWatchdog() {
+	atomic.CompareAndSwapInt64(&fatalStart, 0, time.Now().UnixNano())
+	d := *fatalTimeout
+	if d <= 0 || currentTestLogger() != nil {
+		return
+	}
+	code := 255
+	if atomic.LoadUint32(&fatalNoStacks) > 0 {
+		code = int(atomic.LoadInt32(&exitStatus))
+	}
+	time.AfterFunc(d, func() { os.Exit(code) })
+}
+
+// fatalTimeLeft returns how long the exit hooks and the final flush of a
+// Fatal or Exit may still take: what is left of the -log_fatal_timeout since
+// the Fatal or Exit began, or 0, for no limit, if the flag is not positive.
+// Once the time is up it returns a nanosecond, so that they give up at once;
+// the watchdog ends the process then anyway.
+func fatalTimeLeft() time.Duration {
+	d := *fatalTimeout
+	if d <= 0 {
+		return 0
+	}
+	if start := atomic.LoadInt64(&fatalStart); start != 0 {
+		d -= time.Since(time.Unix(0, start))
+	}
+	if d <= 0 {
+		return time.Nanosecond
+	}
+	return d
+}
+
+// finishExit runs the exit hooks, then flushes what they logged, within
+// what is left of the -log_fatal_timeout.
+func finishExit() {
+	runExitHooks(fatalTimeLeft())
+	timeoutFlush(fatalTimeLeft())
+}
+
 // Exit logs to the FATAL, ERROR, WARNING, and INFO logs, then calls os.Exit(1).
 // Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
 func Exit(args ...interface{}) {
@@ -1295,3 +3283,22 @@ func Exitf(format string, args ...interface{}) {
 	atomic.StoreUint32(&fatalNoStacks, 1)
 	logging.printf(fatalLog, format, args...)
 }
+
+// ExitCode logs to the FATAL, ERROR, WARNING, and INFO logs, then calls
+// os.Exit(code). As with Exit, the logs are flushed and the exit hooks run
+// first, and no stack trace is written.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func ExitCode(code int, args ...interface{}) {
+	atomic.StoreInt32(&exitStatus, int32(code))
+	atomic.StoreUint32(&fatalNoStacks, 1)
+	logging.print(fatalLog, args...)
+}
+
+// ExitCodef logs to the FATAL, ERROR, WARNING, and INFO logs, then calls
+// os.Exit(code). See ExitCode.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func ExitCodef(code int, format string, args ...interface{}) {
+	atomic.StoreInt32(&exitStatus, int32(code))
+	atomic.StoreUint32(&fatalNoStacks, 1)
+	logging.printf(fatalLog, format, args...)
+}
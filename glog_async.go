@@ -0,0 +1,174 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Asynchronous writing of log lines.
+
+package glog
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// logAsync is set by the -log_async flag.
+	logAsync = flag.Bool("log_async", false, "If true, queue log lines to be written by a separate goroutine; FATAL lines are always written at once")
+	// asyncQueueSize is set by the -log_async_queue_size flag.
+	asyncQueueSize = flag.Int("log_async_queue_size", 1024, "number of log lines -log_async can queue before dropping them")
+	// asyncDropOldest is set by the -log_async_drop_oldest flag.
+	asyncDropOldest = flag.Bool("log_async_drop_oldest", false, "If true, drop the oldest queued line rather than the new one when the -log_async queue is full")
+)
+
+// asyncEntry is a log line queued by outputAsync, with the arguments of
+// outputSync.
+type asyncEntry struct {
+	s            Severity
+	buf          *buffer
+	file         string
+	line         int
+	alsoToStderr bool
+}
+
+// asyncState holds the queue of the asynchronous writer, while it runs.
+var asyncState struct {
+	// mu is held for reading to queue a line, and for writing to start or
+	// stop the writer.
+	mu      sync.RWMutex
+	queue   chan asyncEntry    // Nil while the writer is not running.
+	flushes chan chan struct{} // Each closed once the lines queued before it are written.
+	exited  chan struct{}      // Closed once the writer has written every line.
+}
+
+// asyncDropped counts the log lines dropped by a full -log_async queue.
+var asyncDropped uint64
+
+// AsyncDropped returns the number of log lines that were dropped because the
+// -log_async queue was full.
+func AsyncDropped() uint64 {
+	return atomic.LoadUint64(&asyncDropped)
+}
+
+// outputAsync queues e for the asynchronous writer, which it starts if need
+// be. It never blocks; if the queue is full, e or the oldest queued line is
+// dropped, as -log_async_drop_oldest says.
+func (l *loggingT) outputAsync(e asyncEntry) {
+	for {
+		asyncState.mu.RLock()
+		if q := asyncState.queue; q != nil {
+			l.enqueue(q, e)
+			asyncState.mu.RUnlock()
+			return
+		}
+		asyncState.mu.RUnlock()
+		l.startAsync()
+	}
+}
+
+func (l *loggingT) enqueue(q chan asyncEntry, e asyncEntry) {
+	select {
+	case q <- e:
+		return
+	default:
+	}
+	if *asyncDropOldest {
+		select {
+		case old := <-q:
+			l.dropAsync(old)
+		default:
+		}
+		select {
+		case q <- e:
+			return
+		default:
+		}
+	}
+	l.dropAsync(e)
+}
+
+func (l *loggingT) dropAsync(e asyncEntry) {
+	atomic.AddUint64(&asyncDropped, 1)
+	l.putBuffer(e.buf)
+}
+
+// startAsync starts the asynchronous writer unless it is running.
+func (l *loggingT) startAsync() {
+	asyncState.mu.Lock()
+	defer asyncState.mu.Unlock()
+	if asyncState.queue != nil {
+		return
+	}
+	size := *asyncQueueSize
+	if size < 1 {
+		size = 1
+	}
+	q, flushes, exited := make(chan asyncEntry, size), make(chan chan struct{}), make(chan struct{})
+	asyncState.queue, asyncState.flushes, asyncState.exited = q, flushes, exited
+	go func() {
+		for {
+			select {
+			case e, ok := <-q:
+				if !ok {
+					close(exited)
+					return
+				}
+				l.outputSync(e.s, e.buf, e.file, e.line, e.alsoToStderr)
+			case done := <-flushes:
+				// Write no more than the lines queued by now, so that
+				// a steady flow of new lines cannot hold up the flush.
+			drain:
+				for n := len(q); n > 0; n-- {
+					select {
+					case e := <-q:
+						l.outputSync(e.s, e.buf, e.file, e.line, e.alsoToStderr)
+					default:
+						break drain // The rest were dropped by -log_async_drop_oldest.
+					}
+				}
+				close(done)
+			}
+		}
+	}()
+}
+
+// drainAsync waits for the asynchronous writer, if it is running, to write
+// the lines queued so far, and leaves it running. Lines may be queued
+// meanwhile. It must not be called by the writer itself, as from a hook.
+func drainAsync() {
+	asyncState.mu.RLock()
+	defer asyncState.mu.RUnlock()
+	if asyncState.queue == nil {
+		return
+	}
+	done := make(chan struct{})
+	asyncState.flushes <- done
+	<-done
+}
+
+// stopAsync waits for the asynchronous writer, if it is running, to write
+// the lines queued so far, and stops it, for Shutdown and FATAL lines. The
+// next queued line starts it again. It must not be called by the writer
+// itself, as from a hook.
+func stopAsync() {
+	asyncState.mu.Lock()
+	defer asyncState.mu.Unlock()
+	if asyncState.queue == nil {
+		return
+	}
+	close(asyncState.queue)
+	<-asyncState.exited
+	asyncState.queue, asyncState.flushes, asyncState.exited = nil, nil, nil
+}
@@ -0,0 +1,197 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAsync turns on -log_async with the given queue size and drop policy,
+// and returns a function that writes the queued lines and restores the flags.
+func useAsync(size int, dropOldest bool) func() {
+	stopAsync()
+	previousAsync, previousSize, previousDrop := *logAsync, *asyncQueueSize, *asyncDropOldest
+	*logAsync, *asyncQueueSize, *asyncDropOldest = true, size, dropOldest
+	return func() {
+		stopAsync()
+		*logAsync, *asyncQueueSize, *asyncDropOldest = previousAsync, previousSize, previousDrop
+	}
+}
+
+// Test that queued lines are written, in order, by the time Flush returns.
+func TestAsync(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useAsync(1024, false)()
+
+	for i := 0; i < 100; i++ {
+		Infof("line %d", i)
+	}
+	Warning("warned")
+	Flush()
+	for i := 0; i < 100; i++ {
+		if want := fmt.Sprintf("] line %d\n", i); !contains(infoLog, want, t) {
+			t.Fatalf("missing %q in %q", want, contents(infoLog))
+		}
+	}
+	if strings.Index(contents(infoLog), "] line 9\n") > strings.Index(contents(infoLog), "] line 10\n") {
+		t.Error("lines were written out of order")
+	}
+	if !contains(warningLog, "] warned\n", t) {
+		t.Errorf("missing warning in %q", contents(warningLog))
+	}
+}
+
+// blockingWriter blocks every Write until release is closed.
+type blockingWriter struct {
+	release chan struct{}
+	buf     flushBuffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+// Test that Flush leaves the writer running, and that lines can be queued
+// while it waits for the writer.
+func TestAsyncFlushKeepsWriter(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useAsync(1024, false)()
+	w := &blockingWriter{release: make(chan struct{})}
+	logging.swap([maxSeverity]flushSyncWriter{writerSink{w}})
+
+	Info("before flush")
+	asyncState.mu.RLock()
+	queue := asyncState.queue
+	asyncState.mu.RUnlock()
+	flushed := make(chan bool)
+	go func() {
+		Flush()
+		flushed <- true
+	}()
+	queued := make(chan bool)
+	go func() {
+		Info("during flush")
+		queued <- true
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queueing a line blocked while Flush waited for the writer")
+	}
+	close(w.release)
+	<-flushed
+	if !strings.Contains(w.buf.String(), "] before flush\n") {
+		t.Errorf("got %q after Flush, want the line queued before it", w.buf.String())
+	}
+	asyncState.mu.RLock()
+	defer asyncState.mu.RUnlock()
+	if asyncState.queue != queue {
+		t.Error("Flush restarted the writer")
+	}
+}
+
+// Test that a full queue drops the new or the oldest lines, and counts them.
+func TestAsyncDrop(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	for _, dropOldest := range []bool{false, true} {
+		restore := useAsync(2, dropOldest)
+		w := &blockingWriter{release: make(chan struct{})}
+		logging.swap([maxSeverity]flushSyncWriter{writerSink{w}})
+
+		dropped, overflows := AsyncDropped(), DropStats().AsyncOverflows
+		for i := 0; i < 10; i++ {
+			Infof("line %d", i)
+		}
+		if n := AsyncDropped() - dropped; n < 7 {
+			t.Errorf("dropOldest=%v: %d lines dropped, want at least 7", dropOldest, n)
+		}
+		if n := DropStats().AsyncOverflows - overflows; n < 7 {
+			t.Errorf("dropOldest=%v: DropStats counted %d overflows, want at least 7", dropOldest, n)
+		}
+		close(w.release)
+		restore()
+
+		got := w.buf.String()
+		kept, lost := "] line 0\n", "] line 9\n"
+		if dropOldest {
+			kept, lost = lost, "] line 5\n"
+		}
+		if !strings.Contains(got, kept) || strings.Contains(got, lost) {
+			t.Errorf("dropOldest=%v: got %q, want %q and not %q", dropOldest, got, kept, lost)
+		}
+	}
+}
+
+// Test that FATAL lines are written however full the queue is. The test
+// re-runs itself in a subprocess, which does the logging.
+func TestAsyncFatal(t *testing.T) {
+	if os.Getenv("GLOG_TEST_ASYNC_FATAL") == "1" {
+		for i := 0; i < 1000; i++ {
+			Infof("line %d", i)
+		}
+		Fatal("fatal line")
+		return
+	}
+	cmd := testSubprocess("TestAsyncFatal", "GLOG_TEST_ASYNC_FATAL=1", "-logtostderr", "-log_async", "-log_async_queue_size=1")
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("subprocess did not fail: %v\n%s", err, out)
+	}
+	if code := exitErr.ExitCode(); code != 255 {
+		t.Errorf("got exit code %d, want 255", code)
+	}
+	if !strings.Contains(string(out), "] fatal line\n") {
+		t.Errorf("output is missing the FATAL line:\n%s", out)
+	}
+}
+
+// slowWriter takes a while over every Write, as a busy disk would.
+type slowWriter struct{}
+
+func (slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(10 * time.Microsecond)
+	return len(p), nil
+}
+
+// BenchmarkOutputSlowWriter measures the time a caller spends logging to a
+// slow output, with and without -log_async.
+func BenchmarkOutputSlowWriter(b *testing.B) {
+	setFlags()
+	slow := writerSink{slowWriter{}}
+	defer logging.swap(logging.swap([maxSeverity]flushSyncWriter{slow, slow, slow, slow}))
+	for _, async := range []bool{false, true} {
+		b.Run(fmt.Sprintf("async=%v", async), func(b *testing.B) {
+			if async {
+				defer useAsync(1024, false)()
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Info("benchmark line")
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The AUDIT log, an append-only record written through to disk.
+
+package glog
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// auditTag is the tag of the AUDIT log files.
+const auditTag = "AUDIT"
+
+// auditChain is set by the -log_audit_chain flag.
+var auditChain = flag.Bool("log_audit_chain", false, "If true, end each AUDIT line with a hash chained from the previous line's, to make tampering evident")
+
+// auditFile is the AUDIT log file, opened by the first Audit, and
+// auditLink the chain hash of the last line written. logging.mu guards both.
+var (
+	auditFile *syncBuffer
+	auditLink [sha256.Size]byte
+)
+
+// Audit logs to the AUDIT log, prog.AUDIT, kept apart from the other logs.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if
+// missing. The line is in the file, and synced to disk, when Audit returns.
+// AUDIT files are rotated as the others are, but never compressed or
+// deleted. The line is written as it is, without filters or redaction, and
+// only to the AUDIT log.
+//
+// With -log_audit_chain, each line ends with chain=<hash>, in hex, or has a
+// "chain" field in -log_format=json mode: the SHA-256 of the previous line's
+// hash, as bytes, followed by the line as written but without the chain
+// field or its trailing newline. The first line of each run chains from a
+// hash of zeros. Editing, removing or reordering lines breaks the chain from
+// there on.
+func Audit(args ...interface{}) {
+	logging.printAudit(args...)
+}
+
+// printAudit formats and writes the line for Audit.
+func (l *loggingT) printAudit(args ...interface{}) {
+	buf, _, _ := l.headerFor(infoLog, true, 0)
+	fmt.Fprint(buf, args...)
+	buf.endLine()
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	data := buf.Bytes()
+	if *auditChain {
+		data = chainLine(data, l.format.get())
+	}
+	l.writeAudit(data)
+	l.putBuffer(buf)
+}
+
+// chainLine returns line, in the given -log_format, with its chain hash
+// added, and makes that the last link. logging.mu is held.
+func chainLine(line []byte, format logFormat) []byte {
+	h := sha256.New()
+	h.Write(auditLink[:])
+	switch format {
+	case framedFormat:
+		h.Write(line[4:])
+	default:
+		h.Write(line[:len(line)-1]) // Without the newline.
+	}
+	h.Sum(auditLink[:0])
+	link := hex.EncodeToString(auditLink[:])
+	var chained []byte
+	switch format {
+	case jsonFormat:
+		chained = append(chained, line[:len(line)-2]...) // Up to the closing brace.
+		chained = append(chained, `,"chain":"`+link+`"}`+"\n"...)
+	case framedFormat:
+		chained = append(chained, line[:len(line)-1]...)
+		chained = append(chained, `,"chain":"`+link+`"}`...)
+		binary.BigEndian.PutUint32(chained, uint32(len(chained)-4))
+	default:
+		chained = append(chained, line[:len(line)-1]...)
+		chained = append(chained, " chain="+link+"\n"...)
+	}
+	return chained
+}
+
+// writeAudit writes data to the AUDIT log file, opening it first if need
+// be, and syncs it. If that fails, data is written to standard error
+// instead. logging.mu is held.
+func (l *loggingT) writeAudit(data []byte) {
+	now := timeNow()
+	if auditFile == nil {
+		l.startFlushDaemon()
+		sb := &syncBuffer{logger: l, sev: infoLog, tag: auditTag}
+		if err := sb.rotateFile(now, openedStartup); err != nil {
+			sb.fail(now, err)
+		}
+		auditFile = sb
+	}
+	auditFile.Write(data)
+	if auditFile.failing {
+		return
+	}
+	err := auditFile.Flush()
+	if err == nil {
+		err = auditFile.Sync()
+	}
+	if err != nil {
+		auditFile.fail(now, err)
+		atomic.AddUint64(&fileErrors, 1)
+		os.Stderr.Write(data)
+	}
+}
+
+// closeAudit closes the AUDIT log file, so that the next line opens a new
+// one. logging.mu is held.
+func closeAudit() {
+	if auditFile != nil && auditFile.file != nil {
+		auditFile.file.Close() // ignore error
+	}
+	auditFile = nil
+}
+
+// reopenAudit is reopenFiles for the AUDIT log file. logging.mu is held.
+func reopenAudit(now time.Time, reason string) error {
+	if auditFile == nil {
+		return nil
+	}
+	if err := auditFile.rotateFile(now, reason); err != nil {
+		auditFile.fail(now, err)
+		return err
+	}
+	auditFile.failing = false
+	return nil
+}
@@ -0,0 +1,184 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useAuditFile starts a fresh AUDIT log, and returns a function that closes
+// it.
+func useAuditFile() func() {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	auditFile, auditLink = nil, [sha256.Size]byte{}
+	return func() {
+		logging.mu.Lock()
+		defer logging.mu.Unlock()
+		closeAudit()
+	}
+}
+
+// Test that each Audit line is in the AUDIT log file as soon as Audit
+// returns, and in no other log.
+func TestAudit(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer useAuditFile()()
+
+	for _, msg := range []string{"user bob logged in", "user bob deleted record 7"} {
+		Audit(msg)
+		data, err := ioutil.ReadFile(filepath.Join(dir, program+".AUDIT"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "] "+msg+"\n") {
+			t.Errorf("AUDIT log file does not have %q straight after Audit:\n%s", msg, data)
+		}
+	}
+	if got := remainingLogFiles(t, dir); len(got) != 2 { // The AUDIT file and its symlink.
+		t.Errorf("got files %q, want only the AUDIT log", got)
+	}
+}
+
+// Test that an Audit line under a header template without {sev} is written
+// as the template has it.
+func TestAuditHeaderTemplate(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer useAuditFile()()
+	defer SetHeaderTemplate(logHeader.String())
+	if err := SetHeaderTemplate("{msg}"); err != nil {
+		t.Fatal(err)
+	}
+
+	Audit("hello")
+	data, err := ioutil.ReadFile(filepath.Join(dir, program+".AUDIT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "\nhello\n") {
+		t.Errorf("AUDIT log file does not end with the line %q:\n%s", "hello", data)
+	}
+}
+
+// Test that pruning the other logs leaves the AUDIT files alone, and that
+// the AUDIT files themselves are never pruned.
+func TestAuditNotPruned(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer useAuditFile()()
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1 // Every line starts a new file.
+	defer func(previous int) { MaxFileCount = previous }(MaxFileCount)
+	MaxFileCount = 2
+
+	const lines = 5
+	for i := 0; i < lines; i++ {
+		Audit("audit ", i)
+		Info("info ", i)
+	}
+	var audit, info int
+	for _, name := range remainingLogFiles(t, dir) {
+		switch {
+		case strings.HasPrefix(name, logPrefix(auditTag)) && strings.HasSuffix(name, logSuffix):
+			audit++
+		case strings.HasPrefix(name, logPrefix("INFO")) && strings.HasSuffix(name, logSuffix):
+			info++
+		}
+	}
+	if audit != lines+1 { // The file opened at startup, then one per line.
+		t.Errorf("got %d AUDIT files, want %d", audit, lines+1)
+	}
+	if info != MaxFileCount {
+		t.Errorf("got %d INFO files, want %d after pruning", info, MaxFileCount)
+	}
+}
+
+// Test that -log_audit_chain chains each line's hash from the previous
+// line's, in text and JSON.
+func TestAuditChain(t *testing.T) {
+	setFlags()
+	defer func(previous bool) { *auditChain = previous }(*auditChain)
+	*auditChain = true
+	defer logging.format.set(logging.format.get())
+
+	for _, format := range []logFormat{textFormat, jsonFormat} {
+		dir, cleanup := tempLogDir(t)
+		restore := useLogDir(dir)
+		closeAuditFile := useAuditFile()
+		logging.format.set(format)
+		Audit("first")
+		Audit("second")
+		data, err := ioutil.ReadFile(filepath.Join(dir, program+".AUDIT"))
+		closeAuditFile()
+		restore()
+		cleanup()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var link [sha256.Size]byte
+		var n int
+		for _, line := range strings.Split(string(data), "\n") {
+			var unchained, chain string
+			switch {
+			case format == jsonFormat && strings.HasPrefix(line, "{"):
+				var entry struct{ Severity, Chain string }
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatalf("%q is not JSON: %v", line, err)
+				}
+				if entry.Severity != auditTag {
+					t.Errorf("got severity %q, want %q", entry.Severity, auditTag)
+				}
+				chain = entry.Chain
+				unchained = strings.Replace(line, `,"chain":"`+chain+`"`, "", 1)
+			case format == textFormat && strings.HasPrefix(line, "A"):
+				i := strings.LastIndex(line, " chain=")
+				if i < 0 {
+					t.Fatalf("no chain in %q", line)
+				}
+				unchained, chain = line[:i], line[i+len(" chain="):]
+			default:
+				continue // The banner.
+			}
+			h := sha256.New()
+			h.Write(link[:])
+			h.Write([]byte(unchained))
+			h.Sum(link[:0])
+			if want := hex.EncodeToString(link[:]); chain != want {
+				t.Errorf("%v: line %q has chain %s, want %s", format, line, chain, want)
+			}
+			n++
+		}
+		if n != 2 {
+			t.Errorf("%v: checked %d lines, want 2:\n%s", format, n, data)
+		}
+	}
+}
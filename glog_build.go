@@ -0,0 +1,68 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The version of the program, for log file banners.
+
+package glog
+
+import (
+	"flag"
+	"sync"
+)
+
+// jsonBuildInfo is set by the -log_json_build_info flag.
+var jsonBuildInfo = flag.Bool("log_json_build_info", false, "If true, JSON log lines include the version and commit of the program")
+
+// buildInfo is the version and commit set by SetBuildInfo, if any.
+var buildInfo struct {
+	mu              sync.Mutex
+	set             bool
+	version, commit string
+}
+
+// SetBuildInfo sets the version and commit of the program, such as a release
+// number and a VCS revision, written in the banner of each new log file and,
+// with -log_json_build_info, in each JSON line. Until it is called, or after
+// it is called with both empty, they are taken from the build information
+// embedded by the go command, if any: the version of the main module and the
+// vcs.revision setting.
+func SetBuildInfo(version, commit string) {
+	buildInfo.mu.Lock()
+	defer buildInfo.mu.Unlock()
+	buildInfo.set = version != "" || commit != ""
+	buildInfo.version, buildInfo.commit = version, commit
+}
+
+// embeddedBuild caches the build information embedded in the binary.
+var embeddedBuild struct {
+	once            sync.Once
+	version, commit string
+}
+
+// programBuild returns the version and commit set by SetBuildInfo, or else
+// those embedded in the binary. Either may be empty.
+func programBuild() (version, commit string) {
+	buildInfo.mu.Lock()
+	set, version, commit := buildInfo.set, buildInfo.version, buildInfo.commit
+	buildInfo.mu.Unlock()
+	if set {
+		return version, commit
+	}
+	embeddedBuild.once.Do(func() {
+		embeddedBuild.version, embeddedBuild.commit = readBuildInfo()
+	})
+	return embeddedBuild.version, embeddedBuild.commit
+}
@@ -0,0 +1,104 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Sampling of bursts of identical log lines.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// burstWindow is set by the -log_burst_window flag.
+var burstWindow = flag.Duration("log_burst_window", 0, "If non-zero, of a burst of identical lines from one source line within this long, log only the first, the last and a count of the rest; FATAL lines are never held back")
+
+// burstKey identifies the lines of a burst: those with the same message from
+// the same callsite.
+type burstKey struct {
+	callsite
+	msg string
+}
+
+// burst is the state of a burst of identical lines, from its first.
+type burst struct {
+	start        time.Time
+	sev          Severity
+	last         *buffer // The latest line held back, if any.
+	lastAt       time.Time
+	alsoToStderr bool
+	held         int // The number of lines held back since the first.
+}
+
+// bursts holds the burst open for each burstKey. It is protected by
+// logging.mu.
+var bursts = make(map[burstKey]*burst)
+
+// burstLine reports whether the line in buf, logged from file:line at now,
+// is to be written, as the first of a burst. If not, it keeps buf as the
+// latest of the burst, for endBurst to write. A burst open for longer than
+// -log_burst_window is ended first. l.mu is held.
+func (l *loggingT) burstLine(s Severity, buf *buffer, file string, line int, alsoToStderr bool, now time.Time) bool {
+	key := burstKey{callsite{file, line}, string(buf.Bytes()[buf.msg:])}
+	b := bursts[key]
+	if b != nil && now.Sub(b.start) >= *burstWindow {
+		l.endBurst(key, b)
+		b = nil
+	}
+	if b == nil {
+		bursts[key] = &burst{start: now}
+		return true
+	}
+	if b.last != nil {
+		l.putBuffer(b.last)
+	}
+	b.last, b.lastAt, b.sev, b.alsoToStderr = buf, now, s, alsoToStderr
+	b.held++
+	return false
+}
+
+// endBurst closes the burst b, writing its last line, and then, if other
+// lines were held back before that, the number of them. l.mu is held.
+func (l *loggingT) endBurst(key burstKey, b *burst) {
+	delete(bursts, key)
+	if b.last == nil {
+		return
+	}
+	buf := b.last
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.write(b.sev, key.file, key.line, buf.Bytes(), b.alsoToStderr)
+	l.putBuffer(buf)
+	if b.held > 1 {
+		buf = l.formatHeader(b.sev, key.file, key.line)
+		fmt.Fprintf(buf, "... and %d more, last at %s\n", b.held-1, l.logTime(b.lastAt).Format(time.RFC3339Nano))
+		if buf.json {
+			buf = l.formatJSON(buf)
+		}
+		l.write(b.sev, key.file, key.line, buf.Bytes(), b.alsoToStderr)
+		l.putBuffer(buf)
+	}
+}
+
+// endBursts closes every open burst, as when the logs are flushed. l.mu is
+// held.
+func (l *loggingT) endBursts() {
+	for key, b := range bursts {
+		l.endBurst(key, b)
+	}
+}
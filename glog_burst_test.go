@@ -0,0 +1,79 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that -log_burst_window writes only the first and the last of a burst
+// of identical lines, and a count of the rest, when the window closes or on
+// a flush.
+func TestBurstWindow(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous time.Duration) { *burstWindow = previous }(*burstWindow)
+	*burstWindow = time.Second
+	bursts = make(map[burstKey]*burst)
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	start := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	now := start
+	timeNow = func() time.Time { return now }
+
+	burstOf := func(n int) {
+		for i := 0; i < n; i++ {
+			Info("burst")
+			now = now.Add(time.Millisecond)
+		}
+	}
+	burstOf(10)
+	Info("other")
+	if got := strings.Count(contents(infoLog), "] burst\n"); got != 1 {
+		t.Fatalf("got %d lines of the open burst, want only the first: %q", got, contents(infoLog))
+	}
+	if !contains(infoLog, " 15:04:05.000000 ", t) {
+		t.Errorf("the first line of the burst is missing: %q", contents(infoLog))
+	}
+	if !contains(infoLog, "] other\n", t) {
+		t.Error("a line with another message was held back")
+	}
+
+	Flush()
+	last := start.Add(9 * time.Millisecond)
+	if !contains(infoLog, " 15:04:05.009000 ", t) {
+		t.Errorf("the last line of the burst is missing: %q", contents(infoLog))
+	}
+	if want := "] ... and 8 more, last at " + last.Format(time.RFC3339Nano) + "\n"; !contains(infoLog, want, t) {
+		t.Errorf("got %q, want a line %q", contents(infoLog), want)
+	}
+
+	// A burst that has outlasted the window ends with the next line, which
+	// begins another.
+	before := strings.Count(contents(infoLog), "] burst\n")
+	burstOf(3)
+	now = now.Add(time.Second)
+	burstOf(1)
+	out := contents(infoLog)
+	if got := strings.Count(out, "] burst\n") - before; got != 3 {
+		t.Errorf("got %d lines, want the first and last of a burst and the first of the next: %q", got, out)
+	}
+	if want := "] ... and 1 more, last at "; !strings.Contains(out, want) {
+		t.Errorf("got %q, want a line %q", out, want)
+	}
+}
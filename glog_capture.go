@@ -0,0 +1,89 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// In-memory capture of log lines, for tests.
+
+package glog
+
+import (
+	"strings"
+	"sync"
+)
+
+// Capture holds the log lines written while it is installed by
+// CaptureForTesting.
+type Capture struct {
+	mu    sync.Mutex
+	lines [maxSeverity][]string
+
+	previous [maxSeverity]flushSyncWriter
+	toStderr bool
+}
+
+// CaptureForTesting directs the logs of every severity to memory instead of
+// to files or standard error, as SetOutput does for an io.Writer, until
+// Restore is called. Log files already open are left open and are restored
+// along with the other previous outputs. It is meant for tests that check
+// what the code under test logged:
+//
+//	c := glog.CaptureForTesting()
+//	defer c.Restore()
+//	handle(req)
+//	for _, line := range c.Lines(glog.WarningLevel) { ... }
+func CaptureForTesting() *Capture {
+	c := new(Capture)
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	c.previous = logging.file
+	c.toStderr = logging.toStderr
+	logging.toStderr = false
+	for s := infoLog; s < numSeverities(); s++ {
+		logging.file[s] = writerSink{captureWriter{c, s}}
+	}
+	return c
+}
+
+// Lines returns the formatted lines, header included and trailing newline
+// removed, logged with severity sev since the Capture was installed.
+// A line holding a multi-line message, or a stack trace, is returned as one
+// string.
+func (c *Capture) Lines(sev Severity) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.lines[sev]...)
+}
+
+// Restore reinstalls the outputs that were in use when CaptureForTesting was
+// called. Lines already captured remain available.
+func (c *Capture) Restore() {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.file = c.previous
+	logging.toStderr = c.toStderr
+}
+
+// captureWriter records the log lines of one severity in a Capture.
+type captureWriter struct {
+	c   *Capture
+	sev Severity
+}
+
+func (w captureWriter) Write(p []byte) (int, error) {
+	w.c.mu.Lock()
+	w.c.lines[w.sev] = append(w.c.lines[w.sev], strings.TrimSuffix(string(p), "\n"))
+	w.c.mu.Unlock()
+	return len(p), nil
+}
@@ -0,0 +1,82 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that CaptureForTesting records the lines of each severity separately.
+func TestCaptureForTesting(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	c := CaptureForTesting()
+	Info("info line")
+	Warning("warning line")
+	Errorf("error %d", 3)
+	c.Restore()
+
+	for _, tc := range []struct {
+		sev  Severity
+		want string
+	}{
+		{InfoLevel, "info line"},
+		{WarningLevel, "warning line"},
+		{ErrorLevel, "error 3"},
+	} {
+		lines := c.Lines(tc.sev)
+		if len(lines) != 1 {
+			t.Errorf("severity %d: got %d lines, want 1: %q", tc.sev, len(lines), lines)
+			continue
+		}
+		if !strings.HasSuffix(lines[0], "] "+tc.want) {
+			t.Errorf("severity %d: got %q, want a line ending in %q", tc.sev, lines[0], tc.want)
+		}
+	}
+	if lines := c.Lines(FatalLevel); len(lines) != 0 {
+		t.Errorf("got fatal lines %q", lines)
+	}
+	if contains(infoLog, "info line", t) {
+		t.Error("captured line was also written to the previous output")
+	}
+}
+
+// Test that Restore reinstalls the previous outputs and -logtostderr setting.
+func TestCaptureRestore(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.toStderr = previous }(logging.toStderr)
+	logging.toStderr = true
+
+	c := CaptureForTesting()
+	Info("captured")
+	c.Restore()
+	if !logging.toStderr {
+		t.Error("Restore did not reinstate -logtostderr")
+	}
+	logging.toStderr = false
+	Info("not captured")
+
+	if lines := c.Lines(InfoLevel); len(lines) != 1 || !strings.HasSuffix(lines[0], "captured") {
+		t.Errorf("got captured lines %q", lines)
+	}
+	if !contains(infoLog, "not captured", t) {
+		t.Errorf("line after Restore went missing: %q", contents(infoLog))
+	}
+}
@@ -0,0 +1,54 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Stable error codes for log lines, and counts of them.
+
+package glog
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// codeCounts holds the number of lines logged with each code, as an *int64.
+var codeCounts sync.Map
+
+// ErrorCode logs to the ERROR, WARNING, and INFO logs, tagging the line with
+// code, a stable name for the kind of error such as "db_timeout", for
+// dashboards to group errors by however their messages change. The code is
+// written as code=... after the message, which is formatted in the manner
+// of fmt.Print, or as the "code" field in -log_format=json mode. CodeStats
+// counts the lines logged with each code.
+func ErrorCode(code string, args ...interface{}) {
+	n, ok := codeCounts.Load(code)
+	if !ok {
+		n, _ = codeCounts.LoadOrStore(code, new(int64))
+	}
+	atomic.AddInt64(n.(*int64), 1)
+	logging.printKV(errorLog, 0, fmt.Sprint(args...), "code", code)
+}
+
+// CodeStats returns the number of lines logged so far by ErrorCode with each
+// code.
+func CodeStats() map[string]int64 {
+	stats := make(map[string]int64)
+	codeCounts.Range(func(code, n interface{}) bool {
+		stats[code.(string)] = atomic.LoadInt64(n.(*int64))
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,61 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Test that ErrorCode tags the line with its code, in text and JSON, and
+// counts the lines of each code.
+func TestErrorCode(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	before := CodeStats()
+
+	ErrorCode("db_timeout", "query took ", 30, "s")
+	if want := "] query took 30s code=db_timeout\n"; !contains(errorLog, want, t) {
+		t.Errorf("got %q, want suffix %q", contents(errorLog), want)
+	}
+
+	logging.newBuffers()
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	ErrorCode("db_timeout", "again")
+	ErrorCode("disk_full", "no space")
+	lines := strings.Split(strings.TrimSuffix(contents(errorLog), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want two lines", contents(errorLog))
+	}
+	var entry struct{ Msg, Code string }
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", lines[0], err)
+	}
+	if entry.Msg != "again" || entry.Code != "db_timeout" {
+		t.Errorf("got msg %q and code %q, want again and db_timeout", entry.Msg, entry.Code)
+	}
+
+	stats := CodeStats()
+	if n := stats["db_timeout"] - before["db_timeout"]; n != 2 {
+		t.Errorf("counted %d db_timeout lines, want 2", n)
+	}
+	if n := stats["disk_full"] - before["disk_full"]; n != 1 {
+		t.Errorf("counted %d disk_full lines, want 1", n)
+	}
+}
@@ -0,0 +1,96 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Logging guarded by a condition.
+
+package glog
+
+// InfoIf is equivalent to Info, but logs only if cond is true. When cond is
+// false the arguments are not formatted, so no String or Error method is
+// called; they are still evaluated by the caller, as for any Go call, and
+// InfoIfFunc defers building them too.
+func InfoIf(cond bool, args ...interface{}) {
+	if cond {
+		logging.print(infoLog, args...)
+	}
+}
+
+// InfofIf is equivalent to Infof, but logs only if cond is true.
+// See InfoIf.
+func InfofIf(cond bool, format string, args ...interface{}) {
+	if cond {
+		logging.printf(infoLog, format, args...)
+	}
+}
+
+// InfoIfFunc is equivalent to Info with the arguments returned by args, but
+// logs, and calls args, only if cond is true. It is for arguments that are
+// costly to build:
+//
+//	glog.InfoIfFunc(debug, func() []interface{} { return []interface{}{"state ", dump(s)} })
+func InfoIfFunc(cond bool, args func() []interface{}) {
+	if cond {
+		logging.print(infoLog, args()...)
+	}
+}
+
+// WarningIf is equivalent to Warning, but logs only if cond is true.
+// See InfoIf.
+func WarningIf(cond bool, args ...interface{}) {
+	if cond {
+		logging.print(warningLog, args...)
+	}
+}
+
+// WarningfIf is equivalent to Warningf, but logs only if cond is true.
+// See InfoIf.
+func WarningfIf(cond bool, format string, args ...interface{}) {
+	if cond {
+		logging.printf(warningLog, format, args...)
+	}
+}
+
+// WarningIfFunc is equivalent to Warning with the arguments returned by
+// args, but logs, and calls args, only if cond is true. See InfoIfFunc.
+func WarningIfFunc(cond bool, args func() []interface{}) {
+	if cond {
+		logging.print(warningLog, args()...)
+	}
+}
+
+// ErrorIf is equivalent to Error, but logs only if cond is true.
+// See InfoIf.
+func ErrorIf(cond bool, args ...interface{}) {
+	if cond {
+		logging.print(errorLog, args...)
+	}
+}
+
+// ErrorfIf is equivalent to Errorf, but logs only if cond is true.
+// See InfoIf.
+func ErrorfIf(cond bool, format string, args ...interface{}) {
+	if cond {
+		logging.printf(errorLog, format, args...)
+	}
+}
+
+// ErrorIfFunc is equivalent to Error with the arguments returned by args,
+// but logs, and calls args, only if cond is true. See InfoIfFunc.
+func ErrorIfFunc(cond bool, args func() []interface{}) {
+	if cond {
+		logging.print(errorLog, args()...)
+	}
+}
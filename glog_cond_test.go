@@ -0,0 +1,103 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// countingStringer counts the calls to its String method.
+type countingStringer struct{ calls *int }
+
+func (c countingStringer) String() string {
+	*c.calls++
+	return "formatted"
+}
+
+// Test that the conditional functions neither log nor format their
+// arguments when the condition is false.
+func TestLogIfFalse(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	calls := 0
+	arg := countingStringer{&calls}
+	built := func() []interface{} {
+		calls++
+		return []interface{}{arg}
+	}
+
+	InfoIf(false, arg)
+	InfofIf(false, "%v", arg)
+	InfoIfFunc(false, built)
+	WarningIf(false, arg)
+	WarningfIf(false, "%v", arg)
+	WarningIfFunc(false, built)
+	ErrorIf(false, arg)
+	ErrorfIf(false, "%v", arg)
+	ErrorIfFunc(false, built)
+
+	if calls != 0 {
+		t.Errorf("arguments were formatted or built %d times", calls)
+	}
+	for _, s := range []Severity{infoLog, warningLog, errorLog} {
+		if got := contents(s); got != "" {
+			t.Errorf("%s log: got %q, want nothing", severityName[s], got)
+		}
+	}
+}
+
+// Test that the conditional functions log, naming their caller, when the
+// condition is true.
+func TestLogIfTrue(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.stderrThreshold.set(logging.stderrThreshold.get())
+	logging.stderrThreshold.set(fatalLog)
+	calls := 0
+	arg := countingStringer{&calls}
+	built := func() []interface{} { return []interface{}{arg} }
+
+	_, _, line, _ := runtime.Caller(0)
+	InfoIf(true, arg)
+	InfofIf(true, "%v", arg)
+	InfoIfFunc(true, built)
+	WarningIf(true, arg)
+	WarningfIf(true, "%v", arg)
+	WarningIfFunc(true, built)
+	ErrorIf(true, arg)
+	ErrorfIf(true, "%v", arg)
+	ErrorIfFunc(true, built)
+
+	for i, s := range []Severity{infoLog, warningLog, errorLog} {
+		lines := strings.SplitAfter(contents(s), "\n")
+		if len(lines) != 4 {
+			t.Errorf("%s log: got %q, want three lines", severityName[s], contents(s))
+			continue
+		}
+		for j, l := range lines[:3] {
+			if want := fmt.Sprintf("glog_cond_test.go:%d] formatted\n", line+1+3*i+j); !strings.HasSuffix(l, want) {
+				t.Errorf("%s line %d: got %q, want suffix %q", severityName[s], j, l, want)
+			}
+		}
+	}
+	if calls != 9 {
+		t.Errorf("arguments were formatted %d times, want 9", calls)
+	}
+}
@@ -0,0 +1,100 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Logging with fields taken from a context.Context.
+
+package glog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// contextField is a log field registered by RegisterContextField.
+type contextField struct {
+	key     string
+	extract func(context.Context) (string, bool)
+}
+
+// contextFields holds the fields registered by RegisterContextField.
+var contextFields struct {
+	mu     sync.RWMutex
+	fields []contextField
+}
+
+// RegisterContextField declares a field to be added to every line logged by
+// InfoContext, WarningContext and ErrorContext. For a line logged with ctx,
+// extractor is called with ctx; if it reports true, the line carries the
+// pair key=value, or the field key in -log_format=json mode. Fields appear in
+// the order they were registered. RegisterContextField is typically called
+// during initialization:
+//
+//	glog.RegisterContextField("request_id", func(ctx context.Context) (string, bool) {
+//		id, ok := ctx.Value(requestIDKey{}).(string)
+//		return id, ok
+//	})
+func RegisterContextField(key string, extractor func(context.Context) (string, bool)) {
+	contextFields.mu.Lock()
+	defer contextFields.mu.Unlock()
+	contextFields.fields = append(contextFields.fields, contextField{key, extractor})
+}
+
+// contextKV returns the key/value pairs of the registered fields that ctx
+// holds.
+func contextKV(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	contextFields.mu.RLock()
+	defer contextFields.mu.RUnlock()
+	var kv []interface{}
+	for _, f := range contextFields.fields {
+		if v, ok := f.extract(ctx); ok {
+			kv = append(kv, f.key, v)
+		}
+	}
+	return kv
+}
+
+// printContext logs args, handled in the manner of fmt.Print, with the
+// fields that ctx holds.
+func (l *loggingT) printContext(s Severity, ctx context.Context, args ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprint(args...), "\n")
+	l.printKV(s, 1, msg, contextKV(ctx)...)
+}
+
+// InfoContext logs to the INFO log, followed by the fields registered with
+// RegisterContextField that ctx holds.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func InfoContext(ctx context.Context, args ...interface{}) {
+	logging.printContext(infoLog, ctx, args...)
+}
+
+// WarningContext logs to the WARNING log, followed by the fields registered
+// with RegisterContextField that ctx holds.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func WarningContext(ctx context.Context, args ...interface{}) {
+	logging.printContext(warningLog, ctx, args...)
+}
+
+// ErrorContext logs to the ERROR log, followed by the fields registered
+// with RegisterContextField that ctx holds.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func ErrorContext(ctx context.Context, args ...interface{}) {
+	logging.printContext(errorLog, ctx, args...)
+}
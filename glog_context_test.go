@@ -0,0 +1,94 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type requestIDKey struct{}
+
+// useRequestIDField registers a request_id context field and returns a
+// function that unregisters it.
+func useRequestIDField() func() {
+	contextFields.mu.Lock()
+	previous := contextFields.fields
+	contextFields.mu.Unlock()
+	RegisterContextField("request_id", func(ctx context.Context) (string, bool) {
+		id, ok := ctx.Value(requestIDKey{}).(string)
+		return id, ok
+	})
+	return func() {
+		contextFields.mu.Lock()
+		contextFields.fields = previous
+		contextFields.mu.Unlock()
+	}
+}
+
+// Test that InfoContext adds the registered fields the context holds, and
+// reports the caller's location.
+func TestInfoContext(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useRequestIDField()()
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc123")
+	WarningContext(ctx, "handled ", 3, " items")
+	if want := "] handled 3 items request_id=abc123\n"; !strings.HasSuffix(contents(warningLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(warningLog), want)
+	}
+	if !contains(warningLog, "glog_context_test.go:", t) {
+		t.Errorf("got %q, want the caller's file", contents(warningLog))
+	}
+}
+
+// Test that nothing is added when the context lacks the value.
+func TestInfoContextMissingField(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useRequestIDField()()
+
+	InfoContext(context.Background(), "no request")
+	ErrorContext(nil, "no context")
+	if want := "] no request\n"; !strings.HasSuffix(contents(infoLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(infoLog), want)
+	}
+	if want := "] no context\n"; !strings.HasSuffix(contents(errorLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(errorLog), want)
+	}
+}
+
+// Test that context fields become JSON fields in -log_format=json mode.
+func TestInfoContextJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	defer useRequestIDField()()
+
+	InfoContext(context.WithValue(context.Background(), requestIDKey{}, "abc123"), "done")
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(infoLog), err)
+	}
+	if entry["msg"] != "done" || entry["request_id"] != "abc123" {
+		t.Errorf("got %v, want msg done and request_id abc123", entry)
+	}
+}
@@ -0,0 +1,90 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Folding of identical consecutive log lines.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// dedupWindow is set by the -log_dedup_window flag.
+var dedupWindow = flag.Duration("log_dedup_window", 0, "If non-zero, a line of a severity with the same message as the last is dropped, if within this long of it, and counted in a \"last message repeated N times\" line; FATAL lines are never dropped")
+
+// dedupState is the last line written at a severity, and how many times its
+// message has been repeated since.
+type dedupState struct {
+	msg     string
+	at      time.Time
+	file    string
+	line    int
+	repeats int
+}
+
+// dedups holds the dedupState of each severity. It is protected by
+// logging.mu.
+var dedups [maxSeverity]dedupState
+
+// dedupLine reports whether the line in buf, logged at severity s from
+// file:line at now, is to be written: whether its message differs from that
+// of the last line written at s, or came after -log_dedup_window. Before a
+// line that is written, it reports the repeats of the last. l.mu is held.
+func (l *loggingT) dedupLine(s Severity, buf *buffer, file string, line int, now time.Time) bool {
+	d := &dedups[s]
+	msg := string(buf.Bytes()[buf.msg:])
+	if len(buf.kv) > 0 {
+		msg += fmt.Sprint(buf.kv...) // The fields of a JSON line count too.
+	}
+	if msg == d.msg && now.Sub(d.at) < *dedupWindow {
+		d.repeats++
+		return false
+	}
+	l.endRepeats(s)
+	*d = dedupState{msg: msg, at: now, file: file, line: line}
+	return true
+}
+
+// endRepeats writes the line reporting how many times the last message of
+// severity s was repeated, if it was. l.mu is held.
+func (l *loggingT) endRepeats(s Severity) {
+	d := &dedups[s]
+	if d.repeats == 0 {
+		return
+	}
+	buf := l.formatHeader(s, d.file, d.line)
+	if d.repeats == 1 {
+		buf.WriteString("last message repeated 1 time\n")
+	} else {
+		fmt.Fprintf(buf, "last message repeated %d times\n", d.repeats)
+	}
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.write(s, d.file, d.line, buf.Bytes(), false)
+	l.putBuffer(buf)
+	d.repeats = 0
+}
+
+// endAllRepeats reports the repeats of the last message of every severity,
+// as when the logs are flushed. l.mu is held.
+func (l *loggingT) endAllRepeats() {
+	for s := range dedups {
+		l.endRepeats(Severity(s))
+	}
+}
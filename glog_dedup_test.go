@@ -0,0 +1,75 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// messages returns the messages of the text log lines in the log of s.
+func messages(s Severity) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSuffix(contents(s), "\n"), "\n") {
+		if i := strings.Index(line, "] "); i >= 0 {
+			msgs = append(msgs, line[i+2:])
+		}
+	}
+	return msgs
+}
+
+// Test that -log_dedup_window folds a run of lines with the same message
+// into the first and a count of the rest, written before the next line with
+// another message, or on a flush.
+func TestDedupWindow(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous time.Duration) { *dedupWindow = previous }(*dedupWindow)
+	*dedupWindow = time.Minute
+	dedups = [maxSeverity]dedupState{}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	for _, msg := range []string{"A", "A", "A", "B"} {
+		Info(msg)
+	}
+	want := []string{"A", "last message repeated 2 times", "B"}
+	if got := messages(infoLog); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	Warning("C")
+	Warning("C")
+	Info("B") // Another severity's repeats are its own.
+	Flush()
+	if got, want := messages(warningLog), []string{"C", "last message repeated 1 time"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WARNING log: got %q, want %q", got, want)
+	}
+	if got, want := messages(infoLog), []string{"A", "last message repeated 2 times", "B", "last message repeated 1 time"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("INFO log: got %q, want %q", got, want)
+	}
+
+	// After the window, the same message is written again.
+	now = now.Add(time.Minute)
+	Warning("C")
+	if got, want := messages(warningLog), []string{"C", "last message repeated 1 time", "C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("WARNING log after the window: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Counts of the log lines lost at each output.
+
+package glog
+
+import "sync/atomic"
+
+// DropCounters counts the log lines that did not reach one of the outputs,
+// by the cause. It is returned by DropStats.
+type DropCounters struct {
+	FileErrors     uint64 // Lines not written to their log file, for an error creating or writing it; they went to standard error.
+	AsyncOverflows uint64 // Lines dropped by a full -log_async queue, as counted by AsyncDropped.
+	NetworkDrops   uint64 // Lines the network collector could not keep up with, as counted by NetworkDropped.
+	RateLimited    uint64 // Lines suppressed by -log_rate_limit.
+}
+
+// fileErrors and rateLimited count the lines for DropCounters.FileErrors and
+// DropCounters.RateLimited.
+var fileErrors, rateLimited uint64
+
+// DropStats returns the number of log lines lost so far at each output.
+// The counters are kept without locks, so the totals may be a moment apart
+// from one another.
+func DropStats() DropCounters {
+	return DropCounters{
+		FileErrors:     atomic.LoadUint64(&fileErrors),
+		AsyncOverflows: atomic.LoadUint64(&asyncDropped),
+		NetworkDrops:   atomic.LoadUint64(&netDropped),
+		RateLimited:    atomic.LoadUint64(&rateLimited),
+	}
+}
@@ -0,0 +1,86 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+// Sending log lines to the Windows Event Log.
+
+package glog
+
+import (
+	"sync"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// eventLogID is the event ID of every event written by SetEventLogOutput.
+const eventLogID = 1
+
+// eventLogWriter is the event log opened by SetEventLogOutput, if any.
+var eventLogWriter struct {
+	mu sync.Mutex
+	l  *eventlog.Log
+}
+
+// SetEventLogOutput directs the logs of every severity to the Windows Event
+// Log instead of to files, as SetOutput does for an io.Writer. source names
+// the event source, which is registered in the Application log if it does
+// not exist yet; registering a source needs administrative rights. INFO and
+// WARNING lines are written as information and warning events, and ERROR and
+// FATAL lines as error events, the latter before the process exits. Each
+// message keeps the glog header, with its own time and file:line.
+func SetEventLogOutput(source string) error {
+	// Installing fails if the source exists already; Open reports any other
+	// problem.
+	eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+	l, err := eventlog.Open(source)
+	if err != nil {
+		return err
+	}
+	for s := numSeverities() - 1; s >= infoLog; s-- {
+		SetOutputBySeverity(s, eventLogSink{l, s})
+	}
+	eventLogWriter.mu.Lock()
+	previous := eventLogWriter.l
+	eventLogWriter.l = l
+	eventLogWriter.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// eventLogSink writes the log lines of one severity to the event log.
+type eventLogSink struct {
+	l   *eventlog.Log
+	sev Severity
+}
+
+func (s eventLogSink) Write(p []byte) (int, error) {
+	var err error
+	switch msg := string(p); s.sev.base() {
+	case fatalLog, errorLog:
+		err = s.l.Error(eventLogID, msg)
+	case warningLog:
+		err = s.l.Warning(eventLogID, msg)
+	default:
+		err = s.l.Info(eventLogID, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,61 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package glog
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Test that SetEventLogOutput writes events that can be read back.
+func TestEventLogOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	const source = "glogtest"
+	if err := SetEventLogOutput(source); err != nil {
+		t.Skipf("cannot open the event log, which may need administrative rights: %v", err)
+	}
+	defer func() {
+		eventLogWriter.mu.Lock()
+		eventLogWriter.l.Close()
+		eventLogWriter.l = nil
+		eventLogWriter.mu.Unlock()
+		eventlog.Remove(source)
+	}()
+
+	msg := fmt.Sprintf("event log test %d", time.Now().UnixNano())
+	Warning(msg)
+
+	query := fmt.Sprintf("*[System[Provider[@Name='%s']]]", source)
+	out, err := exec.Command("wevtutil", "qe", "Application", "/q:"+query, "/c:5", "/rd:true", "/f:text").CombinedOutput()
+	if err != nil {
+		t.Fatalf("wevtutil: %v: %s", err, out)
+	}
+	if !strings.Contains(string(out), msg) {
+		t.Errorf("event %q not found in:\n%s", msg, out)
+	}
+	if !strings.Contains(string(out), "Warning") {
+		t.Errorf("event is not a warning:\n%s", out)
+	}
+}
@@ -19,22 +19,36 @@
 package glog
 
 import (
+	"compress/gzip"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
 // MaxSize is the maximum size of a log file in bytes.
+// It is set by the -log_max_size flag.
 var MaxSize uint64 = 1024 * 1024 * 16
+
+// MaxFileCount is the maximum number of log files kept in a log directory.
+// It is set by the -log_max_files flag; zero disables deletion entirely.
 var MaxFileCount int = 4
 
+// MaxTotalSize is the maximum total size in bytes of the log files kept in a
+// log directory. It is set by the -log_max_total_size flag; zero, the default,
+// means no limit.
+var MaxTotalSize uint64
+
 // logDirs lists the candidate directories for new log files.
 var logDirs []string
 
@@ -42,9 +56,150 @@ var logDirs []string
 // See createLogDirs for the full list of possible destinations.
 var logDir = flag.String("log_dir", "", "If non-empty, write log files in this directory")
 
+// logDirStrict is set by the -log_dir_strict flag.
+var logDirStrict = flag.Bool("log_dir_strict", false, "If true, never fall back from -log_dir or -log_dir_<severity> to the temporary directory; log to standard error if no log file can be created")
+
+func init() {
+	flag.Var((*byteSize)(&MaxSize), "log_max_size", "maximum size of a log file before it is rotated, with an optional KB, MB or GB suffix")
+	flag.Var((*byteSize)(&bufferSize), "log_buffer_size", "size of the buffer of each log file, with an optional KB, MB or GB suffix")
+	flag.IntVar(&MaxFileCount, "log_max_files", MaxFileCount, "maximum number of log files to keep; 0 disables deletion")
+	flag.Var((*byteLimit)(&MaxTotalSize), "log_max_total_size", "maximum total size of the log files kept in a directory, with an optional KB, MB or GB suffix")
+	flag.Var(logFilePattern, "log_file_pattern", "template for log file names, using {program}, {tag}, {host}, {pid}, {time:layout}, {utctime:layout} and {unixtime}")
+	flag.Var(new(nameStyle), "log_name_style", "style of log file names, setting -log_file_pattern: bracket, unix or rfc3339")
+	flag.Var(&logFileMode, "log_file_mode", "permission bits, in octal, of the log files glog creates")
+	flag.Var(&logDirMode, "log_dir_mode", "permission bits, in octal, of the log directories glog creates")
+}
+
+// logFileMode and logDirMode are set by the -log_file_mode and -log_dir_mode
+// flags. Both are subject to the process umask.
+var (
+	logFileMode fileMode = 0644
+	logDirMode  fileMode = 0755
+)
+
+// fileMode is a set of permission bits. It implements the flag.Value
+// interface and is written in octal, as in -log_file_mode=0600.
+type fileMode os.FileMode
+
+// String is part of the flag.Value interface.
+func (m *fileMode) String() string {
+	return fmt.Sprintf("%#o", uint32(*m))
+}
+
+// Get is part of the flag.Getter interface.
+func (m *fileMode) Get() interface{} {
+	return os.FileMode(*m)
+}
+
+// Syntax: -log_file_mode=0600
+func (m *fileMode) Set(value string) error {
+	v, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || v&^uint64(os.ModePerm) != 0 {
+		return fmt.Errorf("syntax error: expect octal permission bits such as 0600, got %q", value)
+	}
+	*m = fileMode(v)
+	return nil
+}
+
+// byteSize is a size in bytes. It implements the flag.Value interface and
+// accepts an optional KB, MB or GB suffix, as in -log_max_size=64MB.
+type byteSize uint64
+
+var byteSizeSuffixes = []struct {
+	suffix string
+	scale  uint64
+}{
+	{"GB", 1024 * 1024 * 1024},
+	{"MB", 1024 * 1024},
+	{"KB", 1024},
+	{"B", 1},
+}
+
+// String is part of the flag.Value interface.
+func (b *byteSize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+// Get is part of the flag.Getter interface.
+func (b *byteSize) Get() interface{} {
+	return uint64(*b)
+}
+
+// Syntax: -log_max_size=1048576 or -log_max_size=64MB
+func (b *byteSize) Set(value string) error {
+	v, err := parseByteSize(value, false)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(v)
+	return nil
+}
+
+// byteLimit is a byteSize that may be zero, for no limit, as in
+// -log_max_total_size=0.
+type byteLimit uint64
+
+// String is part of the flag.Value interface.
+func (b *byteLimit) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+// Get is part of the flag.Getter interface.
+func (b *byteLimit) Get() interface{} {
+	return uint64(*b)
+}
+
+// Syntax: -log_max_total_size=0 or -log_max_total_size=1GB
+func (b *byteLimit) Set(value string) error {
+	v, err := parseByteSize(value, true)
+	if err != nil {
+		return err
+	}
+	*b = byteLimit(v)
+	return nil
+}
+
+// parseByteSize parses a positive size in bytes with an optional suffix, or
+// zero as well if allowZero is set.
+func parseByteSize(value string, allowZero bool) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	scale := uint64(1)
+	for _, u := range byteSizeSuffixes {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("syntax error: expect a size such as 64MB, got %q", value)
+	}
+	if n < 0 || n == 0 && !allowZero {
+		return 0, fmt.Errorf("size must be positive, got %q", value)
+	}
+	if uint64(n) > math.MaxUint64/scale {
+		return 0, fmt.Errorf("size too large: %q", value)
+	}
+	return uint64(n) * scale, nil
+}
+
+// severityLogDir holds the -log_dir_info, -log_dir_warning, -log_dir_error
+// and -log_dir_fatal flags, by severity name.
+var severityLogDir = make(map[string]*string)
+
+func init() {
+	for _, name := range severityName {
+		severityLogDir[name] = flag.String("log_dir_"+strings.ToLower(name), "", "If non-empty, write "+name+" log files in this directory instead of -log_dir")
+	}
+}
+
 func createLogDirs() {
 	if *logDir != "" {
 		logDirs = append(logDirs, *logDir)
+		if *logDirStrict {
+			return
+		}
 	}
 	logDirs = append(logDirs, os.TempDir())
 }
@@ -81,40 +236,399 @@ func shortHostname(hostname string) string {
 }
 
 // logName returns a new log file name containing tag, with start time t, and
-// the name for the symlink for tag.
+// the name for the symlink for tag. The name follows -log_file_pattern.
 func logName(tag string, t time.Time) (name, link string) {
-	name = fmt.Sprintf("%s[%04d-%02d-%02d %02d-%02d-%02d].log",
-		program[:len(program)-len(filepath.Ext(program))],
-		t.Year(),
-		t.Month(),
-		t.Day(),
-		t.Hour(),
-		t.Minute(),
-		t.Second())
-	return name, program + "." + tag
+	return logFilePattern.render(tag, logging.logTime(t)), program + "." + tag
+}
+
+// ParseLogName returns the program name, tag and start time in name, the name
+// of a log file produced by logName from the -log_file_pattern, such as
+// "prog[2023-01-02 03-04-05].log" for the default pattern. The name of a
+// compressed file, or one with a number added to make it unique, is accepted
+// too. The program name is without its extension; the tag is empty if the
+// pattern has no {tag}, and t is zero if it has no placeholder for the time.
+func ParseLogName(name string) (program, tag string, t time.Time, err error) {
+	fields, err := logFilePattern.parse(name)
+	return fields.program, fields.tag, fields.start, err
 }
 
+// logPrefix returns the leading part of the names of the log files for tag
+// that is the same for every file, by which deleteOldLogFile finds them.
 func logPrefix(tag string) string {
-	return program[:len(program)-len(filepath.Ext(program))]
+	return logFilePattern.prefix(tag)
+}
+
+// defaultFilePattern is the default -log_file_pattern.
+const defaultFilePattern = "{program}[{time:2006-01-02 15-04-05}]" + logSuffix
+
+// logFilePattern is set by the -log_file_pattern flag.
+var logFilePattern = mustParseFilePattern(defaultFilePattern)
+
+// nameStylePatterns are the values of -log_file_pattern that the
+// -log_name_style flag chooses between.
+var nameStylePatterns = []struct{ style, pattern string }{
+	{"bracket", defaultFilePattern},
+	{"unix", "{program}.{unixtime}" + logSuffix},
+	{"rfc3339", "{program}.{utctime:2006-01-02T15-04-05Z}" + logSuffix},
+}
+
+// nameStyle is the value of the -log_name_style flag. It implements the
+// flag.Value interface by setting logFilePattern.
+type nameStyle string
+
+// String is part of the flag.Value interface.
+func (s *nameStyle) String() string {
+	if s == nil || *s == "" {
+		return nameStylePatterns[0].style
+	}
+	return string(*s)
+}
+
+// Get is part of the flag.Getter interface.
+func (s *nameStyle) Get() interface{} {
+	return s.String()
+}
+
+// Syntax: -log_name_style=bracket, -log_name_style=unix or -log_name_style=rfc3339
+func (s *nameStyle) Set(value string) error {
+	var names []string
+	for _, p := range nameStylePatterns {
+		if strings.EqualFold(p.style, value) {
+			*s = nameStyle(p.style)
+			return logFilePattern.Set(p.pattern)
+		}
+		names = append(names, p.style)
+	}
+	return fmt.Errorf("unknown log name style %q: expect one of %s", value, strings.Join(names, ", "))
+}
+
+// filePattern is a log file name template. It implements the flag.Value
+// interface; the -log_file_pattern flag is of type filePattern. The
+// placeholders {program}, {tag}, {host} and {pid} stand for the program name
+// without its extension, the severity, the short host name and the process ID,
+// and {time:layout} stands for the file's start time formatted as by
+// time.Time.Format. {utctime:layout} stands for the start time in UTC, and
+// {unixtime} for it in seconds since 1970. The tag of a shard of
+// InfoShard is INFO.<n>. In a pattern without {tag}, the FATAL and shard
+// tags follow the program name instead, to keep those files apart.
+type filePattern struct {
+	text  string
+	parts []patternPart
+}
+
+// patternPart is a literal or a placeholder in a filePattern.
+type patternPart struct {
+	kind string // "" for literal text, otherwise the placeholder name.
+	text string // The literal text, or the layout of a {time:layout} or {utctime:layout}.
+}
+
+// String is part of the flag.Value interface.
+func (p *filePattern) String() string {
+	return p.text
+}
+
+// Get is part of the flag.Getter interface.
+func (p *filePattern) Get() interface{} {
+	return p.text
+}
+
+// Syntax: -log_file_pattern={host}-{program}.{tag}.{time:20060102-150405}.log
+func (p *filePattern) Set(value string) error {
+	parsed, err := parseFilePattern(value)
+	if err != nil {
+		return err
+	}
+	*p = *parsed
+	return nil
+}
+
+// parseFilePattern parses and validates a log file name template.
+func parseFilePattern(text string) (*filePattern, error) {
+	p := &filePattern{text: text}
+	for rest := text; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("log file pattern %q: unmatched '}'", text)
+		}
+		if open < 0 {
+			p.parts = append(p.parts, patternPart{text: rest})
+			break
+		}
+		if open > 0 {
+			p.parts = append(p.parts, patternPart{text: rest[:open]})
+		}
+		rest = rest[open+1:]
+		close := strings.IndexByte(rest, '}')
+		if close < 0 {
+			return nil, fmt.Errorf("log file pattern %q: unmatched '{'", text)
+		}
+		name := rest[:close]
+		rest = rest[close+1:]
+		switch {
+		case name == "program" || name == "tag" || name == "host" || name == "pid" || name == "unixtime":
+			p.parts = append(p.parts, patternPart{kind: name})
+		case strings.HasPrefix(name, "time:") && len(name) > len("time:"):
+			p.parts = append(p.parts, patternPart{kind: "time", text: name[len("time:"):]})
+		case strings.HasPrefix(name, "utctime:") && len(name) > len("utctime:"):
+			p.parts = append(p.parts, patternPart{kind: "utctime", text: name[len("utctime:"):]})
+		default:
+			return nil, fmt.Errorf("log file pattern %q: unknown placeholder {%s}", text, name)
+		}
+	}
+	name := p.render(severityName[infoLog], timeNow())
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return nil, fmt.Errorf("log file pattern %q: must produce a plain file name, got %q", text, name)
+	}
+	return p, nil
+}
+
+func mustParseFilePattern(text string) *filePattern {
+	p, err := parseFilePattern(text)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// render returns the file name for tag and start time t.
+func (p *filePattern) render(tag string, t time.Time) string {
+	var b strings.Builder
+	for _, part := range p.parts {
+		p.renderPart(&b, part, tag, t)
+	}
+	return b.String()
+}
+
+// prefix returns the rendering of the pattern up to its first placeholder
+// that differs between files, or between runs of the program.
+func (p *filePattern) prefix(tag string) string {
+	var b strings.Builder
+	for _, part := range p.parts {
+		if part.isTime() || part.kind == "pid" {
+			break
+		}
+		p.renderPart(&b, part, tag, time.Time{})
+	}
+	return b.String()
+}
+
+// suffix returns the literal text after the pattern's last placeholder.
+func (p *filePattern) suffix() string {
+	i := len(p.parts)
+	for i > 0 && p.parts[i-1].kind == "" {
+		i--
+	}
+	var b strings.Builder
+	for _, part := range p.parts[i:] {
+		b.WriteString(part.text)
+	}
+	return b.String()
+}
+
+// separateTag reports whether the names of the log files for tag carry it
+// even if the -log_file_pattern has no {tag}, after the program name: those
+// of the FATAL and AUDIT logs, which pruning treats apart, and of the shards
+// of InfoShard.
+func separateTag(tag string) bool {
+	return tag == severityName[fatalLog] || tag == auditTag || tag != tagSeverity(tag)
+}
+
+// hasTag reports whether the pattern has a {tag} placeholder.
+func (p *filePattern) hasTag() bool {
+	for _, part := range p.parts {
+		if part.kind == "tag" {
+			return true
+		}
+	}
+	return false
+}
+
+// isTime reports whether part is a placeholder for the start time.
+func (part patternPart) isTime() bool {
+	return part.kind == "time" || part.kind == "utctime" || part.kind == "unixtime"
+}
+
+// logNameFields holds the values parsed out of a log file name.
+type logNameFields struct {
+	program, tag, host string
+	pid                int
+	start              time.Time
+	n                  int // The number added by uniqueName, if any.
+}
+
+// parse returns the values of the placeholders in name, a log file name
+// rendered from p, possibly disambiguated by uniqueName and compressed.
+// Each placeholder is taken to run up to the literal text that follows it.
+func (p *filePattern) parse(name string) (logNameFields, error) {
+	name = strings.TrimSuffix(name, compressedSuffix)
+	suffix := p.suffix()
+	if base := strings.TrimSuffix(name, suffix); len(base) < len(name) {
+		if dot := strings.LastIndexByte(base, '.'); dot >= 0 {
+			if n, err := strconv.Atoi(base[dot+1:]); err == nil && n > 0 {
+				if fields, err := p.parseParts(base[:dot] + suffix); err == nil {
+					fields.n = n
+					return fields, nil
+				}
+			}
+		}
+	}
+	return p.parseParts(name)
+}
+
+func (p *filePattern) parseParts(name string) (logNameFields, error) {
+	var fields logNameFields
+	loc := logging.logLocation()
+	rest := name
+	for i, part := range p.parts {
+		if part.kind == "" {
+			if !strings.HasPrefix(rest, part.text) {
+				return fields, fmt.Errorf("log file name %q does not follow the pattern %q", name, p.text)
+			}
+			rest = rest[len(part.text):]
+			continue
+		}
+		end := len(rest)
+		if i+1 < len(p.parts) && p.parts[i+1].kind == "" {
+			end = strings.Index(rest, p.parts[i+1].text)
+		}
+		if end <= 0 {
+			return fields, fmt.Errorf("log file name %q does not follow the pattern %q", name, p.text)
+		}
+		value := rest[:end]
+		rest = rest[end:]
+		var err error
+		switch part.kind {
+		case "program":
+			fields.program = value
+		case "tag":
+			fields.tag = value
+		case "host":
+			fields.host = value
+		case "pid":
+			fields.pid, err = strconv.Atoi(value)
+		case "time":
+			fields.start, err = time.ParseInLocation(part.text, value, loc)
+		case "utctime":
+			fields.start, err = time.ParseInLocation(part.text, value, time.UTC)
+		case "unixtime":
+			var sec int64
+			if sec, err = strconv.ParseInt(value, 10, 64); err == nil {
+				fields.start = time.Unix(sec, 0).In(loc)
+			}
+		}
+		if err != nil {
+			return fields, fmt.Errorf("log file name %q: bad {%s}: %v", name, part.kind, err)
+		}
+	}
+	if rest != "" {
+		return fields, fmt.Errorf("log file name %q does not follow the pattern %q", name, p.text)
+	}
+	return fields, nil
+}
+
+func (p *filePattern) renderPart(b *strings.Builder, part patternPart, tag string, t time.Time) {
+	switch part.kind {
+	case "":
+		b.WriteString(part.text)
+	case "program":
+		b.WriteString(program[:len(program)-len(filepath.Ext(program))])
+		if separateTag(tag) && !p.hasTag() {
+			// Keep these files apart from the others, so that
+			// they are pruned on their own.
+			b.WriteString("." + tag)
+		}
+	case "tag":
+		b.WriteString(tag)
+	case "host":
+		b.WriteString(host)
+	case "pid":
+		b.WriteString(strconv.Itoa(pid))
+	case "time":
+		b.WriteString(t.Format(part.text))
+	case "utctime":
+		b.WriteString(t.UTC().Format(part.text))
+	case "unixtime":
+		b.WriteString(strconv.FormatInt(t.Unix(), 10))
+	}
 }
 
 var onceLogDirs sync.Once
 
+// openedLogDir is the reason for opening a log file on SetLogDir.
+const openedLogDir = "new log directory"
+
+// SetLogDir sets -log_dir to dir, creating it if need be, and moves logging
+// there: the open log files are flushed and closed, and new ones opened in
+// dir, as are the files of severities first logged later. It may be called
+// at any time, such as once configuration loaded after the first lines have
+// been logged names the directory. As at startup, the temporary directory
+// remains the fallback, unless -log_dir_strict is set; the -log_dir_<severity>
+// flags still take precedence. If dir cannot be created, nothing changes
+// and the error is returned.
+func SetLogDir(dir string) error {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if err := os.MkdirAll(dir, os.FileMode(logDirMode)); err != nil {
+		return err
+	}
+	onceLogDirs.Do(func() {}) // Keep createLogDirs from running later.
+	*logDir = dir
+	logDirs = nil
+	createLogDirs()
+	return logging.reopenFiles(openedLogDir)
+}
+
+// logDirsFor returns the candidate directories for the log files for tag:
+// the -log_dir_<severity> directory of its severity, if set, before the usual
+// logDirs, or alone with -log_dir_strict.
+func logDirsFor(tag string) []string {
+	if dir := severityLogDir[tagSeverity(tag)]; dir != nil && *dir != "" {
+		if *logDirStrict {
+			return []string{*dir}
+		}
+		return append([]string{*dir}, logDirs...)
+	}
+	return logDirs
+}
+
+// isConfiguredLogDir reports whether dir was named by -log_dir or by the
+// -log_dir_<tag> flag for tag.
+func isConfiguredLogDir(dir, tag string) bool {
+	if dir == *logDir {
+		return true
+	}
+	d := severityLogDir[tagSeverity(tag)]
+	return d != nil && dir == *d
+}
+
 // create creates a new log file and returns the file and its filename, which
-// contains tag ("INFO", "FATAL", etc.) and t.  If the file is created
-// successfully, create also attempts to update the symlink for that tag, ignoring
-// errors.
+// contains tag ("INFO", "FATAL", etc.) and t.  The file is put in the
+// -log_dir_<tag> directory, if set, and otherwise in -log_dir; a directory
+// named by either that does not exist yet is created. If the file is created
+// successfully, create also attempts to update the symlink for that tag, in the
+// same directory, ignoring errors.
 func create(tag string, t time.Time) (f *os.File, filename string, err error) {
 	onceLogDirs.Do(createLogDirs)
 	if len(logDirs) == 0 {
 		return nil, "", errors.New("log: no log dirs")
 	}
-	name, _ := logName(tag, t)
+	name, link := logName(tag, t)
+	// Every crash is worth keeping, so FATAL files are never appended to.
+	reuse := *logAppend && tag != severityName[fatalLog]
 	var lastErr error
-	for _, dir := range logDirs {
-		fname := filepath.Join(dir, name)
-		f, err := os.Create(fname)
+	for _, dir := range logDirsFor(tag) {
+		f, fname, err := createUnique(dir, name, reuse)
+		if os.IsNotExist(err) && isConfiguredLogDir(dir, tag) {
+			// Create a missing -log_dir rather than falling back to the
+			// temporary directory.
+			if err = os.MkdirAll(dir, os.FileMode(logDirMode)); err == nil {
+				f, fname, err = createUnique(dir, name, reuse)
+			}
+		}
 		if err == nil {
+			symlink := filepath.Join(dir, link)
+			os.Remove(symlink)                        // ignore err
+			os.Symlink(filepath.Base(fname), symlink) // ignore err
 			return f, fname, nil
 		}
 		lastErr = err
@@ -122,56 +636,368 @@ func create(tag string, t time.Time) (f *os.File, filename string, err error) {
 	return nil, "", fmt.Errorf("log: cannot create log: %v", lastErr)
 }
 
-func deleteOldLogFile(tag string, maxFileCount int) (count int, err error) {
-	onceLogDirs.Do(createLogDirs)
-	if len(logDirs) == 0 {
-		return 0, errors.New("log: no log dirs")
+// fatalStackFile is set by the -log_fatal_stack_file flag.
+var fatalStackFile = flag.Bool("log_fatal_stack_file", false, "If true, Fatal writes its stack traces to a file of their own beside the FATAL log, and only a line naming that file to the logs")
+
+// writeStackFile writes trace, the stack traces dumped by Fatal at time t,
+// to a new file, prog.FATAL.stack.<time>.txt, in the directory of the FATAL
+// log file, and returns its name. It fails if the FATAL log is not a file.
+// l.mu is held.
+func (l *loggingT) writeStackFile(trace []byte, t time.Time) (string, error) {
+	sb, ok := l.file[fatalLog].(*syncBuffer)
+	if !ok || sb.file == nil {
+		return "", errors.New("log: no FATAL log file")
 	}
-	prefix := logPrefix(tag)
+	name := filepath.Join(filepath.Dir(sb.file.Name()), program+".FATAL.stack."+l.logTime(t).Format("20060102-150405")+".txt")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(logFileMode))
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(trace); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return name, err
+}
 
-	logFileCount := 0
-	var fileToDelete os.FileInfo
-	var foundDir = false
-	var logDir string
+// pidFile is set by the -log_pid_file flag.
+var pidFile = flag.Bool("log_pid_file", false, "If true, write the process ID to prog.pid beside the log files, and remove it on Shutdown")
 
-	for _, dir := range logDirs {
-		files, err := ioutil.ReadDir(dir)
-		if err != nil {
+// pidFileName is the name of the -log_pid_file written, or "". logging.mu
+// guards it.
+var pidFileName string
+
+// writePIDFile writes the -log_pid_file in the directory of sb's file, if
+// the flag is set and the file not yet written. A file left by an earlier
+// run is replaced in one step, by renaming a new one over it, so that
+// readers never see it empty. Errors go to standard error; logging goes on.
+// logging.mu is held.
+func writePIDFile(sb *syncBuffer) {
+	if !*pidFile || pidFileName != "" || sb.file == nil {
+		return
+	}
+	name := filepath.Join(filepath.Dir(sb.file.Name()), program+".pid")
+	tmp := name + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(pid)+"\n"), os.FileMode(logFileMode))
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp) // ignore err
+		fmt.Fprintf(os.Stderr, "log: cannot write pid file: %v\n", err)
+		return
+	}
+	pidFileName = name
+}
+
+// removePIDFile removes the -log_pid_file, unless another process has
+// written its own since. logging.mu is held.
+func removePIDFile() {
+	if pidFileName == "" {
+		return
+	}
+	if data, err := ioutil.ReadFile(pidFileName); err == nil && strings.TrimSpace(string(data)) == strconv.Itoa(pid) {
+		os.Remove(pidFileName) // ignore err
+	}
+	pidFileName = ""
+}
+
+// singleFile is set by the -log_single_file flag.
+var singleFile = flag.Bool("log_single_file", false, "If true, write the logs of all severities to one file, named as the INFO log")
+
+// logAppend is set by the -log_append flag.
+var logAppend = flag.Bool("log_append", false, "If true, append to an existing log file of the same name rather than starting a new one")
+
+// maxNameAttempts bounds the number of disambiguated names createUnique tries.
+const maxNameAttempts = 1000
+
+// createUnique creates the file name in dir, or if a log file of that name
+// (or its compressed copy) already exists, the first free name produced by
+// uniqueName, so that an existing log is never truncated. If reuse is set,
+// for -log_append, an existing file is reopened for appending instead, unless
+// it has already reached MaxSize.
+func createUnique(dir, name string, reuse bool) (*os.File, string, error) {
+	var err error
+	for n := 0; n < maxNameAttempts; n++ {
+		fname := filepath.Join(dir, uniqueName(name, n))
+		if _, err = os.Lstat(fname + compressedSuffix); err == nil {
 			continue
 		}
+		var f *os.File
+		if reuse {
+			f, err = os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, os.FileMode(logFileMode))
+			if err != nil {
+				return nil, "", err
+			}
+			if fi, serr := f.Stat(); serr == nil && uint64(fi.Size()) >= MaxSize {
+				f.Close()
+				continue
+			}
+			return f, fname, nil
+		}
+		f, err = os.OpenFile(fname, os.O_RDWR|os.O_CREATE|os.O_EXCL, os.FileMode(logFileMode))
+		if err == nil {
+			return f, fname, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", err
+		}
+	}
+	return nil, "", err
+}
 
-		if foundDir {
-			break
+// uniqueName returns name for n == 0, and otherwise name with ".n" inserted
+// before the -log_file_pattern suffix, so that the result is still recognized
+// as a log file.
+func uniqueName(name string, n int) string {
+	if n == 0 {
+		return name
+	}
+	suffix := logFilePattern.suffix()
+	if !strings.HasSuffix(name, suffix) {
+		suffix = ""
+	}
+	return fmt.Sprintf("%s.%d%s", name[:len(name)-len(suffix)], n, suffix)
+}
+
+// rotateInterval is set by the -log_rotate_interval flag.
+var rotateInterval = flag.Duration("log_rotate_interval", 0, "If non-zero, rotate each log file once it has been open this long, regardless of its size")
+
+// compress is set by the -log_compress flag.
+var compress = flag.Bool("log_compress", false, "If true, gzip log files in the background once they are rotated")
+
+// compressQueue holds the names of rotated log files waiting to be
+// compressed by the flushDaemon.
+var compressQueue = make(chan string, 64)
+
+// queueCompression hands the closed log file name to the flushDaemon for
+// compression. It never blocks; if the queue is full the file is left as is.
+func queueCompression(name string) {
+	select {
+	case compressQueue <- name:
+	default:
+	}
+}
+
+// compressLogFile writes a gzipped copy of the log file name to name.gz and
+// then removes the original. A file that has already been pruned is ignored.
+func compressLogFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer src.Close()
+
+	// Write to a temporary name so that a partial file is never mistaken
+	// for a complete one by deleteOldLogFile or by readers.
+	tmp := name + compressedSuffix + ".tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(logFileMode))
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+compressedSuffix)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+// maxAge is set by the -log_max_age flag.
+var maxAge = flag.Duration("log_max_age", 0, "If non-zero, delete log files last modified longer ago than this")
+
+// pruneGlobal is set by the -log_prune_global flag.
+var pruneGlobal = flag.Bool("log_prune_global", false, "If true, enforce -log_max_files across the union of all log directories instead of within each one")
+
+// pruneFatal is set by the -log_prune_fatal flag.
+var pruneFatal = flag.Bool("log_prune_fatal", false, "If true, FATAL log files count towards -log_max_files like the others; by default they are kept however many there are")
+
+// pruneDryRun is set by the -log_prune_dry_run flag.
+var pruneDryRun = flag.Bool("log_prune_dry_run", false, "If true, log at WARNING the old log files that would be deleted, instead of deleting them")
+
+// logFile is a log file found in one of the log directories.
+type logFile struct {
+	dir  string
+	info os.FileInfo
+}
+
+const (
+	logSuffix        = ".log"
+	compressedSuffix = ".gz"
+)
+
+// isLogFileName reports whether name, which must begin with prefix, is a
+// log file written by create, whether or not it has been compressed since.
+func isLogFileName(name, prefix string) bool {
+	suffix := logFilePattern.suffix()
+	return strings.HasPrefix(name, prefix) &&
+		(strings.HasSuffix(name, suffix) || strings.HasSuffix(name, suffix+compressedSuffix))
+}
+
+// otherTagFile reports whether name, which begins with the prefix of the
+// log files for tag, is instead the name of a file for a tag that
+// separateTag names apart, whose prefix extends tag's. Under
+// -log_name_style=unix, for instance, the INFO prefix "prog." begins the
+// names of the FATAL, AUDIT and shard files too.
+func otherTagFile(name, tag string) bool {
+	prefix := logPrefix(tag)
+	for _, other := range []string{severityName[fatalLog], auditTag} {
+		if p := logPrefix(other); other != tag && len(p) > len(prefix) && strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	// Match a shard of any number, since a previous run may have had more.
+	parts := strings.SplitN(logPrefix(severityName[infoLog]+".\x00"), "\x00", 2)
+	if len(parts) < 2 || len(parts[0]) <= len(prefix) || !strings.HasPrefix(name, parts[0]) {
+		return false
+	}
+	rest := name[len(parts[0]):]
+	n := 0
+	for n < len(rest) && '0' <= rest[n] && rest[n] <= '9' {
+		n++
+	}
+	return n > 0 && strings.HasPrefix(rest[n:], parts[1]) && severityName[infoLog]+"."+rest[:n] != tag
+}
+
+// matchingLogFiles returns the regular log files for tag in dir: those whose
+// names begin with its prefix, except those of other tags.
+func matchingLogFiles(dir, tag string) []logFile {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	prefix := logPrefix(tag)
+	var matches []logFile
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
 		}
+		if isLogFileName(file.Name(), prefix) && !otherTagFile(file.Name(), tag) {
+			matches = append(matches, logFile{dir, file})
+		}
+	}
+	return matches
+}
+
+// byModTime sorts log files from least to most recently modified.
+type byModTime []logFile
+
+func (f byModTime) Len() int           { return len(f) }
+func (f byModTime) Less(i, j int) bool { return f[i].info.ModTime().Before(f[j].info.ModTime()) }
+func (f byModTime) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
+
+// deleteOldLogFile removes, in a single pass, every log file for tag that
+// violates a retention policy: those beyond the newest maxFileCount in each
+// log directory for tag, as listed by logDirsFor (or across all of them if
+// -log_prune_global is set), those older than -log_max_age, and the oldest
+// ones while the files' total size exceeds MaxTotalSize, though never the
+// newest file. The files still open for writing are never deleted, though
+// they count towards maxFileCount and the total size all the same. A
+// maxFileCount of zero or less disables the count policy, bringing the log
+// directories into compliance in one call. It returns the total number of
+// log files found and the number actually deleted, stopping at the first
+// error encountered.
+func deleteOldLogFile(tag string, maxFileCount int) (count, deleted int, err error) {
+	onceLogDirs.Do(createLogDirs)
+	if len(logDirs) == 0 {
+		return 0, 0, errors.New("log: no log dirs")
+	}
 
+	var groups [][]logFile
+	seen := make(map[string]bool)
+	for _, dir := range logDirsFor(tag) {
+		if seen[dir] {
+			continue // -log_dir may name the temporary directory too.
+		}
+		seen[dir] = true
+		files := matchingLogFiles(dir, tag)
+		count += len(files)
+		if *pruneGlobal && len(groups) > 0 {
+			groups[0] = append(groups[0], files...)
+		} else {
+			groups = append(groups, files)
+		}
+	}
+
+	var cutoff time.Time
+	if *maxAge > 0 {
+		cutoff = timeNow().Add(-*maxAge)
+	}
+	open := openLogFiles()
+	for _, files := range groups {
+		sort.Sort(byModTime(files))
+		excess := 0
+		if maxFileCount > 0 && len(files) > maxFileCount {
+			excess = len(files) - maxFileCount
+		}
+		var total uint64
 		for _, file := range files {
-			if !file.Mode().IsRegular() {
+			total += uint64(file.info.Size())
+		}
+		for i, file := range files {
+			path := filepath.Join(file.dir, file.info.Name())
+			if open[path] {
+				continue // Still being written to, so kept by every policy.
+			}
+			oversize := MaxTotalSize > 0 && total > MaxTotalSize && i < len(files)-1
+			expired := file.info.ModTime().Before(cutoff)
+			if i >= excess && !expired && !oversize {
 				continue
 			}
-			if strings.HasPrefix(file.Name(), prefix) {
-				foundDir = true
-				logDir = dir
-				logFileCount++
-
-				if fileToDelete == nil {
-					fileToDelete = file
-				} else {
-					if fileToDelete.ModTime().After(file.ModTime()) {
-						fileToDelete = file
-					}
-				}
+			if *pruneDryRun {
+				logging.pruneReports = append(logging.pruneReports, path)
+			} else if err := os.Remove(path); err != nil {
+				return count, deleted, err
 			}
+			total -= uint64(file.info.Size())
+			deleted++
 		}
 	}
 
-	if logFileCount > maxFileCount {
-		if fileToDelete != nil {
-			err := os.Remove(filepath.Join(logDir, fileToDelete.Name()))
-			if err != nil {
-				return logFileCount, err
-			}
+	return count, deleted, nil
+}
+
+// openLogFiles returns the set of the paths of the log files open for
+// writing in logging.file. When the -log_file_pattern gives several
+// severities names with the same prefix, as the default does, one of them
+// may be the file another severity is writing to, however old it is.
+func openLogFiles() map[string]bool {
+	open := make(map[string]bool)
+	for _, w := range logging.file {
+		if sb, ok := w.(*syncBuffer); ok && sb.file != nil {
+			open[sb.file.Name()] = true
 		}
 	}
+	return open
+}
 
-	return logFileCount, nil
+// LogFilePaths returns the name of the log file each severity is writing to
+// now, for those that have one open. Severities that log to standard error,
+// or to writers installed by the program, have no entry; with
+// -log_single_file, all those with files share one name.
+func LogFilePaths() map[Severity]string {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	paths := make(map[Severity]string)
+	for s := infoLog; s < numSeverities(); s++ {
+		if sb, ok := logging.file[s].(*syncBuffer); ok && sb.file != nil && !logging.toStderr {
+			paths[s] = sb.file.Name()
+		}
+	}
+	return paths
 }
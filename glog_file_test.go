@@ -0,0 +1,1967 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tempLogDir creates an empty directory for log files and returns it along
+// with a function that removes it.
+func tempLogDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "glog_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// useLogDir directs new log files to dir, starting from a fresh set of files.
+// It returns a function that closes the files created meanwhile and restores
+// the previous state.
+func useLogDir(dir string) func() {
+	onceLogDirs.Do(createLogDirs)
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	previousDirs, previousFiles := logDirs, logging.file
+	logDirs = []string{dir}
+	logging.file = [maxSeverity]flushSyncWriter{}
+	return func() {
+		logging.mu.Lock()
+		defer logging.mu.Unlock()
+		for _, w := range logging.file {
+			if sb, ok := w.(*syncBuffer); ok && sb.file != nil {
+				sb.Flush()
+				sb.file.Close()
+			}
+		}
+		logDirs, logging.file = previousDirs, previousFiles
+	}
+}
+
+// seedLogFiles creates a log file in dir for each of the given ages,
+// with its modification time set that far in the past, and returns their names.
+func seedLogFiles(t *testing.T, dir string, ages ...time.Duration) []string {
+	now := time.Now()
+	var names []string
+	for _, age := range ages {
+		name, _ := logName(severityName[infoLog], now.Add(-age))
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// testSubprocess returns a command that re-runs the test named name with
+// the given flags, and with env, a "NAME=value" environment variable, set to
+// have the test do its part in the subprocess.
+func testSubprocess(name, env string, args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^" + name + "$"}, args...)...)
+	cmd.Env = append(os.Environ(), env)
+	return cmd
+}
+
+// readLogFiles returns the contents of the files in dir whose names end with
+// suffix, one after the other in the order of their names.
+func readLogFiles(t *testing.T, dir, suffix string) []byte {
+	var logged []byte
+	for _, name := range remainingLogFiles(t, dir) {
+		if strings.HasSuffix(name, suffix) {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			logged = append(logged, data...)
+		}
+	}
+	return logged
+}
+
+// remainingLogFiles returns the sorted names of the files left in dir.
+func remainingLogFiles(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedNames returns a sorted copy of names.
+func sortedNames(names ...string) []string {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	return names
+}
+
+// Test that the -log_max_size flag accepts sizes with and without suffixes.
+func TestByteSizeSet(t *testing.T) {
+	for value, want := range map[string]uint64{
+		"512":    512,
+		"512B":   512,
+		"4KB":    4 * 1024,
+		"64MB":   64 * 1024 * 1024,
+		"64mb":   64 * 1024 * 1024,
+		"2 GB":   2 * 1024 * 1024 * 1024,
+		" 16MB ": 16 * 1024 * 1024,
+	} {
+		var b byteSize
+		if err := b.Set(value); err != nil {
+			t.Errorf("Set(%q): unexpected error: %v", value, err)
+			continue
+		}
+		if uint64(b) != want {
+			t.Errorf("Set(%q): got %d, want %d", value, b, want)
+		}
+	}
+}
+
+// Test that the -log_max_size flag rejects zero, negative and malformed sizes.
+func TestByteSizeSetInvalid(t *testing.T) {
+	for _, value := range []string{"", "0", "0MB", "-1", "-5KB", "MB", "12TB", "1.5MB", "99999999999GB"} {
+		b := byteSize(7)
+		if err := b.Set(value); err == nil {
+			t.Errorf("Set(%q): expected error, got %d", value, b)
+		}
+		if b != 7 {
+			t.Errorf("Set(%q): value changed to %d on error", value, b)
+		}
+	}
+}
+
+// Test that -log_max_total_size accepts zero, for no limit, where the other
+// size flags do not.
+func TestMaxTotalSizeFlagZero(t *testing.T) {
+	defer func(previous uint64) { MaxTotalSize = previous }(MaxTotalSize)
+	MaxTotalSize = 7
+	for _, value := range []string{"0", "0MB"} {
+		if err := flag.Set("log_max_total_size", value); err != nil {
+			t.Errorf("-log_max_total_size=%s: %v", value, err)
+		}
+		if MaxTotalSize != 0 {
+			t.Errorf("-log_max_total_size=%s: got %d, want 0", value, MaxTotalSize)
+		}
+	}
+	if err := flag.Set("log_max_total_size", "-1"); err == nil {
+		t.Error("-log_max_total_size=-1 succeeded")
+	}
+	for _, name := range []string{"log_max_size", "log_buffer_size"} {
+		if err := flag.Set(name, "0"); err == nil {
+			t.Errorf("-%s=0 succeeded", name)
+		}
+	}
+}
+
+// Test that a MaxFileCount of zero disables deletion of old log files.
+func TestMaxFileCountZeroDisablesDeletion(t *testing.T) {
+	setFlags()
+	var err error
+	defer func(previous func(error)) { logExitFunc = previous }(logExitFunc)
+	logExitFunc = func(e error) {
+		err = e
+	}
+	defer func(previous int) { MaxFileCount = previous }(MaxFileCount)
+	MaxFileCount = 0
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	if err != nil {
+		t.Fatalf("info has initial error: %v", err)
+	}
+	before, _, err := deleteOldLogFile(severityName[infoLog], 1<<30)
+	if err != nil {
+		t.Fatalf("counting log files: %v", err)
+	}
+	if err := info.rotateFile(timeNow(), openedStartup); err != nil {
+		t.Fatalf("rotateFile: %v", err)
+	}
+	after, _, err := deleteOldLogFile(severityName[infoLog], 1<<30)
+	if err != nil {
+		t.Fatalf("counting log files: %v", err)
+	}
+	if after < before {
+		t.Errorf("log files were deleted with MaxFileCount=0: %d before, %d after", before, after)
+	}
+}
+
+// Test that deleteOldLogFile enforces MaxFileCount within each directory.
+func TestDeleteOldLogFilePerDirectory(t *testing.T) {
+	dir1, cleanup1 := tempLogDir(t)
+	defer cleanup1()
+	dir2, cleanup2 := tempLogDir(t)
+	defer cleanup2()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir1, dir2}
+
+	// Interleave the modification times of the two directories.
+	names1 := seedLogFiles(t, dir1, 6*time.Hour, 4*time.Hour, 2*time.Hour)
+	names2 := seedLogFiles(t, dir2, 5*time.Hour, 3*time.Hour, 1*time.Hour)
+
+	count, _, err := deleteOldLogFile(severityName[infoLog], 2)
+	if err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if count != 6 {
+		t.Errorf("got count %d, want 6", count)
+	}
+	if got, want := remainingLogFiles(t, dir1), sortedNames(names1[1:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", dir1, got, want)
+	}
+	if got, want := remainingLogFiles(t, dir2), sortedNames(names2[1:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", dir2, got, want)
+	}
+}
+
+// Test that -log_prune_global enforces MaxFileCount across all directories.
+func TestDeleteOldLogFileGlobal(t *testing.T) {
+	dir1, cleanup1 := tempLogDir(t)
+	defer cleanup1()
+	dir2, cleanup2 := tempLogDir(t)
+	defer cleanup2()
+	onceLogDirs.Do(createLogDirs)
+	defer func(previous []string) { logDirs = previous }(logDirs)
+	logDirs = []string{dir1, dir2}
+	defer func(previous bool) { *pruneGlobal = previous }(*pruneGlobal)
+	*pruneGlobal = true
+
+	names1 := seedLogFiles(t, dir1, 4*time.Hour, 2*time.Hour)
+	names2 := seedLogFiles(t, dir2, 5*time.Hour, 3*time.Hour, 1*time.Hour)
+
+	count, _, err := deleteOldLogFile(severityName[infoLog], 4)
+	if err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("got count %d, want 5", count)
+	}
+	// Only the oldest file overall, which lives in dir2, is removed.
+	if got, want := remainingLogFiles(t, dir1), sortedNames(names1...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", dir1, got, want)
+	}
+	if got, want := remainingLogFiles(t, dir2), sortedNames(names2[1:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: got %v, want %v", dir2, got, want)
+	}
+}
+
+// Test that -log_rotate_interval rotates a file once the interval elapses.
+func TestRotateInterval(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous time.Duration) { *rotateInterval = previous }(*rotateInterval)
+	*rotateInterval = time.Hour
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	fname0 := info.file.Name()
+
+	now = now.Add(59 * time.Minute)
+	Info("x")
+	if fname := info.file.Name(); fname != fname0 {
+		t.Errorf("rotated before the interval elapsed: %v", fname)
+	}
+
+	now = now.Add(time.Minute)
+	Info("x")
+	fname1 := info.file.Name()
+	if fname1 == fname0 {
+		t.Fatalf("info.f.Name did not change: %v", fname0)
+	}
+	if want, _ := logName(severityName[infoLog], now); filepath.Base(fname1) != want {
+		t.Errorf("got file name %q, want %q", filepath.Base(fname1), want)
+	}
+}
+
+// Test that lines at or above -log_immediate_flush_threshold are on disk as
+// soon as they are logged, and those below stay buffered until a flush.
+func TestImmediateFlushThreshold(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous Severity) { logging.flushThreshold.set(previous) }(logging.flushThreshold.get())
+	logging.flushThreshold.set(errorLog)
+
+	onDisk := func(s Severity, line string) bool {
+		sb, ok := logging.file[s].(*syncBuffer)
+		if !ok {
+			t.Fatalf("%v log wasn't created", s)
+		}
+		data, err := ioutil.ReadFile(sb.file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Contains(string(data), line)
+	}
+	Info("buffered")
+	Error("immediate")
+	if !onDisk(errorLog, "] immediate\n") {
+		t.Error("ERROR line is not on disk before a flush")
+	}
+	if onDisk(infoLog, "] buffered\n") {
+		t.Error("INFO line is on disk before a flush")
+	}
+
+	logging.flushThreshold.set(infoLog)
+	Info("now immediate")
+	if !onDisk(infoLog, "] now immediate\n") {
+		t.Error("INFO line at the threshold is not on disk before a flush")
+	}
+}
+
+// Test that after a log file is renamed from under the program, as by
+// logrotate, ReopenFiles sends the lines that follow to a fresh file.
+func TestReopenFiles(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	Info("before")
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	name := info.file.Name()
+	rotated := name + ".1"
+	if err := os.Rename(name, rotated); err != nil {
+		t.Fatal(err)
+	}
+	Info("renamed")
+	if err := ReopenFiles(); err != nil {
+		t.Fatal(err)
+	}
+	Info("after")
+	Flush()
+
+	old, err := ioutil.ReadFile(rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(old), "] before\n") || !strings.Contains(string(old), "] renamed\n") {
+		t.Errorf("rotated file is missing the lines logged before ReopenFiles:\n%s", old)
+	}
+	if strings.Contains(string(old), "] after\n") {
+		t.Errorf("rotated file has a line logged after ReopenFiles:\n%s", old)
+	}
+	fresh, err := ioutil.ReadFile(info.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(fresh), "Opened for: reopen\n") || !strings.Contains(string(fresh), "] after\n") {
+		t.Errorf("fresh file %s is missing its banner or the line logged after ReopenFiles:\n%s", info.file.Name(), fresh)
+	}
+	if strings.Contains(string(fresh), "] before\n") {
+		t.Errorf("fresh file has a line logged before ReopenFiles:\n%s", fresh)
+	}
+}
+
+// Test that -log_compress replaces a rotated log file with a gzipped copy.
+func TestCompressRotatedFile(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous bool) { *compress = previous }(*compress)
+	*compress = true
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 512
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	Info("x") // Be sure we have a file.
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	fname0 := info.file.Name()
+	now = now.Add(time.Second)
+	Info(strings.Repeat("x", int(MaxSize))) // force a rollover
+
+	var zipped []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		f, err := os.Open(fname0 + ".gz")
+		if err != nil {
+			continue
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		zipped, err = ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatalf("reading %s.gz: %v", fname0, err)
+		}
+		break
+	}
+	if zipped == nil {
+		t.Fatalf("%s.gz was not created", fname0)
+	}
+	if !strings.Contains(string(zipped), "] x\n") {
+		t.Errorf("compressed file is missing the logged line: %q", zipped)
+	}
+	if _, err := os.Stat(fname0); !os.IsNotExist(err) {
+		t.Errorf("plaintext %s was not removed: %v", fname0, err)
+	}
+}
+
+// Test that create points the symlink for a tag at the newest file.
+func TestCreateSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	for i := 0; i < 2; i++ {
+		f, fname, err := create(severityName[infoLog], now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		f.Close()
+		_, link := logName(severityName[infoLog], now)
+		target, err := os.Readlink(filepath.Join(dir, link))
+		if err != nil {
+			t.Fatalf("Readlink: %v", err)
+		}
+		if target != filepath.Base(fname) {
+			t.Errorf("symlink %s points at %q, want %q", link, target, filepath.Base(fname))
+		}
+	}
+}
+
+// Test that files created within the same second get distinct names, so
+// that neither overwrites the other.
+func TestCreateSameSecond(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	var names []string
+	for i := 0; i < 3; i++ {
+		f, fname, err := create(severityName[infoLog], now.Add(time.Duration(i)*time.Millisecond))
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		fmt.Fprintf(f, "file %d\n", i)
+		f.Close()
+		names = append(names, fname)
+	}
+	for i, fname := range names {
+		data, err := ioutil.ReadFile(fname)
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if want := fmt.Sprintf("file %d\n", i); string(data) != want {
+			t.Errorf("%s: got %q, want %q", fname, data, want)
+		}
+		if !isLogFileName(filepath.Base(fname), logPrefix(severityName[infoLog])) {
+			t.Errorf("%s is not recognized as a log file", fname)
+		}
+	}
+	if names[0] == names[1] || names[1] == names[2] {
+		t.Errorf("names are not distinct: %v", names)
+	}
+}
+
+// Test that with -log_append a reopened log file keeps its earlier content
+// and counts it towards MaxSize.
+func TestLogAppend(t *testing.T) {
+	defer func(previous bool) { *logAppend = previous }(*logAppend)
+	*logAppend = true
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	var fname string
+	var size uint64
+	for i := 0; i < 2; i++ {
+		sb := &syncBuffer{logger: &logging, sev: infoLog}
+		if err := sb.rotateFile(now, openedStartup); err != nil {
+			t.Fatalf("rotateFile: %v", err)
+		}
+		if fname != "" && sb.file.Name() != fname {
+			t.Errorf("reopened %s, want %s", sb.file.Name(), fname)
+		}
+		if sb.nbytes != size {
+			t.Errorf("nbytes = %d after reopening a file of %d bytes", sb.nbytes, size)
+		}
+		fmt.Fprintf(sb, "run %d\n", i)
+		sb.Flush()
+		sb.file.Close()
+		fname = sb.file.Name()
+		fi, err := os.Stat(fname)
+		if err != nil {
+			t.Fatal(err)
+		}
+		size = uint64(fi.Size())
+	}
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "run 0\n") || !strings.Contains(string(data), "run 1\n") {
+		t.Errorf("content of earlier run was lost: %q", data)
+	}
+}
+
+func TestFileModeSet(t *testing.T) {
+	var m fileMode
+	if err := m.Set("0600"); err != nil {
+		t.Fatalf("Set(0600): %v", err)
+	}
+	if m != 0600 || m.String() != "0600" {
+		t.Errorf("got %s, want 0600", m.String())
+	}
+	for _, value := range []string{"", "rw", "0800", "-1", "01777"} {
+		if err := m.Set(value); err == nil {
+			t.Errorf("Set(%q): got nil error, want an error", value)
+		}
+	}
+}
+
+// Test that create honours -log_file_mode.
+func TestLogFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	defer func(previous fileMode) { logFileMode = previous }(logFileMode)
+	logFileMode = 0600
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	f, fname, err := create(severityName[infoLog], time.Now())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	fi, err := os.Stat(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("mode of %s is %#o, want 0600", fname, got)
+	}
+}
+
+// Test that create makes a missing -log_dir, with -log_dir_mode, rather than
+// falling back to the temporary directory.
+func TestCreateMissingLogDir(t *testing.T) {
+	root, cleanup := tempLogDir(t)
+	defer cleanup()
+	dir := filepath.Join(root, "a", "b")
+	defer func(previous string) { *logDir = previous }(*logDir)
+	*logDir = dir
+	defer func(previous fileMode) { logDirMode = previous }(logDirMode)
+	logDirMode = 0700
+	defer useLogDir(dir)()
+	logDirs = append(logDirs, os.TempDir())
+
+	f, fname, err := create(severityName[infoLog], time.Now())
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	f.Close()
+	if filepath.Dir(fname) != dir {
+		t.Errorf("created %s, want a file in %s", fname, dir)
+	}
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != 0700 {
+			t.Errorf("mode of %s is %#o, want 0700", dir, got)
+		}
+	}
+}
+
+// Test the combinations of count- and age-based retention.
+func TestDeleteOldLogFileRetention(t *testing.T) {
+	ages := []time.Duration{5 * time.Hour, 4 * time.Hour, 3 * time.Hour, 2 * time.Hour, 1 * time.Hour}
+	for _, tc := range []struct {
+		name         string
+		maxFileCount int
+		maxAge       time.Duration
+		kept         int // the number of newest files that survive
+	}{
+		{"count only", 3, 0, 3},
+		{"age only", 0, 150 * time.Minute, 2},
+		{"count stricter", 2, 270 * time.Minute, 2},
+		{"age stricter", 4, 90 * time.Minute, 1},
+		{"neither", 0, 0, 5},
+	} {
+		dir, cleanup := tempLogDir(t)
+		restore := useLogDir(dir)
+		previousMaxAge := *maxAge
+		*maxAge = tc.maxAge
+
+		names := seedLogFiles(t, dir, ages...)
+		if _, _, err := deleteOldLogFile(severityName[infoLog], tc.maxFileCount); err != nil {
+			t.Errorf("%s: deleteOldLogFile: %v", tc.name, err)
+		}
+		if got, want := remainingLogFiles(t, dir), sortedNames(names[len(names)-tc.kept:]...); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, want)
+		}
+
+		*maxAge = previousMaxAge
+		restore()
+		cleanup()
+	}
+}
+
+// Test that -log_max_age leaves alone the file another severity is still
+// writing to, whose name has the same prefix, however old it is.
+func TestDeleteOldLogFileAgeKeepsOpenFiles(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous time.Duration) { *maxAge = previous }(*maxAge)
+	*maxAge = time.Hour
+
+	Warning("x") // Opens the INFO and WARNING files.
+	sb, ok := logging.file[warningLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("warning wasn't created")
+	}
+	old := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(sb.file.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := deleteOldLogFile(severityName[infoLog], 0); err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if _, err := os.Stat(sb.file.Name()); err != nil {
+		t.Errorf("the open WARNING file was deleted: %v", err)
+	}
+}
+
+// Test that maxFileCount leaves alone the file another severity is still
+// writing to, whose name has the same prefix, however old it is.
+func TestDeleteOldLogFileCountKeepsOpenFiles(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	Warning("x") // Opens the INFO and WARNING files.
+	sb, ok := logging.file[warningLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("warning wasn't created")
+	}
+	seedLogFiles(t, dir, 2*time.Hour, time.Hour)
+	old := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(sb.file.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	_, deleted, err := deleteOldLogFile(severityName[infoLog], 2)
+	if err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if _, err := os.Stat(sb.file.Name()); err != nil {
+		t.Errorf("the open WARNING file was deleted: %v", err)
+	}
+	if deleted != 1 { // The older of the seeded files.
+		t.Errorf("got %d files deleted, want 1", deleted)
+	}
+}
+
+// Test that MaxTotalSize leaves alone the file another severity is still
+// writing to, whose name has the same prefix, and counts it all the same.
+func TestDeleteOldLogFileTotalSizeKeepsOpenFiles(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous uint64) { MaxTotalSize = previous }(MaxTotalSize)
+	MaxTotalSize = 1
+
+	Warning("x") // Opens the INFO and WARNING files.
+	Flush()
+	sb, ok := logging.file[warningLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("warning wasn't created")
+	}
+	names := seedLogFiles(t, dir, 2*time.Hour)
+	old := time.Now().Add(-3 * time.Hour)
+	if err := os.Chtimes(sb.file.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := deleteOldLogFile(severityName[infoLog], 0); err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if _, err := os.Stat(sb.file.Name()); err != nil {
+		t.Errorf("the open WARNING file was deleted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, names[0])); !os.IsNotExist(err) {
+		t.Errorf("the old closed file %s was kept: %v", names[0], err)
+	}
+}
+
+// Test that deleteOldLogFile deletes every excess file in one call.
+func TestDeleteOldLogFileConverges(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	var ages []time.Duration
+	for i := 10; i > 0; i-- {
+		ages = append(ages, time.Duration(i)*time.Hour)
+	}
+	names := seedLogFiles(t, dir, ages...)
+
+	count, deleted, err := deleteOldLogFile(severityName[infoLog], 4)
+	if err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if count != 10 || deleted != 6 {
+		t.Errorf("got count %d and %d deleted, want 10 and 6", count, deleted)
+	}
+	if got, want := remainingLogFiles(t, dir), sortedNames(names[6:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Test that the default -log_file_pattern produces the historical file names.
+func TestDefaultFilePattern(t *testing.T) {
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	name, link := logName(severityName[infoLog], now)
+	stem := program[:len(program)-len(filepath.Ext(program))]
+	if want := stem + "[2006-01-02 15-04-05].log"; name != want {
+		t.Errorf("logName: got %q, want %q", name, want)
+	}
+	if want := program + ".INFO"; link != want {
+		t.Errorf("link: got %q, want %q", link, want)
+	}
+	if got := logFilePattern.String(); got != defaultFilePattern {
+		t.Errorf("String: got %q, want %q", got, defaultFilePattern)
+	}
+}
+
+// Test that a custom -log_file_pattern names, and prunes, the log files.
+func TestCustomFilePattern(t *testing.T) {
+	defer func(previous filePattern) { *logFilePattern = previous }(*logFilePattern)
+	if err := logFilePattern.Set("{host}-{program}.{tag}.{pid}.{time:20060102-150405}.txt"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	name, _ := logName(severityName[warningLog], now)
+	stem := program[:len(program)-len(filepath.Ext(program))]
+	if want := fmt.Sprintf("%s-%s.WARNING.%d.20060102-150405.txt", host, stem, pid); name != want {
+		t.Errorf("logName: got %q, want %q", name, want)
+	}
+	if got, want := logPrefix(severityName[warningLog]), host+"-"+stem+".WARNING."; got != want {
+		t.Errorf("logPrefix: got %q, want %q", got, want)
+	}
+	if !isLogFileName(name, logPrefix(severityName[warningLog])) {
+		t.Errorf("isLogFileName(%q) = false, want true", name)
+	}
+	if isLogFileName(name+".log", logPrefix(severityName[warningLog])) {
+		t.Errorf("isLogFileName(%q) = true, want false", name+".log")
+	}
+
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	names := seedLogFiles(t, dir, 3*time.Hour, 2*time.Hour, time.Hour)
+	if _, _, err := deleteOldLogFile(severityName[infoLog], 2); err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if got, want := remainingLogFiles(t, dir), sortedNames(names[1:]...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// Test that ParseLogName reverses logName, for the default pattern and for a
+// custom one, and for the names of compressed and disambiguated files.
+func TestParseLogName(t *testing.T) {
+	defer func(previous filePattern) { *logFilePattern = previous }(*logFilePattern)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	stem := program[:len(program)-len(filepath.Ext(program))]
+	for _, tc := range []struct {
+		pattern string
+		tag     string
+	}{
+		{defaultFilePattern, ""},
+		{"{program}.{tag}.{pid}.{time:20060102-150405}.txt", "WARNING"},
+	} {
+		if err := logFilePattern.Set(tc.pattern); err != nil {
+			t.Fatalf("Set(%q): %v", tc.pattern, err)
+		}
+		name, _ := logName(severityName[warningLog], now)
+		for _, n := range []string{name, uniqueName(name, 3), name + compressedSuffix} {
+			gotProgram, gotTag, gotTime, err := ParseLogName(n)
+			if err != nil || gotProgram != stem || gotTag != tc.tag || !gotTime.Equal(now) {
+				t.Errorf("ParseLogName(%q) = %q, %q, %v, %v; want %q, %q, %v", n, gotProgram, gotTag, gotTime, err, stem, tc.tag, now)
+			}
+		}
+		for _, bad := range []string{"", "unrelated.txt", name + ".bak"} {
+			if _, _, _, err := ParseLogName(bad); err == nil {
+				t.Errorf("ParseLogName(%q) succeeded with pattern %q", bad, tc.pattern)
+			}
+		}
+	}
+}
+
+// Test that each -log_name_style names files as documented, and that
+// ParseLogName reads back their start time.
+func TestNameStyle(t *testing.T) {
+	defer func(previous filePattern) { *logFilePattern = previous }(*logFilePattern)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC).Local()
+	stem := program[:len(program)-len(filepath.Ext(program))]
+	for _, tc := range []struct {
+		style string
+		want  string
+	}{
+		{"bracket", stem + now.Format("[2006-01-02 15-04-05]") + ".log"},
+		{"unix", stem + ".1672628645.log"},
+		{"RFC3339", stem + ".2023-01-02T03-04-05Z.log"},
+	} {
+		var style nameStyle
+		if err := style.Set(tc.style); err != nil {
+			t.Fatalf("Set(%q): %v", tc.style, err)
+		}
+		name, _ := logName(severityName[infoLog], now)
+		if name != tc.want {
+			t.Errorf("-log_name_style=%s: got name %q, want %q", tc.style, name, tc.want)
+		}
+		for _, n := range []string{name, uniqueName(name, 2), name + compressedSuffix} {
+			gotProgram, _, gotTime, err := ParseLogName(n)
+			if err != nil || gotProgram != stem || !gotTime.Equal(now) {
+				t.Errorf("-log_name_style=%s: ParseLogName(%q) = %q, %v, %v; want %q, %v", tc.style, n, gotProgram, gotTime, err, stem, now)
+			}
+		}
+		if !isLogFileName(name, logPrefix(severityName[infoLog])) {
+			t.Errorf("-log_name_style=%s: isLogFileName(%q) = false, want true", tc.style, name)
+		}
+	}
+	var style nameStyle
+	if err := style.Set("dos"); err == nil {
+		t.Error("Set(dos) succeeded")
+	}
+}
+
+// Test that rotating the INFO log under -log_name_style=unix, whose INFO
+// prefix begins the names of the FATAL, AUDIT and shard files too, leaves
+// those files alone.
+func TestNameStyleRotationKeepsOtherTags(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous filePattern) { *logFilePattern = previous }(*logFilePattern)
+	var style nameStyle
+	if err := style.Set("unix"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous int) { MaxFileCount = previous }(MaxFileCount)
+	MaxFileCount = 2
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 512
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	var others []string
+	for _, tag := range []string{severityName[fatalLog], auditTag, shardTag(7)} {
+		name, _ := logName(tag, now.Add(-time.Hour))
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		others = append(others, name)
+	}
+	for i := 0; i < 4; i++ {
+		now = now.Add(time.Second)
+		Info(strings.Repeat("x", int(MaxSize))) // force a rollover
+	}
+
+	remaining := make(map[string]bool)
+	for _, name := range remainingLogFiles(t, dir) {
+		remaining[name] = true
+	}
+	for _, name := range others {
+		if !remaining[name] {
+			t.Errorf("%s was deleted by the INFO rotation; left %v", name, remainingLogFiles(t, dir))
+		}
+	}
+}
+
+func TestFilePatternInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"{program",
+		"program}.log",
+		"{user}.log",
+		"{time:}.log",
+		"logs/{program}.log",
+		"{time:2006/01/02}.log",
+	} {
+		var p filePattern
+		if err := p.Set(value); err == nil {
+			t.Errorf("Set(%q): got nil error, want an error", value)
+		}
+	}
+}
+
+// hangingFlusher is an output whose Flush never returns, as that of a hung
+// disk or network mount would not.
+type hangingFlusher struct{ io.Writer }
+
+func (hangingFlusher) Flush() error {
+	time.Sleep(time.Hour)
+	return nil
+}
+
+// Test that -log_fatal_timeout makes a Fatal whose flush hangs exit anyway.
+// The test re-runs itself in a subprocess, which does the logging.
+func TestFatalTimeout(t *testing.T) {
+	if os.Getenv("GLOG_TEST_FATAL_TIMEOUT") == "1" {
+		SetOutput(hangingFlusher{ioutil.Discard})
+		Fatal("fatal")
+		return
+	}
+	cmd := testSubprocess("TestFatalTimeout", "GLOG_TEST_FATAL_TIMEOUT=1", "-log_fatal_timeout=100ms")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Fatalf("subprocess did not fail: %v", err)
+		}
+		if code := exitErr.ExitCode(); code != 255 {
+			t.Errorf("got exit code %d, want 255", code)
+		}
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("subprocess still running 10s after a Fatal with -log_fatal_timeout=100ms")
+	}
+}
+
+// Test that the exit hooks and the final flush get what is left of the
+// -log_fatal_timeout, and no limit if it is not positive.
+func TestFatalTimeLeft(t *testing.T) {
+	defer func(previous time.Duration) { *fatalTimeout = previous }(*fatalTimeout)
+	defer func(previous int64) { atomic.StoreInt64(&fatalStart, previous) }(atomic.LoadInt64(&fatalStart))
+	atomic.StoreInt64(&fatalStart, time.Now().Add(-5*time.Second).UnixNano())
+
+	*fatalTimeout = 60 * time.Second
+	if d := fatalTimeLeft(); d <= 50*time.Second || d > 55*time.Second {
+		t.Errorf("-log_fatal_timeout=60s, 5s in: got %v left, want about 55s", d)
+	}
+	*fatalTimeout = time.Second
+	if d := fatalTimeLeft(); d != time.Nanosecond {
+		t.Errorf("-log_fatal_timeout=1s, 5s in: got %v left, want 1ns", d)
+	}
+	*fatalTimeout = 0
+	if d := fatalTimeLeft(); d != 0 {
+		t.Errorf("-log_fatal_timeout=0: got %v left, want 0 for no limit", d)
+	}
+}
+
+// Test that ExitCode and ExitCodef end the process with their code, after
+// flushing the log files and running the exit hooks, and without a stack
+// trace. The test re-runs itself in a subprocess, which does the logging.
+func TestExitCode(t *testing.T) {
+	switch os.Getenv("GLOG_TEST_EXIT_CODE") {
+	case "plain":
+		RegisterExitHook(func() { fmt.Fprintln(os.Stderr, "exit hook ran") })
+		Info("last line before exit")
+		ExitCode(3, "exit")
+		return
+	case "format":
+		RegisterExitHook(func() { fmt.Fprintln(os.Stderr, "exit hook ran") })
+		Info("last line before exit")
+		ExitCodef(42, "exit %s", "now")
+		return
+	}
+	for _, test := range []struct {
+		mode string
+		code int
+		msg  string
+	}{
+		{"plain", 3, "exit"},
+		{"format", 42, "exit now"},
+	} {
+		dir, cleanup := tempLogDir(t)
+		cmd := testSubprocess("TestExitCode", "GLOG_TEST_EXIT_CODE="+test.mode, "-log_dir="+dir, "-log_flush_interval=1h")
+		out, err := cmd.CombinedOutput()
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			t.Errorf("%s: subprocess did not fail: %v\n%s", test.mode, err, out)
+		} else if code := exitErr.ExitCode(); code != test.code {
+			t.Errorf("%s: got exit code %d, want %d", test.mode, code, test.code)
+		}
+		if !strings.Contains(string(out), "exit hook ran\n") {
+			t.Errorf("%s: exit hook did not run:\n%s", test.mode, out)
+		}
+		logged := readLogFiles(t, dir, logSuffix)
+		cleanup()
+		for _, want := range []string{"] last line before exit\n", "] " + test.msg + "\n"} {
+			if !strings.Contains(string(logged), want) {
+				t.Errorf("%s: log files are missing %q:\n%s", test.mode, want, logged)
+			}
+		}
+		if strings.Contains(string(out)+string(logged), "goroutine ") {
+			t.Errorf("%s: output holds a stack trace:\n%s%s", test.mode, out, logged)
+		}
+	}
+}
+
+// parkedForFatal blocks forever, so that its goroutine is in the stack dump
+// of a Fatal.
+func parkedForFatal(started chan<- bool) {
+	started <- true
+	select {}
+}
+
+// Test that -log_fatal_all_stacks=false has Fatal dump only the stack of its
+// caller's goroutine. The test re-runs itself in a subprocess, which does the
+// logging.
+func TestFatalAllStacks(t *testing.T) {
+	if os.Getenv("GLOG_TEST_FATAL_ALL_STACKS") == "1" {
+		started := make(chan bool)
+		go parkedForFatal(started)
+		<-started
+		Fatal("fatal")
+		return
+	}
+	for _, all := range []bool{true, false} {
+		dir, cleanup := tempLogDir(t)
+		cmd := testSubprocess("TestFatalAllStacks", "GLOG_TEST_FATAL_ALL_STACKS=1", "-log_dir="+dir, fmt.Sprintf("-log_fatal_all_stacks=%v", all))
+		if out, err := cmd.CombinedOutput(); err == nil {
+			t.Errorf("-log_fatal_all_stacks=%v: subprocess did not fail:\n%s", all, out)
+		}
+		logged := readLogFiles(t, dir, logSuffix)
+		cleanup()
+		if !strings.Contains(string(logged), "] fatal\n") || !strings.Contains(string(logged), "TestFatalAllStacks") {
+			t.Errorf("-log_fatal_all_stacks=%v: log files are missing the FATAL line or its stack:\n%s", all, logged)
+		}
+		if got := strings.Contains(string(logged), "parkedForFatal"); got != all {
+			t.Errorf("-log_fatal_all_stacks=%v: other goroutine in the dump = %v, want %v:\n%s", all, got, all, logged)
+		}
+	}
+}
+
+// Test that with -log_fatal_to_stderr=false, Fatal writes nothing to
+// standard error, but still writes its line and stack to the FATAL file and
+// exits. The test re-runs itself in a subprocess, which calls Fatal.
+func TestFatalToStderr(t *testing.T) {
+	if os.Getenv("GLOG_TEST_FATAL_TO_STDERR") == "1" {
+		Fatal("fatal")
+		return
+	}
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	cmd := testSubprocess("TestFatalToStderr", "GLOG_TEST_FATAL_TO_STDERR=1", "-log_dir="+dir, "-log_fatal_to_stderr=false")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		t.Error("subprocess did not fail")
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("got standard error %q, want none", stderr.String())
+	}
+	logged := readLogFiles(t, dir, ".FATAL") // The symlink to the FATAL file.
+	if !strings.Contains(string(logged), "] fatal\n") || !strings.Contains(string(logged), "TestFatalToStderr") {
+		t.Errorf("FATAL log file is missing the line or its stack:\n%s", logged)
+	}
+}
+
+// Test that with -log_fatal_stack_file, Fatal writes its stack traces to a
+// file of their own, which the FATAL log file names instead of holding them.
+// The test re-runs itself in a subprocess, which calls Fatal.
+func TestFatalStackFile(t *testing.T) {
+	if os.Getenv("GLOG_TEST_FATAL_STACK_FILE") == "1" {
+		Fatal("fatal")
+		return
+	}
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	cmd := testSubprocess("TestFatalStackFile", "GLOG_TEST_FATAL_STACK_FILE=1", "-log_dir="+dir, "-log_fatal_stack_file")
+	if out, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("subprocess did not fail:\n%s", out)
+	}
+	var stackFile string
+	for _, name := range remainingLogFiles(t, dir) {
+		if strings.HasPrefix(name, program+".FATAL.stack.") && strings.HasSuffix(name, ".txt") {
+			stackFile = filepath.Join(dir, name)
+		}
+	}
+	if stackFile == "" {
+		t.Fatalf("no stack file in %v", remainingLogFiles(t, dir))
+	}
+	stack, err := ioutil.ReadFile(stackFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(stack), "TestFatalStackFile") {
+		t.Errorf("stack file is missing the stack of the test:\n%s", stack)
+	}
+	logged, err := ioutil.ReadFile(filepath.Join(dir, program+".FATAL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(logged), "] fatal\n") {
+		t.Errorf("FATAL log file is missing the line:\n%s", logged)
+	}
+	if want := "Stack traces written to " + stackFile + "\n"; !strings.Contains(string(logged), want) {
+		t.Errorf("FATAL log file does not have %q:\n%s", want, logged)
+	}
+	if strings.Contains(string(logged), "goroutine ") {
+		t.Errorf("FATAL log file holds stack traces:\n%s", logged)
+	}
+}
+
+// Test that a crash loop keeps the FATAL file of every crash, however soon
+// they follow each other, even with -log_append and a -log_max_files they
+// exceed. The test re-runs itself in subprocesses, which call Fatal.
+func TestFatalFilesKept(t *testing.T) {
+	if os.Getenv("GLOG_TEST_FATAL_KEPT") == "1" {
+		Fatal("crash")
+		return
+	}
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	const crashes = 3
+	for i := 0; i < crashes; i++ {
+		cmd := testSubprocess("TestFatalFilesKept", "GLOG_TEST_FATAL_KEPT=1", "-log_dir="+dir, "-log_append", "-log_max_files=2")
+		if out, err := cmd.CombinedOutput(); err == nil {
+			t.Fatalf("subprocess did not fail:\n%s", out)
+		}
+	}
+	var fatal []string
+	for _, name := range remainingLogFiles(t, dir) {
+		if strings.HasPrefix(name, logPrefix("FATAL")) && strings.HasSuffix(name, logSuffix) {
+			data, err := ioutil.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(string(data), "] crash\n"); n != 1 {
+				t.Errorf("%s has %d crashes, want 1:\n%s", name, n, data)
+			}
+			fatal = append(fatal, name)
+		}
+	}
+	if len(fatal) != crashes {
+		t.Errorf("got FATAL files %q, want %d", fatal, crashes)
+	}
+}
+
+// Test that the lines logged before a Fatal or Exit are on disk when the
+// process ends. The test re-runs itself in a subprocess, which does the
+// logging.
+func TestFatalFlushesFiles(t *testing.T) {
+	switch os.Getenv("GLOG_TEST_FATAL_FLUSH") {
+	case "fatal":
+		Info("last line before fatal")
+		Fatal("fatal")
+		return
+	case "exit":
+		Info("last line before exit")
+		Exit("exit")
+		return
+	}
+	for _, mode := range []string{"fatal", "exit"} {
+		dir, cleanup := tempLogDir(t)
+		cmd := testSubprocess("TestFatalFlushesFiles", "GLOG_TEST_FATAL_FLUSH="+mode, "-log_dir="+dir, "-log_flush_interval=1h")
+		out, err := cmd.CombinedOutput()
+		if _, ok := err.(*exec.ExitError); !ok {
+			t.Errorf("%s: subprocess did not fail: %v\n%s", mode, err, out)
+		}
+		logged := readLogFiles(t, dir, logSuffix)
+		if want := "] last line before " + mode + "\n"; !strings.Contains(string(logged), want) {
+			t.Errorf("%s: log files are missing %q:\n%s", mode, want, logged)
+		}
+		if want := "] " + mode + "\n"; !strings.Contains(string(logged), want) {
+			t.Errorf("%s: log files are missing %q:\n%s", mode, want, logged)
+		}
+		cleanup()
+	}
+}
+
+// Test that -log_pid_file writes the process ID beside the first log file,
+// replacing a stale file, and that Shutdown removes it.
+func TestPIDFile(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous bool) { *pidFile = previous }(*pidFile)
+	*pidFile = true
+
+	name := filepath.Join(dir, program+".pid")
+	if err := ioutil.WriteFile(name, []byte("999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Info("start")
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strconv.Itoa(pid) + "\n"; string(data) != want {
+		t.Errorf("pid file holds %q, want %q", data, want)
+	}
+	Shutdown()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("pid file still exists after Shutdown: %v", err)
+	}
+}
+
+// Test that Shutdown flushes and closes the log files, and that logging
+// afterwards opens new ones.
+func TestShutdown(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	Info("before shutdown")
+	sb, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatalf("no log file was created: %T", logging.file[infoLog])
+	}
+	Shutdown()
+	Shutdown() // Idempotent.
+
+	data, err := ioutil.ReadFile(sb.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "] before shutdown\n") {
+		t.Errorf("line was not flushed: %q", data)
+	}
+	if _, err := sb.file.Write([]byte("x")); err == nil {
+		t.Error("log file is still open after Shutdown")
+	}
+	if logging.flushStop != nil {
+		t.Error("flush daemon is still running after Shutdown")
+	}
+
+	Info("after shutdown")
+	Flush()
+	if logging.file[infoLog] == nil || logging.flushStop == nil {
+		t.Fatal("logging after Shutdown did not reopen the log file and restart flushing")
+	}
+	name := logging.file[infoLog].(*syncBuffer).file.Name()
+	if data, err := ioutil.ReadFile(name); err != nil || !strings.Contains(string(data), "] after shutdown\n") {
+		t.Errorf("reopened log file %s: got %q, %v", name, data, err)
+	}
+}
+
+// Test that no log file is created for the severities below -filethreshold.
+func TestFileThreshold(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer logging.fileThreshold.set(logging.fileThreshold.get())
+	if err := logging.fileThreshold.Set("WARNING"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	Info("info only")
+	Flush()
+	if names := remainingLogFiles(t, dir); len(names) != 0 {
+		t.Errorf("INFO line created files %v", names)
+	}
+	if logging.file[infoLog] != nil {
+		t.Error("INFO line opened a log file")
+	}
+
+	Warning("warned")
+	Flush()
+	if logging.file[warningLog] == nil || logging.file[infoLog] != nil {
+		t.Fatal("WARNING line did not open only the WARNING log file")
+	}
+	data, err := ioutil.ReadFile(logging.file[warningLog].(*syncBuffer).file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "] warned\n") || strings.Contains(string(data), "info only") {
+		t.Errorf("got %q", data)
+	}
+	if got := logging.stderrThreshold.get(); got != errorLog {
+		t.Errorf("setting -filethreshold changed -stderrthreshold to %d", got)
+	}
+}
+
+// Test that -log_dir_<severity> puts the files, symlinks and pruning of that
+// severity in its own directory.
+func TestSeverityLogDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	base, cleanup := tempLogDir(t)
+	defer cleanup()
+	errDir, cleanupErr := tempLogDir(t)
+	defer cleanupErr()
+	defer useLogDir(base)()
+	defer func(previous string) { *severityLogDir["ERROR"] = previous }(*severityLogDir["ERROR"])
+	*severityLogDir["ERROR"] = errDir
+
+	Info("to base")
+	Error("to error dir")
+	Flush()
+	if dir := filepath.Dir(logging.file[infoLog].(*syncBuffer).file.Name()); dir != base {
+		t.Errorf("INFO file is in %s, want %s", dir, base)
+	}
+	errName := logging.file[errorLog].(*syncBuffer).file.Name()
+	if dir := filepath.Dir(errName); dir != errDir {
+		t.Errorf("ERROR file is in %s, want %s", dir, errDir)
+	}
+	_, link := logName(severityName[errorLog], time.Now())
+	if target, err := os.Readlink(filepath.Join(errDir, link)); err != nil || target != filepath.Base(errName) {
+		t.Errorf("ERROR symlink points at %q (%v), want %q", target, err, filepath.Base(errName))
+	}
+
+	names := seedLogFiles(t, errDir, 3*time.Hour, 2*time.Hour, time.Hour)
+	if _, _, err := deleteOldLogFile(severityName[errorLog], 2); err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	remaining := remainingLogFiles(t, errDir)
+	for _, name := range names[:2] {
+		for _, r := range remaining {
+			if r == name {
+				t.Errorf("%s was not pruned from %s: %v", name, errDir, remaining)
+			}
+		}
+	}
+}
+
+// Test that deleteOldLogFile deletes the oldest files until their total size
+// is within MaxTotalSize, but keeps the newest however large.
+func TestDeleteOldLogFileTotalSize(t *testing.T) {
+	defer func(previous uint64) { MaxTotalSize = previous }(MaxTotalSize)
+	for _, tc := range []struct {
+		maxTotalSize uint64
+		kept         int
+	}{
+		{750, 2},  // 1000 bytes, less 100 and 200.
+		{1000, 4}, // Within the limit already.
+		{50, 1},   // Only the newest, though it exceeds the limit.
+	} {
+		dir, cleanup := tempLogDir(t)
+		restore := useLogDir(dir)
+		MaxTotalSize = tc.maxTotalSize
+
+		ages := []time.Duration{4 * time.Hour, 3 * time.Hour, 2 * time.Hour, time.Hour}
+		names := seedLogFiles(t, dir, ages...)
+		now := time.Now()
+		for i, name := range names {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, make([]byte, 100*(i+1)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(path, now.Add(-ages[i]), now.Add(-ages[i])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := deleteOldLogFile(severityName[infoLog], 0); err != nil {
+			t.Errorf("MaxTotalSize=%d: deleteOldLogFile: %v", tc.maxTotalSize, err)
+		}
+		if got, want := remainingLogFiles(t, dir), sortedNames(names[len(names)-tc.kept:]...); !reflect.DeepEqual(got, want) {
+			t.Errorf("MaxTotalSize=%d: got %v, want %v", tc.maxTotalSize, got, want)
+		}
+
+		restore()
+		cleanup()
+	}
+}
+
+// errWriter fails every write, as a full disk does.
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("no space left on device")
+}
+
+// captureStderr redirects os.Stderr to a temporary file, and returns a
+// function that restores it and returns what was written.
+func captureStderr(t *testing.T) func() string {
+	f, err := ioutil.TempFile("", "glog_stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := os.Stderr
+	os.Stderr = f
+	return func() string {
+		os.Stderr = previous
+		f.Close()
+		defer os.Remove(f.Name())
+		data, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+}
+
+// Test that a log file that cannot be written falls back to standard error,
+// warning once, and that a new file is tried after fileRetryInterval.
+func TestWriteFailureFallback(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	sb := &syncBuffer{logger: &logging, sev: infoLog}
+	if err := sb.rotateFile(now, openedStartup); err != nil {
+		t.Fatalf("rotateFile: %v", err)
+	}
+	defer func() { sb.file.Close() }()
+	sb.Writer = bufio.NewWriterSize(errWriter{}, 16)
+
+	fileErrs := DropStats().FileErrors
+	stderr := captureStderr(t)
+	sb.Write([]byte("first line, longer than the buffer\n"))
+	now = now.Add(time.Second)
+	sb.Write([]byte("second line, longer than the buffer\n"))
+	got := stderr()
+	if n := DropStats().FileErrors - fileErrs; n != 2 {
+		t.Errorf("DropStats counted %d file errors, want 2", n)
+	}
+	if n := strings.Count(got, "cannot write INFO log"); n != 1 {
+		t.Errorf("got %d warnings, want 1:\n%s", n, got)
+	}
+	if !strings.Contains(got, "first line") || !strings.Contains(got, "second line") {
+		t.Errorf("lines did not fall back to standard error:\n%s", got)
+	}
+
+	now = now.Add(fileRetryInterval)
+	stderr = captureStderr(t)
+	sb.Write([]byte("third line\n"))
+	sb.Flush()
+	got = stderr()
+	if sb.failing || strings.Contains(got, "third line") {
+		t.Errorf("file output did not recover:\n%s", got)
+	}
+	data, err := ioutil.ReadFile(sb.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "third line\n") {
+		t.Errorf("new log file is missing the line: %q", data)
+	}
+}
+
+// Test that with -log_dir_strict a -log_dir that cannot be used is reported
+// and logging falls back to standard error rather than the temporary
+// directory.
+func TestLogDirStrict(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	notDir := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(notDir, "logs")
+	defer useLogDir(dir)()
+	defer func(previous string) { *logDir = previous }(*logDir)
+	defer func(previous bool) { *logDirStrict = previous }(*logDirStrict)
+	*logDir, *logDirStrict = bad, true
+
+	logDirs = nil
+	createLogDirs()
+	if len(logDirs) != 1 || logDirs[0] != bad {
+		t.Fatalf("got log dirs %q, want only %q", logDirs, bad)
+	}
+
+	setFlags()
+	defer setFlags()
+	stderr := captureStderr(t)
+	Info("first")
+	Info("second")
+	out := stderr()
+	if n := strings.Count(out, "log: cannot create log file"); n != 1 {
+		t.Errorf("got %d errors on standard error, want 1:\n%s", n, out)
+	}
+	for _, want := range []string{"] first\n", "] second\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("standard error is missing %q:\n%s", want, out)
+		}
+	}
+	if logging.file[infoLog] != nil {
+		t.Error("INFO file was created")
+	}
+	if names := remainingLogFiles(t, dir); len(names) != 1 {
+		t.Errorf("files were created: %v", names)
+	}
+}
+
+// Test that every new log file starts with one banner giving the reason it
+// was opened, and that the banner does not count towards MaxSize.
+func TestFileBanner(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 64 // Smaller than the banner.
+	defer func(previous time.Duration) { *rotateInterval = previous }(*rotateInterval)
+	*rotateInterval = time.Hour
+
+	sb := &syncBuffer{logger: &logging, sev: infoLog}
+	if err := sb.rotateFile(now, openedStartup); err != nil {
+		t.Fatalf("rotateFile: %v", err)
+	}
+	writes := []struct {
+		advance time.Duration
+		line    string
+	}{
+		{0, strings.Repeat("a", 39) + "\n"},
+		{0, strings.Repeat("b", 39) + "\n"},
+		{time.Hour, "c\n"},
+	}
+	var names []string
+	for _, w := range writes {
+		now = now.Add(w.advance)
+		sb.Write([]byte(w.line))
+		names = append(names, sb.file.Name())
+	}
+	sb.Flush()
+	sb.file.Close()
+
+	for i, reason := range []string{openedStartup, openedSize, openedTime} {
+		data, err := ioutil.ReadFile(names[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(data)
+		if n := strings.Count(content, "Log file created at: "); n != 1 {
+			t.Errorf("file %d has %d banners:\n%s", i, n, content)
+		}
+		for _, want := range []string{
+			"Running on machine: " + host + "\n",
+			fmt.Sprintf("Running as: %s, pid %d\n", program, pid),
+			"Opened for: " + reason + "\n",
+			"\n" + writes[i].line,
+		} {
+			if !strings.Contains(content, want) {
+				t.Errorf("file %d is missing %q:\n%s", i, want, content)
+			}
+		}
+	}
+}
+
+// Test that the version and commit set by SetBuildInfo are in the banner of a
+// new log file.
+func TestFileBannerBuildInfo(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer SetBuildInfo("", "")
+
+	sb := &syncBuffer{logger: &logging, sev: infoLog}
+	for _, test := range []struct {
+		version, commit string
+		want            string
+	}{
+		{"1.2.3", "", "Build: version 1.2.3, commit unknown\n"},
+		{"1.2.4", "abc123", "Build: version 1.2.4, commit abc123\n"},
+	} {
+		SetBuildInfo(test.version, test.commit)
+		if err := sb.rotateFile(timeNow(), openedStartup); err != nil {
+			t.Fatalf("rotateFile: %v", err)
+		}
+		sb.Flush()
+		data, err := ioutil.ReadFile(sb.file.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), test.want) {
+			t.Errorf("banner of %s is missing %q:\n%s", sb.file.Name(), test.want, data)
+		}
+	}
+	sb.file.Close()
+}
+
+// Test that -log_single_file writes the lines of every severity, in order, to
+// one file.
+func TestSingleFile(t *testing.T) {
+	defer func(previous bool) { *singleFile = previous }(*singleFile)
+	*singleFile = true
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	setFlags()
+
+	Warning("first")
+	Info("second")
+	Error("third")
+	Flush()
+
+	sb, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("INFO file not created")
+	}
+	for _, s := range []Severity{warningLog, errorLog, fatalLog} {
+		if !logging.sameFile(infoLog, s) {
+			t.Errorf("%s does not share the INFO file", severityName[s])
+		}
+	}
+	var files []string
+	for _, name := range remainingLogFiles(t, dir) {
+		if fi, err := os.Lstat(filepath.Join(dir, name)); err == nil && fi.Mode().IsRegular() {
+			files = append(files, name)
+		}
+	}
+	if len(files) != 1 || files[0] != filepath.Base(sb.file.Name()) {
+		t.Fatalf("got log files %v, want only %s", files, filepath.Base(sb.file.Name()))
+	}
+	data, err := ioutil.ReadFile(sb.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := -1
+	for _, want := range []string{"] first\n", "] second\n", "] third\n"} {
+		i := strings.Index(string(data), want)
+		if i < 0 || i < last {
+			t.Errorf("%q is missing or out of order:\n%s", want, data)
+		}
+		last = i
+	}
+	if n := strings.Count(string(data), "Log file created at: "); n != 1 {
+		t.Errorf("file has %d banners, want 1", n)
+	}
+}
+
+// Test that AddTeeWriter mirrors the lines of a severity into its writers
+// as well as the log file, and that a failing writer is reported once and
+// does not stop the others.
+func TestAddTeeWriter(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous []*teeWriter) { logging.tees[warningLog] = previous }(logging.tees[warningLog])
+
+	var tee bytes.Buffer
+	AddTeeWriter(WarningLevel, errWriter{})
+	AddTeeWriter(WarningLevel, &tee)
+	stderr := captureStderr(t)
+	Warning("first")
+	Warning("second")
+	Info("not teed")
+	Flush()
+	warnings := stderr()
+
+	if n := strings.Count(tee.String(), "\n"); n != 2 || !strings.Contains(tee.String(), "] first\n") || !strings.HasSuffix(tee.String(), "] second\n") {
+		t.Errorf("tee writer got %q, want the two WARNING lines", tee.String())
+	}
+	sb, ok := logging.file[warningLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("WARNING file not created")
+	}
+	data, err := ioutil.ReadFile(sb.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), tee.String()) {
+		t.Errorf("WARNING file holds %q, want it to end with %q", data, tee.String())
+	}
+	if n := strings.Count(warnings, "cannot write WARNING log to tee writer"); n != 1 {
+		t.Errorf("got %d reports of the failing tee writer, want 1:\n%s", n, warnings)
+	}
+}
+
+// fakeClock is a clock that moves only when told to.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+// advance moves the clock on by d.
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+// Test that advancing the clock past -log_rotate_interval rotates the log
+// file, naming the new one and stamping its lines with the clock's time, and
+// past -log_max_age deletes the old one.
+func TestClockRotationAndExpiry(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous time.Duration) { *rotateInterval = previous }(*rotateInterval)
+	*rotateInterval = time.Hour
+	defer func(previous time.Duration) { *maxAge = previous }(*maxAge)
+	*maxAge = 90 * time.Minute
+	// Start the clock in the past, so that it has not caught up with the
+	// real modification time of the file created last.
+	c := &fakeClock{time.Now().Add(-3 * time.Hour).Truncate(time.Second)}
+	defer setClockForTesting(c)()
+
+	Info("before")
+	info, ok := logging.file[infoLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("info wasn't created")
+	}
+	first := info.file.Name()
+	if want, _ := logName(severityName[infoLog], c.now()); filepath.Base(first) != want {
+		t.Errorf("got file name %q, want %q", filepath.Base(first), want)
+	}
+
+	c.advance(59 * time.Minute)
+	Info("still before")
+	if info.file.Name() != first {
+		t.Fatalf("rotated before the interval elapsed: %v", info.file.Name())
+	}
+	if _, err := os.Stat(first); err != nil {
+		t.Errorf("file deleted before -log_max_age: %v", err)
+	}
+	Flush()
+	if err := os.Chtimes(first, c.now(), c.now()); err != nil {
+		t.Fatal(err)
+	}
+
+	c.advance(2 * time.Hour)
+	Info("after")
+	second := info.file.Name()
+	if second == first {
+		t.Fatalf("did not rotate after the interval elapsed")
+	}
+	if want, _ := logName(severityName[infoLog], c.now()); filepath.Base(second) != want {
+		t.Errorf("got file name %q, want %q", filepath.Base(second), want)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("file older than -log_max_age still there: %v", err)
+	}
+	Flush()
+	data, err := ioutil.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stamp := c.now().Format("0102 15:04:05"); !strings.Contains(string(data), "I"+stamp) {
+		t.Errorf("new file holds %q, want a line stamped %s", data, stamp)
+	}
+}
+
+// Test that -log_prune_dry_run keeps the files that deleteOldLogFile would
+// delete, counting them as deleted, and logs each at WARNING.
+func TestPruneDryRun(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous bool) { *pruneDryRun = previous }(*pruneDryRun)
+	*pruneDryRun = true
+
+	names := seedLogFiles(t, dir, 4*time.Hour, 3*time.Hour, 2*time.Hour, time.Hour)
+	count, deleted, err := deleteOldLogFile(severityName[infoLog], 2)
+	if err != nil {
+		t.Fatalf("deleteOldLogFile: %v", err)
+	}
+	if count != 4 || deleted != 2 {
+		t.Errorf("deleteOldLogFile: got count %d, deleted %d; want 4, 2", count, deleted)
+	}
+	if got, want := remainingLogFiles(t, dir), sortedNames(names...); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want every file kept: %v", got, want)
+	}
+
+	defer logging.swap(logging.newBuffers())
+	_, _, line, _ := runtime.Caller(0)
+	Info("report the prunes")
+	lines := strings.SplitAfter(contents(warningLog), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("WARNING log: got %q, want two lines", contents(warningLog))
+	}
+	for i, name := range names[:2] {
+		want := fmt.Sprintf(" glog_file_test.go:%d] -log_prune_dry_run: would delete %s\n", line+1, filepath.Join(dir, name))
+		if !strings.HasPrefix(lines[i], "W") || !strings.HasSuffix(lines[i], want) {
+			t.Errorf("WARNING line %d: got %q, want suffix %q", i, lines[i], want)
+		}
+	}
+	if contents(infoLog) == "" {
+		t.Error("INFO line not written")
+	}
+}
+
+// BenchmarkBufferSize compares the throughput of writing lines to a log file
+// with buffers of -log_buffer_size from small to large.
+func BenchmarkBufferSize(b *testing.B) {
+	line := []byte("I0102 15:04:05.067890    1234 file.go:12] " + strings.Repeat("x", 100) + "\n")
+	for _, size := range []uint64{4 << 10, 64 << 10, 256 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "glog_bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			defer useLogDir(dir)()
+			defer func(previous uint64) { bufferSize = previous }(bufferSize)
+			bufferSize = size
+			defer func(previous uint64) { MaxSize = previous }(MaxSize)
+			MaxSize = math.MaxUint64
+
+			sb := &syncBuffer{logger: &logging, sev: infoLog}
+			if err := sb.rotateFile(time.Now(), openedStartup); err != nil {
+				b.Fatal(err)
+			}
+			defer sb.file.Close()
+			b.SetBytes(int64(len(line)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sb.Write(line)
+			}
+			sb.Flush()
+		})
+	}
+}
+
+// Test that LogFilePaths names the open log file of each severity that has
+// logged, and no others.
+func TestLogFilePaths(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	if paths := LogFilePaths(); len(paths) != 0 {
+		t.Errorf("got %v before any logging, want no files", paths)
+	}
+	Info("info")
+	Warning("warning")
+	paths := LogFilePaths()
+	for _, s := range []Severity{infoLog, warningLog} {
+		path, ok := paths[s]
+		if !ok {
+			t.Errorf("no path for %v in %v", s, paths)
+			continue
+		}
+		if filepath.Dir(path) != dir {
+			t.Errorf("%v log file %s is not in %s", s, path, dir)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%v log file: %v", s, err)
+		}
+	}
+	if path, ok := paths[errorLog]; ok {
+		t.Errorf("got %s for ERROR, which has not logged", path)
+	}
+	if paths[infoLog] == paths[warningLog] {
+		t.Errorf("INFO and WARNING share %s", paths[infoLog])
+	}
+}
+
+func TestSetLogDir(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous string) { *logDir = previous }(*logDir)
+
+	Info("before")
+	Flush()
+	newDir := filepath.Join(dir, "moved")
+	if err := SetLogDir(newDir); err != nil {
+		t.Fatalf("SetLogDir: %v", err)
+	}
+	Info("after")
+	Warning("warning")
+	Flush()
+
+	old, err := ioutil.ReadFile(filepath.Join(dir, program+".INFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(old), "before") || strings.Contains(string(old), "after") {
+		t.Errorf("old INFO log file has %q, want only the line before the move", old)
+	}
+	for s, path := range LogFilePaths() {
+		if filepath.Dir(path) != newDir {
+			t.Errorf("%v log file %s is not in %s", s, path, newDir)
+		}
+	}
+	moved, err := ioutil.ReadFile(LogFilePaths()[infoLog])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(moved), "after") {
+		t.Errorf("new INFO log file has %q, want the line after the move", moved)
+	}
+	if _, ok := LogFilePaths()[warningLog]; !ok {
+		t.Error("no WARNING log file after the move")
+	}
+
+	bad := filepath.Join(newDir, program+".INFO", "sub")
+	if err := SetLogDir(bad); err == nil {
+		t.Errorf("SetLogDir(%s) succeeded below a file", bad)
+	}
+	if *logDir != newDir {
+		t.Errorf("-log_dir is %q after a failed SetLogDir, want %q", *logDir, newDir)
+	}
+}
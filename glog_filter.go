@@ -0,0 +1,194 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Filtering, redaction and truncation of log lines by their message.
+
+package glog
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// dropPatterns is set by the -log_drop_regex flag.
+var dropPatterns regexpList
+
+// maxLineBytes is set by the -log_max_line_bytes flag.
+var maxLineBytes = flag.Int("log_max_line_bytes", 0, "If positive, log messages longer than this many bytes are truncated; FATAL lines and stack traces are not")
+
+func init() {
+	flag.Var(&dropPatterns, "log_drop_regex", "comma-separated list of regular expressions; lines whose message matches one are dropped")
+}
+
+// regexpList is a list of regular expressions. It implements the flag.Value
+// interface; the -log_drop_regex flag is of type regexpList. The list is
+// replaced atomically, so that it can be set while logging.
+type regexpList struct {
+	v atomic.Value // []*regexp.Regexp
+}
+
+func (r *regexpList) get() []*regexp.Regexp {
+	list, _ := r.v.Load().([]*regexp.Regexp)
+	return list
+}
+
+// String is part of the flag.Value interface.
+func (r *regexpList) String() string {
+	var exprs []string
+	for _, re := range r.get() {
+		exprs = append(exprs, re.String())
+	}
+	return strings.Join(exprs, ",")
+}
+
+// Get is part of the flag.Getter interface.
+func (r *regexpList) Get() interface{} {
+	return r.get()
+}
+
+// Syntax: -log_drop_regex=^health check,connection reset by peer
+func (r *regexpList) Set(value string) error {
+	var list []*regexp.Regexp
+	for _, expr := range strings.Split(value, ",") {
+		if expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression %q: %v", expr, err)
+		}
+		list = append(list, re)
+	}
+	r.v.Store(list)
+	return nil
+}
+
+// dropLine reports whether the message in buf matches -log_drop_regex, and
+// if so counts it in Stats.Dropped.
+func dropLine(buf *buffer) bool {
+	list := dropPatterns.get()
+	if len(list) == 0 {
+		return false
+	}
+	msg := bytes.TrimSuffix(buf.Bytes()[buf.msg:], []byte{'\n'})
+	for _, re := range list {
+		if re.Match(msg) {
+			atomic.AddInt64(&Stats.Dropped.lines, 1)
+			atomic.AddInt64(&Stats.Dropped.bytes, int64(buf.Len()))
+			return true
+		}
+	}
+	return false
+}
+
+// redactor is a substitution registered by RegisterRedactor.
+type redactor struct {
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// redactors holds the substitutions registered by RegisterRedactor.
+var redactors struct {
+	mu   sync.RWMutex
+	list []redactor
+}
+
+// RegisterRedactor arranges for every match of re in the message of a log
+// line to be replaced by replacement, in which $1 and the like stand for
+// submatches as in regexp.Regexp.ReplaceAll. Redaction happens before the
+// line reaches hooks or any output, for instance
+//
+//	glog.RegisterRedactor(regexp.MustCompile(`Bearer [A-Za-z0-9._~+/-]+=*`), "Bearer REDACTED")
+//
+// The message includes the key/value pairs of InfoKV and the like; in
+// -log_format=json mode, only the values logged as strings, errors or
+// fmt.Stringers are redacted. Redactors apply in registration order, each to
+// the result of the previous ones.
+func RegisterRedactor(re *regexp.Regexp, replacement string) {
+	redactors.mu.Lock()
+	defer redactors.mu.Unlock()
+	redactors.list = append(redactors.list, redactor{re, []byte(replacement)})
+}
+
+// redactLine applies the registered redactors to the message in buf.
+func redactLine(buf *buffer) {
+	redactors.mu.RLock()
+	defer redactors.mu.RUnlock()
+	if len(redactors.list) == 0 {
+		return
+	}
+	msg := buf.Bytes()[buf.msg:]
+	newline := bytes.HasSuffix(msg, []byte{'\n'})
+	if newline {
+		msg = msg[:len(msg)-1]
+	}
+	redacted := redactBytes(msg)
+	buf.Truncate(buf.msg)
+	buf.Write(redacted)
+	if newline {
+		buf.WriteByte('\n')
+	}
+	if buf.json && len(buf.kv) > 0 {
+		kv := make([]interface{}, len(buf.kv))
+		copy(kv, buf.kv)
+		for i := 1; i < len(kv); i += 2 {
+			var s string
+			switch v := kv[i].(type) {
+			case string:
+				s = v
+			case error:
+				s = v.Error()
+			case fmt.Stringer:
+				s = v.String()
+			default:
+				continue
+			}
+			kv[i] = string(redactBytes([]byte(s)))
+		}
+		buf.kv = kv
+	}
+}
+
+// redactBytes applies the registered redactors to b. redactors.mu is held.
+func redactBytes(b []byte) []byte {
+	for _, r := range redactors.list {
+		b = r.re.ReplaceAll(b, r.replacement)
+	}
+	return b
+}
+
+// truncateLine cuts the message in buf to -log_max_line_bytes, at a UTF-8
+// character boundary, marking how many bytes it dropped.
+func truncateLine(buf *buffer) {
+	max := *maxLineBytes
+	msg := bytes.TrimSuffix(buf.Bytes()[buf.msg:], []byte{'\n'})
+	if max <= 0 || len(msg) <= max {
+		return
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(msg[n]) {
+		n--
+	}
+	dropped := len(msg) - n
+	buf.Truncate(buf.msg + n)
+	fmt.Fprintf(buf, "…(truncated %d bytes)\n", dropped)
+}
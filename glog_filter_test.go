@@ -0,0 +1,165 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// Test that -log_drop_regex drops the matching lines, and counts them.
+func TestDropRegex(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer dropPatterns.Set("")
+	if err := dropPatterns.Set("^benign warning,retrying in [0-9]+s$"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	dropped := Stats.Dropped.Lines()
+	Warning("benign warning from a library")
+	Warningf("retrying in %ds", 5)
+	Warning("a real benign warning")
+	InfoKV("benign warning", "k", "v")
+	if got := Stats.Dropped.Lines() - dropped; got != 3 {
+		t.Errorf("got %d dropped lines, want 3", got)
+	}
+	if contains(warningLog, "from a library", t) || contains(warningLog, "retrying", t) || contains(infoLog, "benign", t) {
+		t.Errorf("matching lines were written: %q %q", contents(warningLog), contents(infoLog))
+	}
+	if !contains(warningLog, "] a real benign warning\n", t) {
+		t.Errorf("non-matching line was dropped: %q", contents(warningLog))
+	}
+}
+
+// Test that -log_drop_regex matches the message in -log_format=json mode.
+func TestDropRegexJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	defer dropPatterns.Set("")
+	dropPatterns.Set("^noisy$")
+
+	Info("noisy")
+	Info("not noisy")
+	if contains(infoLog, `"msg":"noisy"`, t) || !contains(infoLog, `"msg":"not noisy"`, t) {
+		t.Errorf("got %q", contents(infoLog))
+	}
+}
+
+func TestDropRegexInvalid(t *testing.T) {
+	var r regexpList
+	if err := r.Set("ok,(unclosed"); err == nil {
+		t.Error("got nil error for an invalid regular expression")
+	}
+}
+
+// useRedactors registers redactors for an email address and a bearer token,
+// and returns a function that unregisters them.
+func useRedactors() func() {
+	redactors.mu.Lock()
+	previous := redactors.list
+	redactors.mu.Unlock()
+	RegisterRedactor(regexp.MustCompile(`[a-z.]+@([a-z.]+)`), "<email@$1>")
+	RegisterRedactor(regexp.MustCompile(`Bearer [A-Za-z0-9._-]+`), "Bearer REDACTED")
+	RegisterRedactor(regexp.MustCompile(`<email@example.com>`), "<email>") // Applies after the first.
+	return func() {
+		redactors.mu.Lock()
+		redactors.list = previous
+		redactors.mu.Unlock()
+	}
+}
+
+// Test that redactors mask the message before hooks and outputs see it.
+func TestRedactor(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useRedactors()()
+	defer resetHooks(logging.hooks)
+	var hooked string
+	AddHook(func(_ Severity, formatted []byte) { hooked = string(formatted) })
+
+	Infof("user jane.doe@example.com sent Authorization: Bearer abc.DEF-123")
+	want := "] user <email> sent Authorization: Bearer REDACTED\n"
+	if !strings.HasSuffix(contents(infoLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(infoLog), want)
+	}
+	if !strings.HasSuffix(hooked, want) {
+		t.Errorf("hook saw %q, want suffix %q", hooked, want)
+	}
+
+	WarningKV("login", "user", "joe@corp.example.org")
+	if want := "] login user=<email@corp.example.org>\n"; !strings.HasSuffix(contents(warningLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(warningLog), want)
+	}
+}
+
+// Test that redactors mask the message and string values in -log_format=json
+// mode.
+func TestRedactorJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	defer useRedactors()()
+
+	InfoKV("token Bearer xyz", "email", "a@b.c", "err", errors.New("bad Bearer q"), "n", 7)
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(infoLog), err)
+	}
+	for key, want := range map[string]interface{}{
+		"msg":   "token Bearer REDACTED",
+		"email": "<email@b.c>",
+		"err":   "bad Bearer REDACTED",
+		"n":     7.0,
+	} {
+		if got := entry[key]; got != want {
+			t.Errorf("%s: got %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+// Test that -log_max_line_bytes truncates long messages, at a character
+// boundary, with a mark of how much was dropped, and leaves short ones alone.
+func TestMaxLineBytes(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *maxLineBytes = previous }(*maxLineBytes)
+	*maxLineBytes = 100
+
+	Info(strings.Repeat("x", 10000))
+	line := contents(infoLog)
+	msg := line[strings.Index(line, "] ")+2:]
+	if want := strings.Repeat("x", 100) + "…(truncated 9900 bytes)\n"; msg != want {
+		t.Errorf("got message %q (%d bytes), want %q", msg, len(msg), want)
+	}
+
+	Warning(strings.Repeat("x", 99) + "é")
+	if want := "] " + strings.Repeat("x", 99) + "…(truncated 2 bytes)\n"; !strings.HasSuffix(contents(warningLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(warningLog), want)
+	}
+
+	Error("short")
+	if !strings.HasSuffix(contents(errorLog), "] short\n") {
+		t.Errorf("got %q, want the short line untouched", contents(errorLog))
+	}
+}
@@ -0,0 +1,240 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Templates for the header of text log lines.
+
+package glog
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHeaderTemplate is the header template that gives the built-in
+// header, as in "I0102 15:04:05.067890    1234 file.go:12] msg".
+const DefaultHeaderTemplate = "{sev}{time} {pid} {seq}{goroutine}{file}:{line}{func}{label}] {msg}"
+
+// logHeader is set by the -log_header_template flag and SetHeaderTemplate.
+var logHeader headerTemplateValue
+
+func init() {
+	flag.Var(&logHeader, "log_header_template", "template for the header of text log lines, from {sev}, {time}, {pid}, {seq}, {goroutine}, {file}, {line}, {func} and {label}, ending with {msg}")
+}
+
+// headerTemplate is a parsed header template: its text, and the literals
+// and placeholders it is made of, but for the final {msg}.
+type headerTemplate struct {
+	text  string
+	parts []patternPart
+}
+
+// headerPlaceholders are the placeholders a header template may use.
+var headerPlaceholders = map[string]bool{
+	"sev": true, "time": true, "pid": true, "seq": true, "goroutine": true,
+	"file": true, "line": true, "func": true, "label": true,
+}
+
+// parseHeaderTemplate parses text as a header template.
+func parseHeaderTemplate(text string) (*headerTemplate, error) {
+	if !strings.HasSuffix(text, "{msg}") {
+		return nil, fmt.Errorf("header template %q: must end with {msg}", text)
+	}
+	t := &headerTemplate{text: text}
+	for rest := strings.TrimSuffix(text, "{msg}"); rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if close := strings.IndexByte(rest, '}'); close >= 0 && (open < 0 || close < open) {
+			return nil, fmt.Errorf("header template %q: unmatched '}'", text)
+		}
+		if open < 0 {
+			t.parts = append(t.parts, patternPart{text: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, patternPart{text: rest[:open]})
+		}
+		rest = rest[open+1:]
+		close := strings.IndexByte(rest, '}')
+		if close < 0 {
+			return nil, fmt.Errorf("header template %q: unmatched '{'", text)
+		}
+		name := rest[:close]
+		rest = rest[close+1:]
+		if !headerPlaceholders[name] {
+			return nil, fmt.Errorf("header template %q: unknown placeholder {%s}", text, name)
+		}
+		t.parts = append(t.parts, patternPart{kind: name})
+	}
+	return t, nil
+}
+
+// render writes the header for a line of severity s logged at time now from
+// file:line, in function fn, to buf.
+func (t *headerTemplate) render(l *loggingT, buf *buffer, s Severity, now time.Time, file string, line int, fn string) {
+	for _, part := range t.parts {
+		switch part.kind {
+		case "":
+			buf.WriteString(part.text)
+		case "sev":
+			buf.WriteByte(buf.severityChar(s))
+		case "time":
+			buf.Write(buf.tmp[:buf.formatTime(0, now, timestampPrecisionDigits[l.precision.get()])])
+		case "pid":
+			buf.nDigits(7, 0, pid, ' ') // TODO: should be TID
+			buf.Write(buf.tmp[:7])
+		case "seq":
+			if l.seq {
+				buf.Write(append(strconv.AppendUint(append(buf.tmp[:0], '#'), nextSeq(), 10), ' '))
+			}
+		case "goroutine":
+			if l.goroutineID {
+				id := buf.goroutineID()
+				buf.Write(append(strconv.AppendUint(append(buf.tmp[:0], 'g'), id, 10), ' '))
+			}
+		case "file":
+			buf.WriteString(file)
+		case "line":
+			buf.Write(buf.tmp[:buf.someDigits(0, line)])
+		case "func":
+			if fn != "" {
+				buf.WriteByte(' ')
+				buf.WriteString(fn)
+			}
+		case "label":
+			if label := logLabel.get(); label != "" {
+				buf.WriteByte(' ')
+				buf.WriteString(label)
+			}
+		}
+	}
+}
+
+// severityIndex returns the index of the severity letter in data, a line
+// whose header was rendered from t, or -1 if t has no {sev} or data does not
+// follow it. {file} and {func} are taken to run up to the literal text that
+// follows them, as in filePattern.parseParts.
+func (t *headerTemplate) severityIndex(l *loggingT, data []byte) int {
+	i := 0
+	for n, part := range t.parts {
+		rest := data[i:]
+		switch part.kind {
+		case "":
+			if !bytes.HasPrefix(rest, []byte(part.text)) {
+				return -1
+			}
+			i += len(part.text)
+		case "sev":
+			return i
+		case "time":
+			i += 13
+			if digits := timestampPrecisionDigits[l.precision.get()]; digits > 0 {
+				i += 1 + digits
+			}
+		case "pid":
+			i += 7
+		case "line":
+			for i < len(data) && '0' <= data[i] && data[i] <= '9' {
+				i++
+			}
+		case "seq", "goroutine":
+			if part.kind == "seq" && l.seq || part.kind == "goroutine" && l.goroutineID {
+				end := bytes.IndexByte(rest, ' ')
+				if end < 0 {
+					return -1
+				}
+				i += end + 1
+			}
+		case "label":
+			if label := logLabel.get(); label != "" {
+				i += 1 + len(label)
+			}
+		default:
+			if n+1 == len(t.parts) || t.parts[n+1].kind != "" {
+				return -1
+			}
+			end := bytes.Index(rest, []byte(t.parts[n+1].text))
+			if end < 0 {
+				return -1
+			}
+			i += end
+		}
+		if i > len(data) {
+			return -1
+		}
+	}
+	return -1
+}
+
+// headerTemplateValue is the header template in use, or none for the
+// built-in header. It implements the flag.Value interface; the
+// -log_header_template flag is of type headerTemplateValue. It is replaced
+// atomically, so that it can be set while logging.
+type headerTemplateValue struct {
+	v atomic.Value // *headerTemplate
+}
+
+func (h *headerTemplateValue) get() *headerTemplate {
+	t, _ := h.v.Load().(*headerTemplate)
+	return t
+}
+
+// String is part of the flag.Value interface.
+func (h *headerTemplateValue) String() string {
+	if t := h.get(); t != nil {
+		return t.text
+	}
+	return ""
+}
+
+// Get is part of the flag.Getter interface.
+func (h *headerTemplateValue) Get() interface{} {
+	return h.String()
+}
+
+// Syntax: -log_header_template="{time} {sev} {file}:{line}: {msg}"
+func (h *headerTemplateValue) Set(value string) error {
+	if value == "" {
+		h.v.Store((*headerTemplate)(nil))
+		return nil
+	}
+	t, err := parseHeaderTemplate(value)
+	if err != nil {
+		return err
+	}
+	h.v.Store(t)
+	return nil
+}
+
+// SetHeaderTemplate sets the template for the header of text log lines from
+// now on, in which {sev} stands for the severity letter, A for Audit lines,
+// which -log_color colors on standard error, {time} for the time as in
+// "0102 15:04:05.067890", to the -log_timestamp_precision, {pid} for the
+// process ID, right-aligned in 7 columns, and {file} and {line} for the
+// caller. {seq}, {goroutine}, {func} and {label} stand for the fields of
+// -log_seq, -log_goroutine_id, -log_func_name and -log_label, with the
+// space that sets them apart, or for nothing when those are off. The
+// template must end with {msg}, the message. DefaultHeaderTemplate gives the
+// built-in header, as does an empty template. An invalid template returns an
+// error and changes nothing. It is the same as setting -log_header_template,
+// and may be called at any time; JSON lines and -log_no_header are not
+// affected.
+func SetHeaderTemplate(tmpl string) error {
+	return logHeader.Set(tmpl)
+}
@@ -0,0 +1,180 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useFixedHeader fixes the time and process ID in headers, and returns a
+// function that restores them and the built-in header.
+func useFixedHeader() func() {
+	previousNow, previousPID := timeNow, pid
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	}
+	pid = 1234
+	return func() {
+		timeNow, pid = previousNow, previousPID
+		SetHeaderTemplate("")
+	}
+}
+
+// Test that DefaultHeaderTemplate gives the built-in header, byte for byte,
+// with the optional fields on and off.
+func TestDefaultHeaderTemplate(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useFixedHeader()()
+	defer func(goroutineID, funcName bool) {
+		logging.goroutineID, logging.funcName = goroutineID, funcName
+	}(logging.goroutineID, logging.funcName)
+	defer SetLabel(logLabel.get())
+
+	logLine := func() { Info("built-in") } // Logs from the same line each time.
+	for _, extras := range []bool{false, true} {
+		logging.goroutineID, logging.funcName = extras, extras
+		SetLabel("")
+		if extras {
+			SetLabel("shard-1")
+		}
+		SetHeaderTemplate("")
+		logging.newBuffers()
+		logLine()
+		builtIn := contents(infoLog)
+		if err := SetHeaderTemplate(DefaultHeaderTemplate); err != nil {
+			t.Fatalf("SetHeaderTemplate(DefaultHeaderTemplate): %v", err)
+		}
+		logging.newBuffers()
+		logLine()
+		if got := contents(infoLog); got != builtIn {
+			t.Errorf("with optional fields %v, DefaultHeaderTemplate gave %q, want %q", extras, got, builtIn)
+		}
+	}
+}
+
+// Test that a template reorders and leaves out header fields.
+func TestHeaderTemplate(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useFixedHeader()()
+
+	if err := SetHeaderTemplate("{time} {sev} {file}:{line}: {msg}"); err != nil {
+		t.Fatalf("SetHeaderTemplate: %v", err)
+	}
+	_, _, line, _ := runtime.Caller(0)
+	Warning("reordered")
+	if want := fmt.Sprintf("0102 15:04:05.067890 W glog_header_test.go:%d: reordered\n", line+1); contents(warningLog) != want {
+		t.Errorf("got %q, want %q", contents(warningLog), want)
+	}
+
+	defer func(previous bool) { logging.seq = previous }(logging.seq)
+	logging.seq = true
+	SetHeaderTemplate("[{seq}{pid}] {msg}")
+	logging.newBuffers()
+	Info("first")
+	Info("second")
+	if want := fmt.Sprintf("[#%d    1234] first\n[#%d    1234] second\n", lineSeq-1, lineSeq); contents(infoLog) != want {
+		t.Errorf("got %q, want %q", contents(infoLog), want)
+	}
+}
+
+// Test that {sev} stands for the AUDIT letter in the header of an Audit line.
+func TestHeaderTemplateAudit(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer useAuditFile()()
+	defer useFixedHeader()()
+
+	if err := SetHeaderTemplate("{time} {sev} {msg}"); err != nil {
+		t.Fatalf("SetHeaderTemplate: %v", err)
+	}
+	Audit("hello")
+	data, err := ioutil.ReadFile(filepath.Join(dir, program+".AUDIT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "\n0102 15:04:05.067890 A hello\n"; !strings.HasSuffix(string(data), want) {
+		t.Errorf("AUDIT log file does not end with %q:\n%s", want, data)
+	}
+}
+
+// Test that -log_color colors the severity letter on standard error where
+// the template puts it, and colors nothing if the template has no {sev}.
+func TestHeaderTemplateColor(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useFixedHeader()()
+	defer logging.color.set(logging.color.get())
+	logging.color.set(colorAlways)
+	defer func(previous bool) { logging.alsoToStderr = previous }(logging.alsoToStderr)
+	logging.alsoToStderr = true
+	defer func(previous bool) { logging.seq = previous }(logging.seq)
+	logging.seq = true
+
+	if err := SetHeaderTemplate("{time} [{seq}{sev}] {file}:{line}: {msg}"); err != nil {
+		t.Fatalf("SetHeaderTemplate: %v", err)
+	}
+	stderr := captureStderr(t)
+	Warning("yellow")
+	Error("red")
+	got := stderr()
+	if !strings.Contains(got, " "+colorYellow+"W"+colorReset+"] ") || !strings.Contains(got, " "+colorRed+"E"+colorReset+"] ") {
+		t.Errorf("stderr: got %q, want WARNING yellow and ERROR red", got)
+	}
+	if c := contents(errorLog); strings.Contains(c, "\x1b[") {
+		t.Errorf("ERROR log: got %q, want no color", c)
+	}
+
+	SetHeaderTemplate("{file}:{line}: {msg}")
+	stderr = captureStderr(t)
+	Error("E is not the severity")
+	if got := stderr(); strings.Contains(got, "\x1b[") {
+		t.Errorf("stderr without {sev}: got %q, want no color", got)
+	}
+}
+
+// Test that invalid templates are refused and leave the header as it was.
+func TestHeaderTemplateInvalid(t *testing.T) {
+	defer useFixedHeader()()
+	const valid = "{sev} {msg}"
+	if err := SetHeaderTemplate(valid); err != nil {
+		t.Fatalf("SetHeaderTemplate(%q): %v", valid, err)
+	}
+	for _, tmpl := range []string{
+		"{sev} {file}",
+		"{msg} {sev}",
+		"{sev} {nope} {msg}",
+		"{sev {msg}",
+		"sev} {msg}",
+	} {
+		if err := SetHeaderTemplate(tmpl); err == nil {
+			t.Errorf("SetHeaderTemplate(%q) succeeded, want an error", tmpl)
+		}
+		if got := logHeader.String(); got != valid {
+			t.Errorf("after SetHeaderTemplate(%q), template is %q, want %q", tmpl, got, valid)
+		}
+	}
+}
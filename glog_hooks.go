@@ -0,0 +1,179 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Callbacks invoked as log lines are written.
+
+package glog
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// logHook is a callback registered by AddHook or AddHookForSeverity.
+type logHook struct {
+	min Severity // The least severe lines the hook sees.
+	fn  func(sev Severity, formatted []byte)
+}
+
+// AddHook registers fn to be called with every log line, formatted with its
+// header, before it is written. See AddHookForSeverity.
+func AddHook(fn func(sev Severity, formatted []byte)) {
+	AddHookForSeverity(infoLog, fn)
+}
+
+// AddHookForSeverity registers fn to be called with every log line of
+// severity min or above, formatted with its header, before it is written.
+// Hooks are called synchronously, in registration order, while the logging
+// lock is held, so they must be quick and must not log or flush. With
+// -log_async they are called by the goroutine that writes the queued lines.
+// The formatted slice is only valid for the duration of the call; a hook that
+// keeps it must copy it. A panic in a hook is recovered and reported to
+// standard error, and does not prevent other hooks from running.
+func AddHookForSeverity(min Severity, fn func(sev Severity, formatted []byte)) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.hooks = append(logging.hooks, logHook{min, fn})
+}
+
+// runHooks calls the registered hooks interested in a line of severity s.
+// l.mu is held.
+func (l *loggingT) runHooks(s Severity, data []byte) {
+	for _, h := range l.hooks {
+		if s.atLeast(h.min) {
+			h.call(s, data)
+		}
+	}
+}
+
+// call calls the hook, recovering from any panic.
+func (h logHook) call(s Severity, data []byte) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "log: hook panicked: %v\n", r)
+		}
+	}()
+	h.fn(s, data)
+}
+
+// RotateEvent describes the opening of a new log file, passed to the
+// callbacks registered by OnRotate.
+type RotateEvent struct {
+	Severity Severity // The severity whose log file it is.
+	OldName  string   // The path of the file closed, or empty if there was none.
+	NewName  string   // The path of the file opened.
+	Bytes    uint64   // The number of bytes written to the old file, not counting its banner.
+	// Reason is why the file was opened, as recorded in its banner:
+	// "startup", "size rotation", "time rotation" or "retry after a write
+	// error".
+	Reason string
+}
+
+// OnRotate registers fn to be called each time a log file is opened, whether
+// at startup or to replace a full or old one, once the new file is ready.
+// Callbacks are called synchronously, in registration order, while the
+// logging lock is held, so as with AddHook they must be quick and must not
+// log or flush. A panic in a callback is recovered and reported to standard
+// error, and does not prevent other callbacks from running.
+func OnRotate(fn func(ev RotateEvent)) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.rotateHooks = append(logging.rotateHooks, fn)
+}
+
+// runRotateHooks calls the callbacks registered by OnRotate with ev.
+// l.mu is held.
+func (l *loggingT) runRotateHooks(ev RotateEvent) {
+	for _, fn := range l.rotateHooks {
+		callRotateHook(fn, ev)
+	}
+}
+
+// callRotateHook calls fn with ev, recovering from any panic.
+func callRotateHook(fn func(RotateEvent), ev RotateEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "log: rotate hook panicked: %v\n", r)
+		}
+	}()
+	fn(ev)
+}
+
+// exitHooks are the functions registered by RegisterExitHook.
+var exitHooks struct {
+	sync.Mutex
+	fns []func()
+}
+
+// exiting is non-zero once a Fatal or Exit call has begun running the exit hooks.
+var exiting uint32
+
+// RegisterExitHook registers fn to be called by Fatal, Exit and their
+// relatives after the final message (and any stack trace) has been logged
+// and before the process exits, for instance to flush metrics or close a
+// database. Hooks run in the reverse order of registration and may log.
+// A panic in a hook is recovered and reported to standard error. Hooks are
+// given what is left of the -log_fatal_timeout in total, or as long as they
+// take if it is not positive; any still running then are abandoned. A call
+// to Fatal from within a hook logs its message and ends the hook, but the
+// remaining hooks still run.
+func RegisterExitHook(fn func()) {
+	exitHooks.Lock()
+	defer exitHooks.Unlock()
+	exitHooks.fns = append(exitHooks.fns, fn)
+}
+
+// runExitHooks calls the exit hooks in reverse order of registration,
+// returning once they have finished or timeout, if positive, has elapsed.
+// If the hooks are already running, the calling goroutine is a hook that
+// called Fatal, so it is ended without returning.
+func runExitHooks(timeout time.Duration) {
+	if !atomic.CompareAndSwapUint32(&exiting, 0, 1) {
+		runtime.Goexit()
+	}
+	exitHooks.Lock()
+	fns := append([]func(){}, exitHooks.fns...)
+	exitHooks.Unlock()
+
+	var deadline <-chan time.Time // Never ready if timeout is not positive.
+	if timeout > 0 {
+		deadline = time.After(timeout)
+	}
+	for i := len(fns) - 1; i >= 0; i-- {
+		// Each hook gets its own goroutine so that one that calls Fatal,
+		// and so is ended by runtime.Goexit, does not stop the rest.
+		done := make(chan bool)
+		go func(fn func()) {
+			defer close(done)
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Fprintf(os.Stderr, "log: exit hook panicked: %v\n", r)
+				}
+			}()
+			fn()
+		}(fns[i])
+		select {
+		case <-done:
+		case <-deadline:
+			fmt.Fprintln(os.Stderr, "glog: exit hooks took longer than", timeout)
+			return
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// resetHooks removes the hooks registered by a test.
+func resetHooks(previous []logHook) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	logging.hooks = previous
+}
+
+// Test that hooks see the formatted lines at or above their severity, and
+// keep running when another hook panics.
+func TestHooks(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer resetHooks(logging.hooks)
+
+	var all, errs []string
+	AddHookForSeverity(warningLog, func(Severity, []byte) { panic("boom") })
+	AddHook(func(s Severity, formatted []byte) {
+		all = append(all, string(severityChar[s])+":"+string(formatted))
+	})
+	AddHookForSeverity(errorLog, func(s Severity, formatted []byte) {
+		errs = append(errs, string(formatted))
+	})
+
+	Info("info")
+	Warning("warning")
+	Error("error")
+
+	if len(all) != 3 {
+		t.Fatalf("AddHook saw %d lines, want 3: %q", len(all), all)
+	}
+	for i, want := range []string{"info", "warning", "error"} {
+		if !strings.HasPrefix(all[i], strings.ToUpper(want[:1])+":"+strings.ToUpper(want[:1])) || !strings.HasSuffix(all[i], "] "+want+"\n") {
+			t.Errorf("line %d: got %q", i, all[i])
+		}
+	}
+	if len(errs) != 1 || !strings.HasSuffix(errs[0], "] error\n") {
+		t.Errorf("ERROR hook saw %q", errs)
+	}
+	if !contains(errorLog, "error", t) {
+		t.Error("panicking hook stopped the line from being written")
+	}
+}
+
+// Test that exit hooks run in reverse order after a Fatal, survive panicking
+// and re-entrant hooks, and leave the exit status alone. The test re-runs
+// itself in a subprocess, which does the logging.
+func TestExitHooks(t *testing.T) {
+	if os.Getenv("GLOG_TEST_EXIT_HOOKS") == "1" {
+		RegisterExitHook(func() { fmt.Fprintln(os.Stderr, "hook A") })
+		RegisterExitHook(func() { panic("hook B") })
+		RegisterExitHook(func() { Fatal("hook C") })
+		RegisterExitHook(func() { fmt.Fprintln(os.Stderr, "hook D") })
+		Fatal("fatal")
+		return
+	}
+	cmd := testSubprocess("TestExitHooks", "GLOG_TEST_EXIT_HOOKS=1", "-logtostderr")
+	out, err := cmd.CombinedOutput()
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("subprocess did not fail: %v\n%s", err, out)
+	}
+	if code := exitErr.ExitCode(); code != 255 {
+		t.Errorf("got exit code %d, want 255", code)
+	}
+	output := string(out)
+	last := -1
+	for _, want := range []string{"] fatal", "hook D", "] hook C", "exit hook panicked: hook B", "hook A"} {
+		i := strings.Index(output, want)
+		if i < 0 {
+			t.Errorf("output is missing %q:\n%s", want, output)
+			continue
+		}
+		if i < last {
+			t.Errorf("%q is out of order:\n%s", want, output)
+		}
+		last = i
+	}
+}
+
+// Test that OnRotate callbacks see each new log file, with the name and size
+// of the one it replaces, and keep running when another callback panics.
+func TestOnRotate(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer func(previous []func(RotateEvent)) {
+		logging.mu.Lock()
+		defer logging.mu.Unlock()
+		logging.rotateHooks = previous
+	}(logging.rotateHooks)
+	defer func(previous uint64) { MaxSize = previous }(MaxSize)
+	MaxSize = 1024
+
+	var events []RotateEvent
+	OnRotate(func(RotateEvent) { panic("rotate hook") })
+	OnRotate(func(ev RotateEvent) { events = append(events, ev) })
+	stderr := captureStderr(t)
+	Info("first file")
+	sb := logging.file[infoLog].(*syncBuffer)
+	first, written := sb.file.Name(), sb.nbytes
+	Info(strings.Repeat("x", 1024))
+	second := sb.file.Name()
+	if got := stderr(); !strings.Contains(got, "rotate hook panicked: rotate hook") {
+		t.Errorf("panic not reported: %q", got)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	if ev := events[0]; ev.OldName != "" || ev.NewName != first || ev.Reason != openedStartup || ev.Severity != infoLog {
+		t.Errorf("first event: got %+v, want a startup opening of %s", ev, first)
+	}
+	if ev := events[1]; ev.OldName != first || ev.NewName != second || ev.Bytes != written || ev.Reason != openedSize || ev.Severity != infoLog {
+		t.Errorf("second event: got %+v, want a size rotation from %s (%d bytes) to %s", ev, first, written, second)
+	}
+}
@@ -0,0 +1,114 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// HTTP handlers for reading the recent log lines and setting V levels.
+
+package glog
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// maxHTTPForm bounds the size of the form VModuleHandler reads.
+const maxHTTPForm = 4096
+
+// LogTailHandler returns an http.Handler that writes, as plain text, the
+// recent lines kept since EnableRingBuffer, oldest first. A query parameter n
+// limits them to the n most recent. It answers 404 Not Found if
+// EnableRingBuffer is not in effect.
+func LogTailHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		lines := RecentLines()
+		if lines == nil {
+			http.Error(w, "no recent log lines are kept: EnableRingBuffer has not been called", http.StatusNotFound)
+			return
+		}
+		if s := r.URL.Query().Get("n"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				http.Error(w, fmt.Sprintf("invalid n %q: want a non-negative number of lines", s), http.StatusBadRequest)
+				return
+			}
+			if n < len(lines) {
+				lines = lines[len(lines)-n:]
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range lines {
+			io.WriteString(w, line)
+		}
+	})
+}
+
+// VModuleHandler returns an http.Handler that shows and sets the V logging
+// levels. A GET writes the current -v and -vmodule settings, as plain text
+// lines v=N and vmodule=pattern=N,... A POST sets them from its form values v
+// and vmodule, of the syntax of the flags, with SetVerbosity and SetVModule;
+// an absent value is left unchanged, and if either is invalid neither is
+// changed. The POST then writes the new settings as a GET does.
+func VModuleHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			r.Body = http.MaxBytesReader(w, r.Body, maxHTTPForm)
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, fmt.Sprintf("invalid form: %v", err), http.StatusBadRequest)
+				return
+			}
+			if err := setVFromForm(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "v=%d\nvmodule=%s\n", VerbosityLevel(), logging.vmodule.String())
+	})
+}
+
+// setVFromForm applies the v and vmodule values of the parsed form of r, if
+// present, checking both before changing either.
+func setVFromForm(r *http.Request) error {
+	level := -1
+	if s, ok := r.PostForm["v"]; ok {
+		v, err := strconv.ParseInt(s[0], 10, 32)
+		if err != nil || v < 0 {
+			return fmt.Errorf("invalid v %q: want a non-negative level", s[0])
+		}
+		level = int(v)
+	}
+	if s, ok := r.PostForm["vmodule"]; ok {
+		if err := SetVModule(s[0]); err != nil {
+			return fmt.Errorf("invalid vmodule %q: %v", s[0], err)
+		}
+	}
+	if level >= 0 {
+		SetVerbosity(level)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Test that LogTailHandler writes the kept lines, or the last n of them.
+func TestLogTailHandler(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer EnableRingBuffer(0)
+	h := LogTailHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/logs", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET without a ring buffer: got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	EnableRingBuffer(10)
+	Info("first")
+	Warning("second")
+	Error("third")
+	for _, test := range []struct {
+		query string
+		code  int
+		want  []string
+	}{
+		{"", http.StatusOK, []string{"first", "second", "third"}},
+		{"?n=2", http.StatusOK, []string{"second", "third"}},
+		{"?n=100", http.StatusOK, []string{"first", "second", "third"}},
+		{"?n=-1", http.StatusBadRequest, nil},
+		{"?n=lots", http.StatusBadRequest, nil},
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/logs"+test.query, nil))
+		if rec.Code != test.code {
+			t.Errorf("GET %q: got status %d, want %d", test.query, rec.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		lines := strings.SplitAfter(rec.Body.String(), "\n")
+		if len(lines) != len(test.want)+1 {
+			t.Errorf("GET %q: got %q, want %d lines", test.query, rec.Body.String(), len(test.want))
+			continue
+		}
+		for i, msg := range test.want {
+			if !strings.HasSuffix(lines[i], "] "+msg+"\n") {
+				t.Errorf("GET %q: line %d is %q, want message %q", test.query, i, lines[i], msg)
+			}
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/debug/logs", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: got status %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// postForm serves a POST of the form values to h.
+func postForm(h http.Handler, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/debug/vmodule", strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// Test that VModuleHandler shows the V levels and changes them on a valid
+// POST, and only then.
+func TestVModuleHandler(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVerbosity(VerbosityLevel())
+	SetVerbosity(0)
+	defer logging.vmodule.Set("")
+	h := VModuleHandler()
+
+	rec := postForm(h, url.Values{"v": {"2"}})
+	if rec.Code != http.StatusOK || rec.Body.String() != "v=2\nvmodule=\n" {
+		t.Errorf("POST v=2: got %d %q", rec.Code, rec.Body.String())
+	}
+	if !V(2) || V(3) {
+		t.Errorf("after POST v=2: V(2) = %v, V(3) = %v", bool(V(2)), bool(V(3)))
+	}
+
+	rec = postForm(h, url.Values{"vmodule": {"glog_http_test=5"}})
+	if rec.Code != http.StatusOK || rec.Body.String() != "v=2\nvmodule=glog_http_test=5\n" {
+		t.Errorf("POST vmodule: got %d %q", rec.Code, rec.Body.String())
+	}
+	if !V(5) {
+		t.Error("after POST vmodule=glog_http_test=5: V(5) is false in glog_http_test.go")
+	}
+
+	for _, values := range []url.Values{
+		{"v": {"-1"}},
+		{"v": {"loud"}},
+		{"v": {"9"}, "vmodule": {"glog_http_test"}},
+		{"v": {strings.Repeat("9", maxHTTPForm)}},
+	} {
+		if rec := postForm(h, values); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %v: got status %d, want %d", values, rec.Code, http.StatusBadRequest)
+		}
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vmodule", nil))
+	if rec.Body.String() != "v=2\nvmodule=glog_http_test=5\n" {
+		t.Errorf("GET after invalid POSTs: got %q, want the settings unchanged", rec.Body.String())
+	}
+}
@@ -0,0 +1,67 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// A static label in every log line, to tell apart instances of a program.
+
+package glog
+
+import (
+	"flag"
+	"sync/atomic"
+)
+
+// logLabel is set by the -log_label flag and by SetLabel.
+var logLabel labelValue
+
+func init() {
+	flag.Var(&logLabel, "log_label", "label to write in the header of every log line, such as the role of this instance")
+}
+
+// labelValue is a label for log lines. It implements the flag.Value
+// interface; the -log_label flag is of type labelValue. It is replaced
+// atomically, so that it can be set while logging.
+type labelValue struct {
+	v atomic.Value // string
+}
+
+func (l *labelValue) get() string {
+	label, _ := l.v.Load().(string)
+	return label
+}
+
+// String is part of the flag.Value interface.
+func (l *labelValue) String() string {
+	return l.get()
+}
+
+// Get is part of the flag.Getter interface.
+func (l *labelValue) Get() interface{} {
+	return l.get()
+}
+
+// Syntax: -log_label=shard-1
+func (l *labelValue) Set(value string) error {
+	l.v.Store(value)
+	return nil
+}
+
+// SetLabel sets the label written in the header of every log line from now
+// on, after the file and line number, as in "file.go:12 shard-1]", and as
+// the "label" field of JSON lines; an empty label writes none. It is the
+// same as setting -log_label, and may be called at any time.
+func SetLabel(label string) {
+	logLabel.Set(label)
+}
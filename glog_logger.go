@@ -0,0 +1,115 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Loggers bound to key/value pairs, for request-scoped logging.
+
+package glog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Logger logs lines that carry the key/value pairs it was made With, such
+// as the ID of the request being served, so that they need not be passed to
+// every logging call. A nil *Logger carries none. Loggers are immutable, and
+// may be shared between goroutines.
+type Logger struct {
+	kv []interface{} // Alternating keys and values, without duplicate keys.
+}
+
+// With returns a Logger whose lines carry the alternating keys and values in
+// kv. A key without a value is given the value "(MISSING)".
+func With(kv ...interface{}) *Logger {
+	return (*Logger)(nil).With(kv...)
+}
+
+// With returns a Logger whose lines carry the key/value pairs of lg and
+// those in kv. A key in kv that lg has already replaces its value there.
+func (lg *Logger) With(kv ...interface{}) *Logger {
+	var merged []interface{}
+	if lg != nil {
+		merged = append(merged, lg.kv...)
+	}
+	for i := 0; i < len(kv); i += 2 {
+		key, value := kv[i], kvValue(kv, i+1)
+		if j := fieldIndex(merged, key); j >= 0 {
+			merged[j+1] = value
+		} else {
+			merged = append(merged, key, value)
+		}
+	}
+	return &Logger{kv: merged}
+}
+
+// fieldIndex returns the index of key among the keys of kv, or -1. Keys are
+// compared as they are written.
+func fieldIndex(kv []interface{}, key interface{}) int {
+	name := fmt.Sprint(key)
+	for i := 0; i < len(kv); i += 2 {
+		if fmt.Sprint(kv[i]) == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Info logs to the INFO log, as Info does, with the key/value pairs of lg
+// before the message, or as fields in -log_format=json mode.
+func (lg *Logger) Info(args ...interface{}) {
+	lg.print(infoLog, args)
+}
+
+// Warning logs to the WARNING and INFO logs, as Warning does, with the
+// key/value pairs of lg before the message, or as fields in
+// -log_format=json mode.
+func (lg *Logger) Warning(args ...interface{}) {
+	lg.print(warningLog, args)
+}
+
+// Error logs to the ERROR, WARNING, and INFO logs, as Error does, with the
+// key/value pairs of lg before the message, or as fields in
+// -log_format=json mode.
+func (lg *Logger) Error(args ...interface{}) {
+	lg.print(errorLog, args)
+}
+
+// print formats args in the manner of fmt.Print and logs them at s with the
+// key/value pairs of lg.
+func (lg *Logger) print(s Severity, args []interface{}) {
+	buf, file, line := logging.header(s, 0)
+	msg := strings.TrimSuffix(fmt.Sprint(args...), "\n")
+	if buf.json || lg == nil || len(lg.kv) == 0 {
+		logging.outputKV(s, buf, file, line, msg, lg.fields())
+		return
+	}
+	fields := logging.getBuffer()
+	writeKV(fields, lg.kv)
+	buf.Write(fields.Bytes()[1:]) // Without the space before the first key.
+	logging.putBuffer(fields)
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	buf.WriteByte('\n')
+	logging.output(s, buf, file, line, false)
+}
+
+// fields returns the key/value pairs of lg.
+func (lg *Logger) fields() []interface{} {
+	if lg == nil {
+		return nil
+	}
+	return lg.kv
+}
@@ -0,0 +1,90 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Test that a Logger's lines carry its key/value pairs before the message,
+// and name the caller of its methods.
+func TestWith(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	lg := With("request_id", "r1", "user", "bob smith")
+	_, _, line, _ := runtime.Caller(0)
+	lg.Info("started")
+	lg.Warning("slow")
+	lg.Error("failed")
+	if want := fmt.Sprintf("glog_logger_test.go:%d] request_id=r1 user=\"bob smith\" started\n", line+1); !contains(infoLog, want, t) {
+		t.Errorf("got %q, want %q", contents(infoLog), want)
+	}
+	if want := `] request_id=r1 user="bob smith" slow` + "\n"; !contains(warningLog, want, t) {
+		t.Errorf("got %q, want %q", contents(warningLog), want)
+	}
+	if want := `] request_id=r1 user="bob smith" failed` + "\n"; !contains(errorLog, want, t) {
+		t.Errorf("got %q, want %q", contents(errorLog), want)
+	}
+
+	logging.newBuffers()
+	(*Logger)(nil).Info("no fields")
+	if want := "] no fields\n"; !contains(infoLog, want, t) {
+		t.Errorf("got %q, want %q", contents(infoLog), want)
+	}
+}
+
+// Test that a nested With adds its pairs to those of its parent, replacing
+// the values of keys they share, and leaves the parent as it was.
+func TestWithNested(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	parent := With("request_id", "r1", "user", "bob")
+	child := parent.With("user", "alice", "step", 2, "dangling")
+	child.Info("child")
+	parent.Info("parent")
+	got := messages(infoLog)
+	want := []string{
+		"request_id=r1 user=alice step=2 dangling=(MISSING) child",
+		"request_id=r1 user=bob parent",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got lines %q, want %q", got, want)
+	}
+}
+
+// Test that a Logger's pairs are fields in -log_format=json mode.
+func TestWithJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+
+	With("request_id", "r1").With("attempt", 3).Info("retry")
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(infoLog), err)
+	}
+	if entry["msg"] != "retry" || entry["request_id"] != "r1" || entry["attempt"] != float64(3) {
+		t.Errorf("got %v, want msg retry, request_id r1 and attempt 3", entry)
+	}
+}
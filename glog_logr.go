@@ -0,0 +1,108 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// An implementation of the go-logr LogSink interface on top of the Google logs.
+
+package glog
+
+import (
+	"github.com/go-logr/logr"
+)
+
+// logrSink is a logr.LogSink that writes to the Google logs. Its fields are
+// never modified once it is returned, so it is safe for concurrent use.
+type logrSink struct {
+	depth int           // Extra stack frames to skip to find the caller.
+	name  string        // The name from WithName, prefixed to each message.
+	kv    []interface{} // Key/value pairs from WithValues.
+}
+
+var (
+	_ logr.LogSink          = (*logrSink)(nil)
+	_ logr.CallDepthLogSink = (*logrSink)(nil)
+)
+
+// NewLogrSink returns a logr.LogSink that writes to the Google logs, so that
+//
+//	logger := logr.New(glog.NewLogrSink())
+//
+// logs through the files, flags and rotation of this package. logger.V(n).Info
+// is logged to INFO if V(n) is enabled, and logger.Error to ERROR with the
+// error appended as err=... . Names from WithName prefix each message, and
+// values from WithValues precede the key/value pairs of each call.
+func NewLogrSink() logr.LogSink {
+	return &logrSink{}
+}
+
+// Init is part of the logr.LogSink interface.
+func (l *logrSink) Init(info logr.RuntimeInfo) {
+	l.depth += info.CallDepth
+}
+
+// Enabled is part of the logr.LogSink interface. It reports whether the
+// V level is at least level.
+func (l *logrSink) Enabled(level int) bool {
+	return logging.verbosity.get() >= Level(level)
+}
+
+// Info is part of the logr.LogSink interface.
+func (l *logrSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	logging.printKV(infoLog, l.depth, l.message(msg), l.values(keysAndValues)...)
+}
+
+// Error is part of the logr.LogSink interface.
+func (l *logrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	kv := append(l.values(keysAndValues), "err", err)
+	logging.printKV(errorLog, l.depth, l.message(msg), kv...)
+}
+
+// WithValues is part of the logr.LogSink interface.
+func (l *logrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	l2 := *l
+	l2.kv = l.values(keysAndValues)
+	return &l2
+}
+
+// WithName is part of the logr.LogSink interface. Nested names are
+// joined with slashes.
+func (l *logrSink) WithName(name string) logr.LogSink {
+	l2 := *l
+	if l.name != "" {
+		name = l.name + "/" + name
+	}
+	l2.name = name
+	return &l2
+}
+
+// WithCallDepth is part of the logr.CallDepthLogSink interface.
+func (l *logrSink) WithCallDepth(depth int) logr.LogSink {
+	l2 := *l
+	l2.depth += depth
+	return &l2
+}
+
+// message returns msg with the sink's name, if any, prefixed.
+func (l *logrSink) message(msg string) string {
+	if l.name == "" {
+		return msg
+	}
+	return l.name + ": " + msg
+}
+
+// values returns a new slice holding the sink's values followed by kv.
+func (l *logrSink) values(kv []interface{}) []interface{} {
+	return append(append([]interface{}(nil), l.kv...), kv...)
+}
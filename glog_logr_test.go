@@ -0,0 +1,77 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+// Test that logr Info calls are logged to INFO with names and values.
+func TestLogrInfo(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logger := logr.New(NewLogrSink()).WithName("server").WithValues("port", 80)
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.WithName("http").Info("listening", "tls", false)
+	if want := fmt.Sprintf(" glog_logr_test.go:%d] server/http: listening port=80 tls=false\n", line+1); !strings.HasSuffix(contents(infoLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(infoLog), want)
+	}
+}
+
+// Test that logr Error calls are logged to ERROR with the error appended.
+func TestLogrError(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logger := logr.New(NewLogrSink()).WithValues("id", 7)
+
+	logger.Error(errors.New("no such file"), "open failed", "path", "/tmp/x")
+	if !strings.HasPrefix(contents(errorLog), "E") {
+		t.Errorf("Error has wrong character: %q", contents(errorLog))
+	}
+	if want := `] open failed id=7 path=/tmp/x err="no such file"` + "\n"; !strings.HasSuffix(contents(errorLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(errorLog), want)
+	}
+}
+
+// Test that logr verbosity follows the V level.
+func TestLogrEnabled(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVerbosity(VerbosityLevel())
+	logger := logr.New(NewLogrSink())
+
+	SetVerbosity(1)
+	logger.V(2).Info("hidden")
+	if contents(infoLog) != "" {
+		t.Errorf("V(2) logged at V=1: %q", contents(infoLog))
+	}
+	if !logger.V(1).Enabled() || logger.V(2).Enabled() {
+		t.Error("Enabled does not follow the V level")
+	}
+	SetVerbosity(2)
+	logger.V(2).Info("shown")
+	if !strings.HasSuffix(contents(infoLog), "] shown\n") {
+		t.Errorf("V(2) not logged at V=2: %q", contents(infoLog))
+	}
+}
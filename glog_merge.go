@@ -0,0 +1,105 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reading back the log files of earlier runs and rotations.
+
+package glog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergeLogs writes the contents of the log files for tag in dir to w, one
+// after the other from the oldest to the newest, to give the whole timeline of
+// a log that has been rotated. The files are those that deleteOldLogFile
+// would consider, found by the -log_file_pattern; they are ordered by the
+// start time in their names, or by their modification times if the pattern
+// has no placeholder for the time. Files compressed by -log_compress are
+// decompressed.
+func MergeLogs(dir, tag string, w io.Writer) error {
+	files := matchingLogFiles(dir, tag)
+	keys := make([]mergeKey, len(files))
+	for i, f := range files {
+		keys[i] = mergeKeyOf(f)
+	}
+	sort.Sort(byMergeKey{files, keys})
+	for _, f := range files {
+		if err := copyLogFile(w, filepath.Join(f.dir, f.info.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLogFile writes the contents of the log file name to w, decompressing
+// it if it has been compressed.
+func copyLogFile(w io.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, compressedSuffix) {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// mergeKey orders a log file among the others for MergeLogs.
+type mergeKey struct {
+	start time.Time // The start time in the name, or failing that the modification time.
+	n     int       // The number added by uniqueName, if any.
+}
+
+// mergeKeyOf returns the key of the log file f.
+func mergeKeyOf(f logFile) mergeKey {
+	key := mergeKey{start: f.info.ModTime()}
+	if fields, err := logFilePattern.parse(f.info.Name()); err == nil && !fields.start.IsZero() {
+		key.start, key.n = fields.start, fields.n
+	}
+	return key
+}
+
+// byMergeKey sorts log files by their mergeKeys.
+type byMergeKey struct {
+	files []logFile
+	keys  []mergeKey
+}
+
+func (b byMergeKey) Len() int { return len(b.files) }
+func (b byMergeKey) Less(i, j int) bool {
+	if !b.keys[i].start.Equal(b.keys[j].start) {
+		return b.keys[i].start.Before(b.keys[j].start)
+	}
+	return b.keys[i].n < b.keys[j].n
+}
+func (b byMergeKey) Swap(i, j int) {
+	b.files[i], b.files[j] = b.files[j], b.files[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
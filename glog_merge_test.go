@@ -0,0 +1,76 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that MergeLogs concatenates the log files in the order of the start
+// times in their names, whatever their modification times, decompressing the
+// compressed ones.
+func TestMergeLogs(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.Local)
+	for i, f := range []struct {
+		age      time.Duration
+		n        int
+		content  string
+		compress bool
+	}{
+		{0, 0, "newest\n", false},
+		{2 * time.Hour, 0, "oldest\n", true},
+		{time.Hour, 1, "middle, second\n", false},
+		{time.Hour, 0, "middle, first\n", true},
+	} {
+		name, _ := logName(severityName[infoLog], start.Add(-f.age))
+		path := filepath.Join(dir, uniqueName(name, f.n))
+		if err := ioutil.WriteFile(path, []byte(f.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if f.compress {
+			if err := compressLogFile(path); err != nil {
+				t.Fatal(err)
+			}
+			path += compressedSuffix
+		}
+		// Modification times in the opposite order, which must not matter.
+		mtime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "unrelated.txt"), []byte("unrelated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := MergeLogs(dir, severityName[infoLog], &b); err != nil {
+		t.Fatalf("MergeLogs: %v", err)
+	}
+	if want := "oldest\nmiddle, first\nmiddle, second\nnewest\n"; b.String() != want {
+		t.Errorf("MergeLogs wrote %q, want %q", b.String(), want)
+	}
+}
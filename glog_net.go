@@ -0,0 +1,220 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Sending log lines to a remote collector over the network.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// networkOnly is set by the -log_network_only flag.
+var networkOnly = flag.Bool("log_network_only", false, "If true, send log lines only to the collector installed by SetNetworkOutput, not to log files")
+
+const (
+	// netQueueSize bounds the number of lines waiting to be sent to the
+	// collector. Lines logged while the queue is full are dropped.
+	netQueueSize = 4096
+	// netMinBackoff and netMaxBackoff bound the wait between attempts to
+	// reconnect to the collector.
+	netMinBackoff = 100 * time.Millisecond
+	netMaxBackoff = 10 * time.Second
+)
+
+// netDropped counts the lines that could not be queued for the collector.
+var netDropped uint64
+
+// NetworkDropped returns the number of log lines that were dropped because
+// the network collector installed by SetNetworkOutput could not keep up.
+func NetworkDropped() uint64 {
+	return atomic.LoadUint64(&netDropped)
+}
+
+// SetNetworkOutput sends every log line, formatted with its header, to the
+// collector at addr over network, which must be "tcp" or "udp" (or one of
+// their "4" and "6" variants), in addition to the log files or, with
+// -log_network_only, instead of them. The collector is dialled once before
+// SetNetworkOutput returns, and any error is reported.
+//
+// Lines are queued and sent in the background, so logging never waits for
+// the network. If the connection is lost it is re-established with
+// exponential backoff; lines that do not fit in the queue meanwhile are
+// dropped and counted by NetworkDropped. Calling SetNetworkOutput again
+// replaces the collector, and calling it with an empty addr stops sending.
+func SetNetworkOutput(network, addr string) error {
+	var sink *netSink
+	if addr != "" {
+		switch network {
+		case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		default:
+			return fmt.Errorf("log: unsupported network %q for SetNetworkOutput", network)
+		}
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return fmt.Errorf("log: cannot connect to collector: %v", err)
+		}
+		sink = newNetSink(network, addr, conn)
+	}
+	setNetSink(sink)
+	return nil
+}
+
+// setNetSink installs sink, which may be nil, in place of the current
+// collector, and stops that.
+func setNetSink(sink *netSink) {
+	logging.mu.Lock()
+	previous := logging.net
+	logging.net = sink
+	logging.mu.Unlock()
+	if previous != nil {
+		previous.stop()
+	}
+}
+
+// netSink sends queued log lines to a collector.
+type netSink struct {
+	network, addr string
+	queue         chan []byte
+	done          chan struct{}
+
+	mu   sync.Mutex // Protects conn, so that stop can interrupt a write.
+	conn net.Conn
+}
+
+func newNetSink(network, addr string, conn net.Conn) *netSink {
+	n := &netSink{
+		network: network,
+		addr:    addr,
+		queue:   make(chan []byte, netQueueSize),
+		done:    make(chan struct{}),
+		conn:    conn,
+	}
+	go n.run()
+	return n
+}
+
+// send queues a copy of data without blocking, or drops it if the queue is
+// full.
+func (n *netSink) send(data []byte) {
+	select {
+	case n.queue <- append([]byte(nil), data...):
+	default:
+		atomic.AddUint64(&netDropped, 1)
+	}
+}
+
+// stop ends the background sender and closes the connection.
+func (n *netSink) stop() {
+	close(n.done)
+	n.mu.Lock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.mu.Unlock()
+}
+
+// run sends the queued lines until stop is called, reconnecting as needed.
+// A line whose write fails is sent again once the connection is restored.
+func (n *netSink) run() {
+	backoff := netMinBackoff
+	for {
+		var line []byte
+		select {
+		case <-n.done:
+			return
+		case line = <-n.queue:
+		}
+		for {
+			conn := n.connect(&backoff)
+			if conn == nil {
+				return
+			}
+			if err := writeLine(conn, line); err == nil {
+				break
+			}
+			n.disconnect(conn)
+		}
+	}
+}
+
+// writeLine writes all of line to conn, going on after a short write. After
+// an error the whole line is to be sent again, over a new connection.
+func writeLine(conn net.Conn, line []byte) error {
+	for len(line) > 0 {
+		n, err := conn.Write(line)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return io.ErrShortWrite
+		}
+		line = line[n:]
+	}
+	return nil
+}
+
+// connect returns the current connection, dialling the collector with
+// backoff if there is none. It returns nil once stop has been called.
+func (n *netSink) connect(backoff *time.Duration) net.Conn {
+	for {
+		n.mu.Lock()
+		conn := n.conn
+		n.mu.Unlock()
+		if conn != nil {
+			return conn
+		}
+		select {
+		case <-n.done:
+			return nil
+		case <-time.After(*backoff):
+		}
+		conn, err := net.Dial(n.network, n.addr)
+		if err != nil {
+			if *backoff *= 2; *backoff > netMaxBackoff {
+				*backoff = netMaxBackoff
+			}
+			continue
+		}
+		*backoff = netMinBackoff
+		n.mu.Lock()
+		select {
+		case <-n.done:
+			n.mu.Unlock()
+			conn.Close()
+			return nil
+		default:
+		}
+		n.conn = conn
+		n.mu.Unlock()
+	}
+}
+
+// disconnect closes conn after a failed write, so that connect dials anew.
+func (n *netSink) disconnect(conn net.Conn) {
+	conn.Close()
+	n.mu.Lock()
+	if n.conn == conn {
+		n.conn = nil
+	}
+	n.mu.Unlock()
+}
@@ -0,0 +1,188 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listen starts a TCP listener on the loopback interface.
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// readLine reads a line from conn, failing the test after a timeout.
+func readLine(t *testing.T, r *bufio.Reader, conn net.Conn) string {
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading from collector: %v", err)
+	}
+	return line
+}
+
+// Test that lines arrive at the collector as well as in the log files.
+func TestNetworkOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	l := listen(t)
+	defer l.Close()
+	if err := SetNetworkOutput("tcp", l.Addr().String()); err != nil {
+		t.Fatalf("SetNetworkOutput: %v", err)
+	}
+	defer SetNetworkOutput("", "")
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	Info("over the wire")
+	Warning("second line")
+	r := bufio.NewReader(conn)
+	if line := readLine(t, r, conn); !strings.HasSuffix(line, "] over the wire\n") || line[0] != 'I' {
+		t.Errorf("got %q, want the INFO line", line)
+	}
+	if line := readLine(t, r, conn); !strings.HasSuffix(line, "] second line\n") || line[0] != 'W' {
+		t.Errorf("got %q, want the WARNING line", line)
+	}
+	if !contains(infoLog, "over the wire", t) {
+		t.Error("line was not written to the log file")
+	}
+}
+
+// Test that with -log_network_only lines are not written to the log files.
+func TestNetworkOnly(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { *networkOnly = previous }(*networkOnly)
+	*networkOnly = true
+	l := listen(t)
+	defer l.Close()
+	if err := SetNetworkOutput("tcp", l.Addr().String()); err != nil {
+		t.Fatalf("SetNetworkOutput: %v", err)
+	}
+	defer SetNetworkOutput("", "")
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	Info("network only")
+	if line := readLine(t, bufio.NewReader(conn), conn); !strings.HasSuffix(line, "] network only\n") {
+		t.Errorf("got %q, want the INFO line", line)
+	}
+	if contents(infoLog) != "" {
+		t.Errorf("line was written to the log file: %q", contents(infoLog))
+	}
+}
+
+// Test that logging does not block when the collector stops reading, and
+// that the lines that do not fit are counted.
+func TestNetworkOutputStalled(t *testing.T) {
+	setFlags()
+	discard := writerSink{ioutil.Discard}
+	defer logging.swap(logging.swap([maxSeverity]flushSyncWriter{discard, discard, discard, discard}))
+	l := listen(t)
+	defer l.Close()
+	if err := SetNetworkOutput("tcp", l.Addr().String()); err != nil {
+		t.Fatalf("SetNetworkOutput: %v", err)
+	}
+	defer SetNetworkOutput("", "")
+	conn, err := l.Accept() // Never read from.
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	dropped, drops := NetworkDropped(), DropStats().NetworkDrops
+	msg := strings.Repeat("x", 4096)
+	start := time.Now()
+	for i := 0; i < 20000; i++ {
+		Info(msg)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("logging took %v with a stalled collector", elapsed)
+	}
+	if NetworkDropped() == dropped {
+		t.Error("no lines were counted as dropped")
+	}
+	if DropStats().NetworkDrops == drops {
+		t.Error("DropStats counted no network drops")
+	}
+}
+
+// Test that the sink reconnects after the collector closes the connection.
+func TestNetworkOutputReconnect(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	l := listen(t)
+	defer l.Close()
+	if err := SetNetworkOutput("tcp", l.Addr().String()); err != nil {
+		t.Fatalf("SetNetworkOutput: %v", err)
+	}
+	defer SetNetworkOutput("", "")
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			accepted <- c
+		}
+	}()
+	deadline := time.After(10 * time.Second)
+	for {
+		Info("after reconnect")
+		select {
+		case c := <-accepted:
+			defer c.Close()
+			if line := readLine(t, bufio.NewReader(c), c); !strings.HasSuffix(line, "] after reconnect\n") {
+				t.Errorf("got %q, want the INFO line", line)
+			}
+			return
+		case <-deadline:
+			t.Fatal("the sink did not reconnect")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestSetNetworkOutputInvalid(t *testing.T) {
+	if err := SetNetworkOutput("unix", "/tmp/x"); err == nil {
+		t.Error("got nil error for an unsupported network")
+	}
+	l := listen(t)
+	addr := l.Addr().String()
+	l.Close()
+	if err := SetNetworkOutput("tcp", addr); err == nil {
+		t.Error("got nil error for an unreachable collector")
+	}
+}
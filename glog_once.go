@@ -0,0 +1,68 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Logging once per call site.
+
+package glog
+
+import (
+	"runtime"
+	"sync"
+)
+
+// onceSite identifies the call site of InfoOnce or WarningOnce.
+type onceSite struct {
+	file string
+	line int
+}
+
+// onceSites maps the onceSite of each InfoOnce and WarningOnce call to the
+// *sync.Once that marks its first call.
+var onceSites sync.Map
+
+// firstAtSite reports whether this is the first call of its caller from the
+// call site of that caller's caller.
+func firstAtSite() bool {
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		return true
+	}
+	site := onceSite{file, line}
+	o, ok := onceSites.Load(site)
+	if !ok {
+		o, _ = onceSites.LoadOrStore(site, new(sync.Once))
+	}
+	first := false
+	o.(*sync.Once).Do(func() { first = true })
+	return first
+}
+
+// InfoOnce is equivalent to Info, but logs only the first time it is called
+// from each file and line; later calls from there do nothing. It is meant for
+// notices, such as a deprecation, on a path that may run many times.
+func InfoOnce(args ...interface{}) {
+	if firstAtSite() {
+		logging.print(infoLog, args...)
+	}
+}
+
+// WarningOnce is equivalent to Warning, but logs only the first time it is
+// called from each file and line. See InfoOnce.
+func WarningOnce(args ...interface{}) {
+	if firstAtSite() {
+		logging.print(warningLog, args...)
+	}
+}
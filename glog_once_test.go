@@ -0,0 +1,63 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Test that WarningOnce logs once from a call site however often it runs
+// there, and still logs from another call site.
+func TestWarningOnce(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	_, _, line, _ := runtime.Caller(0)
+	for i := 0; i < 100; i++ {
+		WarningOnce("in a loop")
+	}
+	WarningOnce("elsewhere")
+
+	got := contents(warningLog)
+	if n := strings.Count(got, "] in a loop\n"); n != 1 {
+		t.Errorf("got %d lines from the loop, want 1: %q", n, got)
+	}
+	if want := fmt.Sprintf("glog_once_test.go:%d] in a loop\n", line+2); !strings.Contains(got, want) {
+		t.Errorf("got %q, want it to contain %q", got, want)
+	}
+	if n := strings.Count(got, "] elsewhere\n"); n != 1 {
+		t.Errorf("got %d lines from the second site, want 1: %q", n, got)
+	}
+}
+
+// Test that InfoOnce logs once per call site.
+func TestInfoOnce(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	for i := 0; i < 3; i++ {
+		InfoOnce("first site")
+		InfoOnce("second site")
+	}
+	got := contents(infoLog)
+	if strings.Count(got, "] first site\n") != 1 || strings.Count(got, "] second site\n") != 1 {
+		t.Errorf("got %q, want one line from each site", got)
+	}
+}
@@ -0,0 +1,98 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Per-callsite rate limiting of log lines.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimit is set by the -log_rate_limit flag.
+var rateLimit = flag.Int("log_rate_limit", 0, "If non-zero, the maximum number of lines per second logged from any one source line; FATAL lines are never dropped")
+
+// callsite identifies the source line a log line comes from.
+type callsite struct {
+	file string
+	line int
+}
+
+// rateWindow counts the lines logged from a callsite in the current second.
+type rateWindow struct {
+	start      time.Time
+	sev        Severity
+	count      int // Lines written since start.
+	suppressed int // Lines dropped since start, and not yet reported.
+}
+
+// rateWindows holds the rateWindow of each callsite. It is protected by
+// logging.mu.
+var rateWindows = make(map[callsite]*rateWindow)
+
+// allowLine reports whether a line of severity s from file:line, logged at
+// now, is within -log_rate_limit, and the number of lines from there that
+// were dropped in the window that just ended, if a new one started. l.mu is
+// held.
+func (l *loggingT) allowLine(s Severity, file string, line int, now time.Time) (ok bool, suppressed int) {
+	key := callsite{file, line}
+	w := rateWindows[key]
+	if w == nil {
+		w = &rateWindow{start: now, sev: s}
+		rateWindows[key] = w
+	} else if now.Sub(w.start) >= time.Second {
+		suppressed = w.suppressed
+		*w = rateWindow{start: now, sev: s}
+	}
+	if w.count >= *rateLimit {
+		w.suppressed++
+		atomic.AddUint64(&rateLimited, 1)
+		return false, suppressed
+	}
+	w.count++
+	return true, suppressed
+}
+
+// writeSuppressed writes the line reporting that n lines from file:line were
+// dropped by -log_rate_limit. l.mu is held.
+func (l *loggingT) writeSuppressed(s Severity, file string, line int, n int) {
+	buf := l.formatHeader(s, file, line)
+	fmt.Fprintf(buf, "... %d messages suppressed\n", n)
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.write(s, file, line, buf.Bytes(), false)
+	l.putBuffer(buf)
+}
+
+// endRateWindows writes the lines reporting the lines dropped by
+// -log_rate_limit that have not been reported yet, so that a burst followed
+// by silence is reported too, and forgets the windows that have ended.
+// l.mu is held.
+func (l *loggingT) endRateWindows(now time.Time) {
+	for key, w := range rateWindows {
+		if w.suppressed > 0 {
+			l.writeSuppressed(w.sev, key.file, key.line, w.suppressed)
+			w.suppressed = 0
+		}
+		if now.Sub(w.start) >= time.Second {
+			delete(rateWindows, key)
+		}
+	}
+}
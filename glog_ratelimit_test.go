@@ -0,0 +1,90 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that -log_rate_limit caps the lines from one source line per second,
+// and reports how many were dropped once the next second begins.
+func TestRateLimit(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *rateLimit = previous }(*rateLimit)
+	*rateLimit = 5
+	rateWindows = make(map[callsite]*rateWindow)
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	limited := DropStats().RateLimited
+	flood := func() { Info("flood") }
+	for i := 0; i < 1000; i++ {
+		flood()
+	}
+	if n := DropStats().RateLimited - limited; n != 995 {
+		t.Errorf("DropStats counted %d lines rate limited, want 995", n)
+	}
+	Info("other")
+	if got := strings.Count(contents(infoLog), "] flood\n"); got != 5 {
+		t.Errorf("got %d lines in the first second, want 5", got)
+	}
+	if !contains(infoLog, "] other\n", t) {
+		t.Error("a line from another source line was dropped")
+	}
+
+	now = now.Add(time.Second)
+	flood()
+	if got := strings.Count(contents(infoLog), "] flood\n"); got != 6 {
+		t.Errorf("got %d lines in total, want 6", got)
+	}
+	if want := "] ... 995 messages suppressed\n"; strings.Count(contents(infoLog), want) != 1 {
+		t.Errorf("got %q, want one %q", contents(infoLog), want)
+	}
+}
+
+// Test that the lines dropped by -log_rate_limit are reported on Flush,
+// without another line from the same source line.
+func TestRateLimitFlush(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *rateLimit = previous }(*rateLimit)
+	*rateLimit = 5
+	rateWindows = make(map[callsite]*rateWindow)
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.Local)
+	timeNow = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		Warning("burst")
+	}
+	now = now.Add(time.Minute)
+	Flush()
+	if want := "] ... 95 messages suppressed\n"; strings.Count(contents(warningLog), want) != 1 {
+		t.Errorf("got %q, want one %q", contents(warningLog), want)
+	}
+	if len(rateWindows) != 0 {
+		t.Errorf("got %d rate windows after they ended, want none", len(rateWindows))
+	}
+	Flush()
+	if got := strings.Count(contents(warningLog), "suppressed"); got != 1 {
+		t.Errorf("got %d reports after a second Flush, want 1", got)
+	}
+}
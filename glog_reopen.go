@@ -0,0 +1,96 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Reopening the log files after an external tool has rotated them.
+
+package glog
+
+import (
+	"flag"
+	"os"
+	"sync"
+)
+
+// reopenOnSIGHUP is set by the -log_reopen_on_sighup flag.
+var reopenOnSIGHUP = flag.Bool("log_reopen_on_sighup", false, "If true, the log files are reopened, as by ReopenFiles, when the process receives SIGHUP")
+
+// openedReopen is the reason for opening a log file on ReopenFiles.
+const openedReopen = "reopen"
+
+// ReopenFiles closes the open log files and opens new ones in their place,
+// named by the -log_file_pattern as at any other rotation. It is for use with
+// logrotate and other tools that rename or truncate log files from outside
+// the program: afterwards nothing is written to the old files, so their space
+// can be reclaimed. The old files are neither compressed nor deleted, since
+// the tool that rotated them is in charge of them. A severity whose file
+// cannot be reopened writes to standard error until it can, as after a write
+// error; ReopenFiles returns the first such error.
+func ReopenFiles() error {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	return logging.reopenFiles(openedReopen)
+}
+
+// reopenFiles starts a new file in place of each open log file, giving reason
+// in its banner. A severity whose file cannot be reopened writes to standard
+// error until it can; reopenFiles returns the first such error. l.mu is held.
+func (l *loggingT) reopenFiles(reason string) error {
+	now := timeNow()
+	var first error
+	for s := numSeverities() - 1; s >= infoLog; s-- {
+		sb, ok := l.file[s].(*syncBuffer)
+		if !ok || l.sharesLaterFile(s) {
+			continue
+		}
+		if err := sb.rotateFile(now, reason); err != nil {
+			sb.fail(now, err)
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		sb.failing = false
+	}
+	if err := reopenShards(now, reason); first == nil {
+		first = err
+	}
+	if err := reopenAudit(now, reason); first == nil {
+		first = err
+	}
+	return first
+}
+
+// reopenHandler starts the goroutine handling SIGHUP for
+// -log_reopen_on_sighup once.
+var reopenHandler sync.Once
+
+// startReopenHandler installs the SIGHUP handler for -log_reopen_on_sighup,
+// if it is set and not yet installed. It is called as the log files are
+// created, after the flags have been parsed.
+func startReopenHandler() {
+	if !*reopenOnSIGHUP {
+		return
+	}
+	reopenHandler.Do(func() {
+		c := make(chan os.Signal, 1)
+		notifyHangup(c)
+		go func() {
+			for range c {
+				ReopenFiles() // A failure has been reported on standard error.
+			}
+		}()
+	})
+}
@@ -0,0 +1,70 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// An in-memory record of the most recent log lines.
+
+package glog
+
+// ringBuffer holds the most recent lines written, oldest first from next.
+type ringBuffer struct {
+	lines []string
+	next  int  // The index of the oldest line, and of the next to be replaced.
+	full  bool // Whether every slot of lines has been written.
+}
+
+// add records line, replacing the oldest if the ring is full.
+func (r *ringBuffer) add(line []byte) {
+	r.lines[r.next] = string(line)
+	r.next++
+	if r.next == len(r.lines) {
+		r.next, r.full = 0, true
+	}
+}
+
+// recent returns the recorded lines, oldest first.
+func (r *ringBuffer) recent() []string {
+	if !r.full {
+		return append([]string{}, r.lines[:r.next]...)
+	}
+	return append(append([]string{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// EnableRingBuffer keeps the n most recent lines logged, of every severity,
+// in memory for RecentLines, as for a debugging endpoint that shows them
+// without reading the log files. Lines logged before the call are not kept.
+// An n of zero or less stops keeping lines and discards those kept.
+func EnableRingBuffer(n int) {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if n <= 0 {
+		logging.ring = nil
+		return
+	}
+	logging.ring = &ringBuffer{lines: make([]string, n)}
+}
+
+// RecentLines returns the lines kept since EnableRingBuffer, oldest first.
+// Each is a whole line as written to the logs, ending in a newline, whose
+// header gives its severity. It returns nil if EnableRingBuffer is not in
+// effect.
+func RecentLines() []string {
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if logging.ring == nil {
+		return nil
+	}
+	return logging.ring.recent()
+}
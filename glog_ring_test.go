@@ -0,0 +1,61 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Test that the ring buffer keeps the last N lines of every severity, in
+// order.
+func TestRingBuffer(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer EnableRingBuffer(0)
+
+	if got := RecentLines(); got != nil {
+		t.Errorf("RecentLines before EnableRingBuffer: got %q, want nil", got)
+	}
+	EnableRingBuffer(5)
+	Info("line 0")
+	if got := RecentLines(); len(got) != 1 || !strings.HasSuffix(got[0], "] line 0\n") {
+		t.Errorf("RecentLines after one line: got %q", got)
+	}
+	for i := 1; i < 12; i++ {
+		if i%2 == 0 {
+			Infof("line %d", i)
+		} else {
+			Warningf("line %d", i)
+		}
+	}
+	got := RecentLines()
+	if len(got) != 5 {
+		t.Fatalf("got %d lines, want 5: %q", len(got), got)
+	}
+	for i, line := range got {
+		n := 7 + i
+		char := "I"
+		if n%2 == 1 {
+			char = "W"
+		}
+		if want := fmt.Sprintf("] line %d\n", n); !strings.HasPrefix(line, char) || !strings.HasSuffix(line, want) {
+			t.Errorf("line %d: got %q, want %s...%q", i, line, char, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Sampling of verbose log lines.
+
+package glog
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+)
+
+// sampleRate is set by the -log_sample_rate flag.
+var sampleRate = flag.Int("log_sample_rate", 0, "If greater than one, log only every Nth call to V at each call site, for levels above zero")
+
+// sampleCounts maps the PC of each sampled V call site to a *uint64 count of
+// its calls.
+var sampleCounts sync.Map
+
+// sampleV counts a call to V at pc that would log, and reports whether it is
+// one of the -log_sample_rate calls that does: the first and every Nth after.
+func sampleV(pc uintptr) bool {
+	n, ok := sampleCounts.Load(pc)
+	if !ok {
+		n, _ = sampleCounts.LoadOrStore(pc, new(uint64))
+	}
+	c := atomic.AddUint64(n.(*uint64), 1)
+	return (c-1)%uint64(*sampleRate) == 0
+}
@@ -0,0 +1,61 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"strings"
+	"testing"
+)
+
+// Test that -log_sample_rate keeps every Nth line from a V call site, and
+// leaves other severities alone.
+func TestSampleRate(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *sampleRate = previous }(*sampleRate)
+	*sampleRate = 10
+	defer SetVerbosity(VerbosityLevel())
+	SetVerbosity(2)
+
+	for i := 0; i < 100; i++ {
+		V(2).Info("sampled")
+		Warning("not sampled")
+	}
+	if got := strings.Count(contents(infoLog), "] sampled\n"); got != 10 {
+		t.Errorf("got %d sampled lines, want 10", got)
+	}
+	if got := strings.Count(contents(warningLog), "] not sampled\n"); got != 100 {
+		t.Errorf("got %d warning lines, want 100", got)
+	}
+}
+
+// Test that sampling also applies to call sites enabled by -vmodule.
+func TestSampleRateVModule(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *sampleRate = previous }(*sampleRate)
+	*sampleRate = 4
+	defer logging.vmodule.Set("")
+	logging.vmodule.Set("glog_sample_test=2")
+
+	for i := 0; i < 20; i++ {
+		V(2).Info("sampled")
+	}
+	if got := strings.Count(contents(infoLog), "] sampled\n"); got != 5 {
+		t.Errorf("got %d sampled lines, want 5", got)
+	}
+}
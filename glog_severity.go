@@ -0,0 +1,165 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// User-defined severity levels.
+
+package glog
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxSeverity bounds the number of severities, built-in and registered.
+const maxSeverity = 16
+
+// severityOrder holds the order of each severity, by which the thresholds
+// compare them. The built-in levels are 100 apart, leaving room for
+// registered levels between them.
+var severityOrder = []int{
+	infoLog:    0,
+	warningLog: 100,
+	errorLog:   200,
+	fatalLog:   300,
+}
+
+// severityExits records which severities end the process once a line of
+// theirs is written, as FATAL does.
+var severityExits = []bool{
+	fatalLog: true,
+}
+
+// RegisterSeverity adds a severity level called name, which is logged with
+// Log and Logf. The level sits where order places it among the others; the
+// built-in levels have orders 0 (INFO), 100 (WARNING), 200 (ERROR) and 300
+// (FATAL), so a level of order 250 falls between ERROR and FATAL and one of
+// order 400 is above FATAL. The thresholds compare levels by order, and the
+// name is accepted wherever a severity name is, such as by -stderrthreshold.
+//
+// Lines of the new level are written to a log file of their own, linked as
+// program.NAME, and also to the file of the most severe built-in level ordered
+// at or below it. Lines of a level ordered above ERROR are flushed as soon as
+// they are written. If exits is true, a line of the level ends the process as
+// Fatal does.
+//
+// The header of a line shows the first letter of name. RegisterSeverity must
+// be called before flags are parsed and logging begins, typically from an
+// init function. It panics if name is not made of letters, digits and
+// underscores, if it is already in use, if order is negative, or if too many
+// levels have been registered.
+func RegisterSeverity(name string, order int, exits bool) Severity {
+	name = strings.ToUpper(name)
+	if !validSeverityName(name) {
+		panic(fmt.Sprintf("log.RegisterSeverity(%q): invalid severity name", name))
+	}
+	if _, ok := severityByName(name); ok {
+		panic(fmt.Sprintf("log.RegisterSeverity(%q): severity already registered", name))
+	}
+	if order < 0 {
+		panic(fmt.Sprintf("log.RegisterSeverity(%q): negative order %d", name, order))
+	}
+	logging.mu.Lock()
+	defer logging.mu.Unlock()
+	if len(severityName) >= maxSeverity {
+		panic(fmt.Sprintf("log.RegisterSeverity(%q): too many severities", name))
+	}
+	s := Severity(len(severityName))
+	severityName = append(severityName, name)
+	severityChar = append(severityChar, name[0])
+	severityOrder = append(severityOrder, order)
+	severityExits = append(severityExits, exits)
+	return s
+}
+
+// validSeverityName reports whether name is an upper-case word usable in the
+// name of a log file.
+func validSeverityName(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// numSeverities returns the number of severities, built-in and registered.
+func numSeverities() Severity {
+	return Severity(len(severityName))
+}
+
+// valid reports whether s is a built-in or registered severity.
+func (s Severity) valid() bool {
+	return s >= 0 && s < numSeverities()
+}
+
+// order returns the order of s. A numeric threshold outside the known
+// severities is below or above all of them.
+func (s Severity) order() int {
+	switch {
+	case s < 0:
+		return math.MinInt32
+	case s >= numSeverities():
+		return math.MaxInt32
+	}
+	return severityOrder[s]
+}
+
+// atLeast reports whether s is ordered at or above t.
+func (s Severity) atLeast(t Severity) bool {
+	return s.order() >= t.order()
+}
+
+// exits reports whether a line of severity s ends the process.
+func (s Severity) exits() bool {
+	return s.valid() && severityExits[s]
+}
+
+// base returns the most severe built-in level ordered at or below s, whose
+// file also receives the lines of s, and whose behavior outputs such as
+// syslog follow.
+func (s Severity) base() Severity {
+	b := infoLog
+	for t := infoLog; t < numSeverity; t++ {
+		if s.atLeast(t) {
+			b = t
+		}
+	}
+	return b
+}
+
+// Log logs to the log of severity sev, which may be one added by
+// RegisterSeverity; an unknown sev logs to INFO.
+// Arguments are handled in the manner of fmt.Print; a newline is appended if missing.
+func Log(sev Severity, args ...interface{}) {
+	if !sev.valid() {
+		sev = infoLog
+	}
+	logging.print(sev, args...)
+}
+
+// Logf logs to the log of severity sev, which may be one added by
+// RegisterSeverity; an unknown sev logs to INFO.
+// Arguments are handled in the manner of fmt.Printf; a newline is appended if missing.
+func Logf(sev Severity, format string, args ...interface{}) {
+	if !sev.valid() {
+		sev = infoLog
+	}
+	logging.printf(sev, format, args...)
+}
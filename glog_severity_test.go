@@ -0,0 +1,121 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// securityLog is registered once for the tests, between ERROR and FATAL.
+var securityLog = RegisterSeverity("security", 250, false)
+
+// Test that a registered severity has a name, a header letter and its own
+// log, and that its lines also go to the log of ERROR, the built-in level
+// below it.
+func TestRegisterSeverity(t *testing.T) {
+	setFlags()
+	buffers := [maxSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)}
+	buffers[securityLog] = new(flushBuffer)
+	defer logging.swap(logging.swap(buffers))
+	defer logging.stderrThreshold.set(logging.stderrThreshold.get())
+	logging.stderrThreshold.set(fatalLog)
+
+	if got := securityLog.String(); got != "SECURITY" {
+		t.Errorf("String() = %q, want SECURITY", got)
+	}
+	if s, err := ParseSeverity("Security"); err != nil || s != securityLog {
+		t.Errorf("ParseSeverity(Security): got %v, %v", s, err)
+	}
+	if !securityLog.atLeast(errorLog) || securityLog.atLeast(fatalLog) {
+		t.Errorf("SECURITY is not ordered between ERROR and FATAL")
+	}
+
+	Logf(securityLog, "breach %d", 1)
+	line := contents(securityLog)
+	if !strings.HasPrefix(line, "S") || !strings.HasSuffix(line, "] breach 1\n") {
+		t.Errorf("SECURITY log: got %q", line)
+	}
+	if got := contents(errorLog); got != line {
+		t.Errorf("ERROR log: got %q, want %q", got, line)
+	}
+	for _, s := range []Severity{infoLog, warningLog, fatalLog} {
+		if got := contents(s); got != "" {
+			t.Errorf("%s log: got %q, want nothing", severityName[s], got)
+		}
+	}
+}
+
+// Test that a registered severity gets its own log file and symlink, and that
+// -filethreshold compares it by its order.
+func TestRegisterSeverityFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not reliably supported on Windows")
+	}
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer logging.fileThreshold.set(logging.fileThreshold.get())
+	if err := logging.fileThreshold.Set("security"); err != nil {
+		t.Fatal(err)
+	}
+
+	Error("not in a file")
+	Log(securityLog, "in its own file")
+	Flush()
+	if logging.file[errorLog] != nil {
+		t.Error("ERROR file created below -filethreshold")
+	}
+	sb, ok := logging.file[securityLog].(*syncBuffer)
+	if !ok {
+		t.Fatal("SECURITY file not created")
+	}
+	_, link := logName(severityName[securityLog], time.Now())
+	if link != program+".SECURITY" {
+		t.Errorf("got symlink %q, want %s.SECURITY", link, program)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, link)); err != nil || target != filepath.Base(sb.file.Name()) {
+		t.Errorf("symlink points at %q (%v), want %q", target, err, filepath.Base(sb.file.Name()))
+	}
+	data, err := ioutil.ReadFile(sb.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "] in its own file\n") || strings.Contains(string(data), "not in a file") {
+		t.Errorf("SECURITY file holds %q", data)
+	}
+}
+
+// Test that RegisterSeverity rejects bad and duplicate names.
+func TestRegisterSeverityPanics(t *testing.T) {
+	for _, name := range []string{"", "info", "Security", "2FA", "A.B", "A/B"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterSeverity(%q) did not panic", name)
+				}
+			}()
+			RegisterSeverity(name, 500, false)
+		}()
+	}
+}
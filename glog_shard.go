@@ -0,0 +1,218 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// INFO logs spread across several files, for servers that log heavily.
+
+package glog
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// infoShards is set by the -log_info_shards flag.
+var infoShards = flag.Int("log_info_shards", 0, "If positive, the number of INFO log files InfoShard spreads its lines across")
+
+// shard is one of the log files of InfoShard. Its mutex guards the file, so
+// that lines for different shards are written in parallel. Creating or
+// rotating the file reaches into the state that l.mu guards, so that takes
+// l.mu too, which is locked first.
+type shard struct {
+	mu sync.Mutex
+	sb *syncBuffer // nil until the first line, or after Shutdown.
+}
+
+// shards holds the []*shard written so far, which grows, under
+// logging.mu, to hold as many as -log_info_shards asks for.
+var shards atomic.Value
+
+// InfoShard logs to one of -log_info_shards INFO log files, chosen by
+// hashing shardKey, such as a worker ID, so that the same key always goes to
+// the same file. Arguments are handled in the manner of fmt.Print; a newline
+// is appended if missing. Each file has its own lock, so goroutines logging
+// to different shards do not wait on each other, and is rotated and pruned
+// on its own, under the tag INFO.<n> for shard n.
+//
+// A sharded line goes to its shard's file only: not to the INFO log, to
+// standard error, or to hooks, tees and the network. Filters, redaction and
+// -log_max_line_bytes still apply. Without -log_info_shards, or when INFO
+// lines are not written to files, InfoShard is the same as Info.
+func InfoShard(shardKey string, args ...interface{}) {
+	n := *infoShards
+	if n <= 0 || !flag.Parsed() || logging.toStderr || !infoLog.atLeast(logging.fileThreshold.get()) || currentTestLogger() != nil {
+		logging.printDepth(infoLog, 0, args...)
+		return
+	}
+	logging.printShard(shardIndex(shardKey, n), args...)
+}
+
+// shardIndex returns the shard, of n, for key.
+func shardIndex(key string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+// shardTag returns the tag of the log files of shard i.
+func shardTag(i int) string {
+	return severityName[infoLog] + "." + strconv.Itoa(i)
+}
+
+// tagSeverity returns the name of the severity whose log files have tag:
+// the tag itself, or the part before the dot for a shard.
+func tagSeverity(tag string) string {
+	if i := strings.IndexByte(tag, '.'); i >= 0 {
+		return tag[:i]
+	}
+	return tag
+}
+
+// printShard formats the line for InfoShard and writes it to shard i.
+func (l *loggingT) printShard(i int, args ...interface{}) {
+	buf, _, _ := l.header(infoLog, 0)
+	fmt.Fprint(buf, args...)
+	buf.endLine()
+	if dropLine(buf) {
+		l.putBuffer(buf)
+		return
+	}
+	redactLine(buf)
+	truncateLine(buf)
+	if buf.json {
+		buf = l.formatJSON(buf)
+	}
+	l.shard(i).write(l, i, buf.Bytes())
+	if stats := severityStats[infoLog]; stats != nil {
+		atomic.AddInt64(&stats.lines, 1)
+		atomic.AddInt64(&stats.bytes, int64(buf.Len()))
+	}
+	l.putBuffer(buf)
+}
+
+// shard returns shard i, adding it if need be.
+func (l *loggingT) shard(i int) *shard {
+	if list, _ := shards.Load().([]*shard); i < len(list) {
+		return list[i]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list, _ := shards.Load().([]*shard)
+	if i < len(list) {
+		return list[i]
+	}
+	grown := make([]*shard, i+1)
+	copy(grown, list)
+	for j := len(list); j < len(grown); j++ {
+		grown[j] = new(shard)
+	}
+	shards.Store(grown)
+	return grown[i]
+}
+
+// allShards returns the shards added so far.
+func allShards() []*shard {
+	list, _ := shards.Load().([]*shard)
+	return list
+}
+
+// write writes data to the file of the shard, which is shard i of l,
+// creating or rotating the file first as need be.
+func (sh *shard) write(l *loggingT, i int, data []byte) {
+	now := timeNow()
+	sh.mu.Lock()
+	if sb := sh.sb; sb != nil && !sb.failing && sb.rotateReason(now, len(data)) == "" {
+		sb.writeFile(now, data)
+		sh.flush()
+		sh.mu.Unlock()
+		return
+	}
+	sh.mu.Unlock()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.sb == nil {
+		l.startFlushDaemon()
+		sb := &syncBuffer{logger: l, sev: infoLog, tag: shardTag(i)}
+		if err := sb.rotateFile(now, openedStartup); err != nil {
+			sb.fail(now, err)
+		}
+		sh.sb = sb
+	}
+	sh.sb.Write(data)
+	sh.flush()
+}
+
+// flush flushes the shard's file if INFO is at the
+// -log_immediate_flush_threshold. sh.mu is held.
+func (sh *shard) flush() {
+	if sh.sb.Writer != nil && infoLog.atLeast(sh.sb.logger.flushThreshold.get()) {
+		sh.sb.Flush()
+	}
+}
+
+// flushShards flushes and syncs the files of the shards. l.mu is held.
+func flushShards() {
+	for _, sh := range allShards() {
+		sh.mu.Lock()
+		if sh.sb != nil && sh.sb.Writer != nil {
+			sh.sb.Flush() // ignore error
+			sh.sb.Sync()  // ignore error
+		}
+		sh.mu.Unlock()
+	}
+}
+
+// closeShards closes the files of the shards, so that the next lines open
+// new ones. l.mu is held.
+func closeShards() {
+	for _, sh := range allShards() {
+		sh.mu.Lock()
+		if sh.sb != nil && sh.sb.file != nil {
+			sh.sb.Flush()      // ignore error
+			sh.sb.file.Close() // ignore error
+		}
+		sh.sb = nil
+		sh.mu.Unlock()
+	}
+}
+
+// reopenShards is reopenFiles for the files of the shards. l.mu is held.
+func reopenShards(now time.Time, reason string) error {
+	var first error
+	for _, sh := range allShards() {
+		sh.mu.Lock()
+		if sh.sb != nil {
+			if err := sh.sb.rotateFile(now, reason); err != nil {
+				sh.sb.fail(now, err)
+				if first == nil {
+					first = err
+				}
+			} else {
+				sh.sb.failing = false
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return first
+}
@@ -0,0 +1,133 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// useShards sets -log_info_shards to n, and returns a function that closes
+// the shards' files and restores it.
+func useShards(n int) func() {
+	previous := *infoShards
+	*infoShards = n
+	return func() {
+		logging.mu.Lock()
+		closeShards()
+		shards.Store([]*shard(nil))
+		logging.mu.Unlock()
+		*infoShards = previous
+	}
+}
+
+// Test that a shard key always picks the same shard.
+func TestShardIndex(t *testing.T) {
+	for key, want := range map[string]int{
+		"worker-1": 1,
+		"worker-2": 0,
+		"worker-3": 3,
+		"worker-4": 2,
+	} {
+		for i := 0; i < 3; i++ {
+			if got := shardIndex(key, 4); got != want {
+				t.Errorf("shardIndex(%q, 4) = %d, want %d", key, got, want)
+			}
+		}
+	}
+}
+
+// Test that InfoShard writes the lines of each key to the file of its shard,
+// and not to the INFO log.
+func TestInfoShard(t *testing.T) {
+	setFlags()
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	defer useLogDir(dir)()
+	defer useShards(4)()
+
+	keys := []string{"worker-1", "worker-2", "worker-3", "worker-4"}
+	for round := 0; round < 2; round++ {
+		for _, key := range keys {
+			InfoShard(key, "line from ", key)
+		}
+	}
+	Info("unsharded")
+	Flush()
+
+	for _, key := range keys {
+		i := shardIndex(key, 4)
+		data, err := ioutil.ReadFile(filepath.Join(dir, program+"."+shardTag(i)))
+		if err != nil {
+			t.Fatalf("shard %d of %s: %v", i, key, err)
+		}
+		lines := strings.Count(string(data), "] line from ")
+		if got := strings.Count(string(data), "] line from "+key+"\n"); got != 2 || lines != 2 {
+			t.Errorf("shard %d has %d lines, %d of them from %s, want only the 2 from %s:\n%s", i, lines, got, key, key, data)
+		}
+		if strings.Contains(string(data), "unsharded") {
+			t.Errorf("shard %d has the unsharded line:\n%s", i, data)
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, program+".INFO"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "line from") || !strings.Contains(string(data), "unsharded") {
+		t.Errorf("INFO log has %q, want only the unsharded line", data)
+	}
+}
+
+// Test that without -log_info_shards InfoShard logs as Info does.
+func TestInfoShardOff(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer useShards(0)()
+	InfoShard("worker-1", "not sharded")
+	if !contains(infoLog, "] not sharded\n", t) {
+		t.Errorf("got %q, want the line in the INFO log", contents(infoLog))
+	}
+}
+
+// Benchmark parallel logging to the INFO log and to 8 shards.
+func BenchmarkInfoShard(b *testing.B) {
+	for _, n := range []int{0, 8} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "glog_bench")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			defer useLogDir(dir)()
+			defer useShards(n)()
+			defer func(previous uint64) { MaxSize = previous }(MaxSize)
+			MaxSize = 1 << 40
+			var worker int32
+			b.RunParallel(func(pb *testing.PB) {
+				key := fmt.Sprint("worker-", atomic.AddInt32(&worker, 1))
+				for pb.Next() {
+					InfoShard(key, "benchmark line")
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,136 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+// An adapter that lets the log/slog package write to the Google logs.
+
+package glog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+)
+
+// SlogOption configures a handler returned by NewSlogHandler.
+type SlogOption func(*slogHandler)
+
+// SlogDebugVerbosity sets the V level at which records below slog.LevelInfo
+// are logged; slog.LevelDebug records are logged only if V(level) is enabled.
+// The default is 1.
+func SlogDebugVerbosity(level Level) SlogOption {
+	return func(h *slogHandler) {
+		h.debugLevel = level
+	}
+}
+
+// slogHandler is a slog.Handler that writes records to the Google logs.
+// Its fields are never modified once it is returned by NewSlogHandler,
+// WithAttrs or WithGroup, so it is safe for concurrent use.
+type slogHandler struct {
+	debugLevel Level
+	prefix     string        // The group prefix for keys, ending in "." if non-empty.
+	kv         []interface{} // Key/value pairs from WithAttrs, already prefixed.
+}
+
+// NewSlogHandler returns a slog.Handler that writes records to the Google logs,
+// so that
+//
+//	slog.SetDefault(slog.New(glog.NewSlogHandler()))
+//
+// sends slog output through the files, flags and rotation of this package.
+// Records at slog.LevelError and above are logged to ERROR, those at
+// slog.LevelWarn and above to WARNING, and the rest to INFO. Attributes are
+// rendered as key=value pairs, or as fields in -log_format=json mode, with
+// group names joined to keys by dots.
+func NewSlogHandler(opts ...SlogOption) slog.Handler {
+	h := &slogHandler{debugLevel: 1}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Enabled is part of the slog.Handler interface. Records below
+// slog.LevelInfo are enabled only if the V level is high enough.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || logging.verbosity.get() >= h.debugLevel
+}
+
+// Handle is part of the slog.Handler interface.
+func (h *slogHandler) Handle(_ context.Context, r slog.Record) error {
+	s := infoLog
+	switch {
+	case r.Level >= slog.LevelError:
+		s = errorLog
+	case r.Level >= slog.LevelWarn:
+		s = warningLog
+	}
+	file, line := "???", 1
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if frame.File != "" {
+			file, line = logging.filePath.get().trim(frame.File), frame.Line
+		}
+	}
+	kv := append([]interface{}(nil), h.kv...)
+	r.Attrs(func(a slog.Attr) bool {
+		kv = appendAttr(kv, h.prefix, a)
+		return true
+	})
+	logging.outputKV(s, logging.formatHeader(s, file, line), file, line, r.Message, kv)
+	return nil
+}
+
+// WithAttrs is part of the slog.Handler interface.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.kv = append([]interface{}(nil), h.kv...)
+	for _, a := range attrs {
+		h2.kv = appendAttr(h2.kv, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup is part of the slog.Handler interface.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendAttr appends a's key, qualified by prefix, and value to kv,
+// flattening groups.
+func appendAttr(kv []interface{}, prefix string, a slog.Attr) []interface{} {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return kv // Ignore empty attributes, as slog.Handler requires.
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			kv = appendAttr(kv, prefix, ga)
+		}
+		return kv
+	}
+	return append(kv, prefix+a.Key, a.Value.Any())
+}
@@ -0,0 +1,108 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Test that slog records land in the log for the matching severity with
+// their attributes and the caller's file and line.
+func TestSlogHandler(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logger := slog.New(NewSlogHandler())
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info("hello", "user", "gopher", "n", 3)
+	logger.Warn("careful")
+	logger.Error("broken", slog.Group("req", "id", 7))
+
+	if want := fmt.Sprintf(" glog_slog_test.go:%d] hello user=gopher n=3\n", line+1); !strings.HasSuffix(contents(infoLog), want) {
+		t.Errorf("INFO: got %q, want suffix %q", contents(infoLog), want)
+	}
+	if !strings.HasPrefix(contents(warningLog), "W") || !strings.HasSuffix(contents(warningLog), "] careful\n") {
+		t.Errorf("WARNING: got %q", contents(warningLog))
+	}
+	if !strings.HasPrefix(contents(errorLog), "E") || !strings.HasSuffix(contents(errorLog), "] broken req.id=7\n") {
+		t.Errorf("ERROR: got %q", contents(errorLog))
+	}
+}
+
+// Test that WithAttrs and WithGroup accumulate prefixes correctly.
+func TestSlogHandlerWith(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	base := slog.New(NewSlogHandler()).With("svc", "api")
+	logger := base.WithGroup("http").With("method", "GET").WithGroup("resp")
+	logger.Info("done", "status", 200)
+	base.Info("plain")
+
+	lines := strings.Split(strings.TrimSuffix(contents(infoLog), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), contents(infoLog))
+	}
+	if want := "] done svc=api http.method=GET http.resp.status=200"; !strings.HasSuffix(lines[0], want) {
+		t.Errorf("got %q, want suffix %q", lines[0], want)
+	}
+	if want := "] plain svc=api"; !strings.HasSuffix(lines[1], want) {
+		t.Errorf("got %q, want suffix %q", lines[1], want)
+	}
+}
+
+// Test that attributes become JSON fields in -log_format=json mode.
+func TestSlogHandlerJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	slog.New(NewSlogHandler()).WithGroup("g").Info("hello", "n", 3)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(infoLog), err)
+	}
+	if entry["msg"] != "hello" || entry["g.n"] != 3.0 {
+		t.Errorf("got %v", entry)
+	}
+}
+
+// Test that debug records are enabled only by a high enough V level.
+func TestSlogHandlerDebug(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVerbosity(VerbosityLevel())
+	logger := slog.New(NewSlogHandler(SlogDebugVerbosity(2)))
+
+	SetVerbosity(1)
+	logger.Debug("hidden")
+	if contents(infoLog) != "" {
+		t.Errorf("debug record logged at V=1: %q", contents(infoLog))
+	}
+	SetVerbosity(2)
+	logger.Debug("shown")
+	if !strings.HasSuffix(contents(infoLog), "] shown\n") {
+		t.Errorf("debug record not logged at V=2: %q", contents(infoLog))
+	}
+}
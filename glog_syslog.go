@@ -0,0 +1,81 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+// Sending log lines to syslog.
+
+package glog
+
+import (
+	"log/syslog"
+	"sync"
+)
+
+// syslogWriter is the connection installed by SetSyslogOutput, if any.
+var syslogWriter struct {
+	mu sync.Mutex
+	w  *syslog.Writer
+}
+
+// SetSyslogOutput directs the logs of every severity to the syslog daemon
+// instead of to files, as SetOutput does for an io.Writer. The arguments are
+// those of syslog.Dial: an empty network and raddr connect to the local
+// daemon, and tag names the program in each message. Lines are logged with the
+// facility LOG_USER and the priority LOG_INFO, LOG_WARNING, LOG_ERR or
+// LOG_CRIT for INFO, WARNING, ERROR and FATAL. Each message keeps the glog
+// header, with its own time and file:line.
+func SetSyslogOutput(network, raddr, tag string) error {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_USER|syslog.LOG_INFO, tag)
+	if err != nil {
+		return err
+	}
+	for s := numSeverities() - 1; s >= infoLog; s-- {
+		SetOutputBySeverity(s, syslogSink{w, s})
+	}
+	syslogWriter.mu.Lock()
+	previous := syslogWriter.w
+	syslogWriter.w = w
+	syslogWriter.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// syslogSink writes the log lines of one severity to syslog.
+type syslogSink struct {
+	w   *syslog.Writer
+	sev Severity
+}
+
+func (s syslogSink) Write(p []byte) (int, error) {
+	var err error
+	switch msg := string(p); s.sev.base() {
+	case fatalLog:
+		err = s.w.Crit(msg)
+	case errorLog:
+		err = s.w.Err(msg)
+	case warningLog:
+		err = s.w.Warning(msg)
+	default:
+		err = s.w.Info(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,83 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+package glog
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that SetSyslogOutput sends each line to syslog with the priority
+// matching its severity, and with the glog header in the message.
+func TestSyslogOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	dir, err := ioutil.TempDir("", "glog_syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "log.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("cannot listen on a Unix socket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := SetSyslogOutput("unixgram", path, "glogtest"); err != nil {
+		t.Fatalf("SetSyslogOutput: %v", err)
+	}
+	defer func() {
+		syslogWriter.mu.Lock()
+		syslogWriter.w.Close()
+		syslogWriter.w = nil
+		syslogWriter.mu.Unlock()
+	}()
+	Info("to syslog")
+	Warning("warned")
+	Error("failed")
+
+	buf := make([]byte, 4096)
+	for _, want := range []struct {
+		pri string
+		msg string
+	}{
+		{"<14>", "] to syslog\n"},
+		{"<12>", "] warned\n"},
+		{"<11>", "] failed\n"},
+	} {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("reading from syslog socket: %v", err)
+		}
+		got := string(buf[:n])
+		if !strings.HasPrefix(got, want.pri) || !strings.Contains(got, " glogtest[") || !strings.HasSuffix(got, want.msg) {
+			t.Errorf("got %q, want priority %s and message ending in %q", got, want.pri, want.msg)
+		}
+		if !strings.Contains(got, "glog_syslog_test.go:") {
+			t.Errorf("got %q, want the glog header", got)
+		}
+	}
+}
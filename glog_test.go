@@ -18,13 +18,20 @@ package glog
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	stdLog "log"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -56,7 +63,7 @@ func (f *flushBuffer) Sync() error {
 }
 
 // swap sets the log writers and returns the old array.
-func (l *loggingT) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]flushSyncWriter) {
+func (l *loggingT) swap(writers [maxSeverity]flushSyncWriter) (old [maxSeverity]flushSyncWriter) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	old = l.file
@@ -67,17 +74,17 @@ func (l *loggingT) swap(writers [numSeverity]flushSyncWriter) (old [numSeverity]
 }
 
 // newBuffers sets the log writers to all new byte buffers and returns the old array.
-func (l *loggingT) newBuffers() [numSeverity]flushSyncWriter {
-	return l.swap([numSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)})
+func (l *loggingT) newBuffers() [maxSeverity]flushSyncWriter {
+	return l.swap([maxSeverity]flushSyncWriter{new(flushBuffer), new(flushBuffer), new(flushBuffer), new(flushBuffer)})
 }
 
 // contents returns the specified log value as a string.
-func contents(s severity) string {
+func contents(s Severity) string {
 	return logging.file[s].(*flushBuffer).String()
 }
 
 // contains reports whether the string is contained in the log.
-func contains(s severity, str string, t *testing.T) bool {
+func contains(s Severity, str string, t *testing.T) bool {
 	return strings.Contains(contents(s), str)
 }
 
@@ -99,6 +106,74 @@ func TestInfo(t *testing.T) {
 	}
 }
 
+// Test that the message of Info, Infoln and Infof is formatted exactly as by
+// fmt.Sprint, fmt.Sprintln and fmt.Sprintf, with a newline added if missing.
+func TestPrintParity(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	for _, args := range [][]interface{}{
+		{},
+		{""},
+		{"a"},
+		{"a", "b"},
+		{1, 2},
+		{"a", 1, 2, "b"},
+		{1, "a", 2.5, true},
+		{"ends with newline\n"},
+		{"a", "b\n"},
+		{nil, errors.New("err"), []int{1, 2}},
+	} {
+		for _, tc := range []struct {
+			name string
+			log  func(...interface{})
+			want string
+		}{
+			{"Info", Info, fmt.Sprint(args...)},
+			{"Infoln", Infoln, fmt.Sprintln(args...)},
+			{"Infof", func(args ...interface{}) { Infof(strings.Repeat("<%v>", len(args)), args...) }, fmt.Sprintf(strings.Repeat("<%v>", len(args)), args...)},
+		} {
+			if !strings.HasSuffix(tc.want, "\n") {
+				tc.want += "\n"
+			}
+			logging.newBuffers()
+			tc.log(args...)
+			got := contents(infoLog)
+			if i := strings.Index(got, "] "); i >= 0 {
+				got = got[i+len("] "):]
+			}
+			if got != tc.want {
+				t.Errorf("%s(%#v) logged %q, want %q", tc.name, args, got, tc.want)
+			}
+		}
+	}
+}
+
+// Test that an empty message is logged as an empty line, with no header and
+// in -log_format=json mode, in which the buffer starts out empty.
+func TestPrintEmpty(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	defer func(previous bool) { logging.noHeader = previous }(logging.noHeader)
+
+	logging.noHeader = true
+	Info("")
+	if got := contents(infoLog); got != "\n" {
+		t.Errorf("got %q with -log_no_header, want an empty line", got)
+	}
+	logging.noHeader = false
+	logging.format.set(jsonFormat)
+	logging.newBuffers()
+	Info()
+	var entry struct{ Msg *string }
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", contents(infoLog), err)
+	}
+	if entry.Msg == nil || *entry.Msg != "" {
+		t.Errorf("got %q, want an empty msg", contents(infoLog))
+	}
+}
+
 func TestInfoDepth(t *testing.T) {
 	setFlags()
 	defer logging.swap(logging.newBuffers())
@@ -143,6 +218,42 @@ func TestInfoDepth(t *testing.T) {
 	}
 }
 
+// depthHelper stands in for a wrapper library: it logs at every severity
+// with depth 1, so the headers should name its caller.
+func depthHelper(msg string) {
+	InfoDepth(1, msg)
+	WarningDepth(1, msg)
+	ErrorDepth(1, msg)
+	V(1).InfoDepth(1, msg)
+}
+
+// Test that the depth functions attribute lines to the caller of a wrapper.
+func TestDepthHelper(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logging.verbosity.Set("1")
+	defer logging.verbosity.Set("0")
+
+	_, _, line, _ := runtime.Caller(0)
+	depthHelper("wrapped")
+	want := fmt.Sprintf("glog_test.go:%d] wrapped\n", line+1)
+
+	infos := strings.SplitAfter(contents(infoLog), "\n")
+	if len(infos) != 3 || infos[2] != "" {
+		t.Fatalf("got INFO log %q, want two lines", contents(infoLog))
+	}
+	for i, m := range infos[:2] {
+		if !strings.HasSuffix(m, want) {
+			t.Errorf("INFO line %d: got %q, want suffix %q", i, m, want)
+		}
+	}
+	for _, s := range []Severity{warningLog, errorLog} {
+		if got := contents(s); !strings.HasSuffix(got, want) {
+			t.Errorf("%s log: got %q, want suffix %q", severityName[s], got, want)
+		}
+	}
+}
+
 func init() {
 	CopyStandardLogTo("INFO")
 }
@@ -157,6 +268,34 @@ func TestCopyStandardLogToPanic(t *testing.T) {
 	CopyStandardLogTo("LOG")
 }
 
+// Test that every severity round-trips through String and ParseSeverity.
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{InfoLevel, WarningLevel, ErrorLevel, FatalLevel} {
+		for _, name := range []string{s.String(), strings.ToLower(s.String())} {
+			got, err := ParseSeverity(name)
+			if err != nil || got != s {
+				t.Errorf("ParseSeverity(%q): got %v, %v; want %v", name, got, err, s)
+			}
+		}
+	}
+	for _, name := range []string{"", "LOG", "INFOx", "2"} {
+		if _, err := ParseSeverity(name); err == nil {
+			t.Errorf("ParseSeverity(%q) succeeded", name)
+		}
+	}
+	if got := Severity(7).String(); got != "7" {
+		t.Errorf("Severity(7).String() = %q, want 7", got)
+	}
+
+	var s Severity
+	if err := s.Set("warning"); err != nil || s.get() != WarningLevel {
+		t.Errorf("Set(warning): got %v, %v", s.get(), err)
+	}
+	if err := s.Set("bogus"); err == nil {
+		t.Error("Set(bogus) succeeded")
+	}
+}
+
 // Test that using the standard log package logs to INFO.
 func TestStandardLog(t *testing.T) {
 	setFlags()
@@ -170,6 +309,131 @@ func TestStandardLog(t *testing.T) {
 	}
 }
 
+// Test that CopyStandardLogToWithMapping routes standard log messages by
+// their prefixes and strips the prefixes.
+func TestCopyStandardLogToWithMapping(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer CopyStandardLogTo("INFO")
+	CopyStandardLogToWithMapping(InfoLevel, map[string]Severity{
+		"[WARN]":  WarningLevel,
+		"[ERR":    WarningLevel, // "[ERROR]" is longer, so takes precedence.
+		"[ERROR]": ErrorLevel,
+	})
+
+	stdLog.Print("[WARN] disk almost full")
+	stdLog.Print("[ERROR]  disk full")
+	stdLog.Print("plain message")
+	stdLog.Print("not [WARN] at the start")
+
+	for _, tc := range []struct {
+		sev  Severity
+		want []string
+	}{
+		{infoLog, []string{"] plain message\n", "] not [WARN] at the start\n"}},
+		{warningLog, []string{"] disk almost full\n"}},
+		{errorLog, []string{"] disk full\n"}},
+	} {
+		msgs := strings.SplitAfter(contents(tc.sev), "\n")
+		if len(msgs) != len(tc.want)+1 {
+			t.Errorf("%s log: got %q, want %d lines", severityName[tc.sev], contents(tc.sev), len(tc.want))
+			continue
+		}
+		for i, want := range tc.want {
+			if !strings.HasPrefix(msgs[i], severityName[tc.sev][:1]) || !strings.HasSuffix(msgs[i], want) {
+				t.Errorf("%s line %d: got %q, want suffix %q", severityName[tc.sev], i, msgs[i], want)
+			}
+		}
+	}
+}
+
+// Test that a log.Logger writing to Writer logs each line at its severity,
+// with a header naming the caller of the Logger.
+func TestWriter(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	logger := stdLog.New(Writer(ErrorLevel), "", 0)
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Print("first\nsecond")
+	fmt.Fprint(Writer(WarningLevel), "third\n")
+
+	msgs := strings.SplitAfter(contents(errorLog), "\n")
+	if len(msgs) != 3 || msgs[2] != "" {
+		t.Fatalf("got ERROR log %q, want two lines", contents(errorLog))
+	}
+	for i, text := range []string{"first", "second"} {
+		if want := fmt.Sprintf("glog_test.go:%d] %s\n", line+1, text); !strings.HasPrefix(msgs[i], "E") || !strings.HasSuffix(msgs[i], want) {
+			t.Errorf("ERROR line %d: got %q, want E...%q", i, msgs[i], want)
+		}
+	}
+	if want := fmt.Sprintf("glog_test.go:%d] third\n", line+2); !strings.HasSuffix(contents(warningLog), want) {
+		t.Errorf("WARNING log: got %q, want suffix %q", contents(warningLog), want)
+	}
+	if got := contents(infoLog); got != "" {
+		t.Errorf("INFO log: got %q, want nothing", got)
+	}
+}
+
+// Test that Writer logs a line written in pieces once its newline is
+// written, and a line left without one on Close or Shutdown.
+func TestWriterPartialLines(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	w := Writer(InfoLevel)
+
+	io.WriteString(w, "hello ")
+	if got := contents(infoLog); got != "" {
+		t.Errorf("logged %q before the newline", got)
+	}
+	io.WriteString(w, "world\nnext ")
+	io.WriteString(w, "line\n")
+	lines := strings.SplitAfter(contents(infoLog), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "] hello world\n") || !strings.HasSuffix(lines[1], "] next line\n") {
+		t.Fatalf("got %q, want the two lines whole", contents(infoLog))
+	}
+
+	io.WriteString(w, "unterminated")
+	w.Close()
+	if !strings.HasSuffix(contents(infoLog), "] unterminated\n") {
+		t.Errorf("Close did not log the partial line: %q", contents(infoLog))
+	}
+
+	warnings := Writer(WarningLevel)
+	io.WriteString(warnings, "before shutdown")
+	Shutdown()
+	if !strings.HasSuffix(contents(warningLog), "] before shutdown\n") {
+		t.Errorf("Shutdown did not log the partial line: %q", contents(warningLog))
+	}
+}
+
+// Test that RawWriter writes its bytes to the logs of its severity just as
+// they are, even with -log_async.
+func TestRawWriter(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous int) { *maxLineBytes = previous }(*maxLineBytes)
+	*maxLineBytes = 4
+
+	payload := []byte("W\x00\x01binary\r\nno newline")
+	RawWriter(WarningLevel).Write(payload)
+	if got := contents(warningLog); got != string(payload) {
+		t.Errorf("got %q in the WARNING log, want the bytes unmodified: %q", got, payload)
+	}
+	if got := contents(errorLog); got != "" {
+		t.Errorf("got %q in the ERROR log, want nothing", got)
+	}
+
+	logging.newBuffers()
+	restore := useAsync(16, false)
+	Info("line")
+	RawWriter(InfoLevel).Write([]byte("raw"))
+	restore()
+	if got := contents(infoLog); !strings.HasSuffix(got, "] line\nraw") {
+		t.Errorf("got %q with -log_async, want the line, then the raw bytes", got)
+	}
+}
+
 // Test that the header has the correct format.
 func TestHeader(t *testing.T) {
 	setFlags()
@@ -194,6 +458,368 @@ func TestHeader(t *testing.T) {
 	}
 }
 
+// Test that -log_file_path names the file in the header by its base name,
+// its directory and base name, or its whole path.
+func TestLogFilePath(t *testing.T) {
+	setFlags()
+	defer logging.filePath.set(logging.filePath.get())
+	_, path, _, _ := runtime.Caller(0)
+	dir := filepath.Base(filepath.Dir(filepath.FromSlash(path)))
+	for _, test := range []struct {
+		mode string
+		want string
+	}{
+		{"short", "glog_test.go"},
+		{"package", dir + "/glog_test.go"},
+		{"full", path},
+	} {
+		if err := logging.filePath.Set(test.mode); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer logging.swap(logging.newBuffers())
+			_, _, line, _ := runtime.Caller(0)
+			Info("test")
+			want := fmt.Sprintf(" %s:%d] test\n", test.want, line+1)
+			if got := contents(infoLog); !strings.HasSuffix(got, want) || strings.Count(got, "/") != strings.Count(want, "/") {
+				t.Errorf("-log_file_path=%s: got %q, want suffix %q", test.mode, got, want)
+			}
+		}()
+	}
+	if err := logging.filePath.Set("relative"); err == nil {
+		t.Error("Set(relative) succeeded")
+	}
+}
+
+// Test that -log_no_header leaves just the message, including a multi-line
+// one, and is ignored by -log_format=json.
+func TestNoHeader(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.noHeader = previous }(logging.noHeader)
+	logging.noHeader = true
+
+	Info("test")
+	Warningf("first\nsecond")
+	if got := contents(infoLog); got != "test\n" {
+		t.Errorf("INFO log: got %q, want %q", got, "test\n")
+	}
+	if got := contents(warningLog); got != "first\nsecond\n" {
+		t.Errorf("WARNING log: got %q, want %q", got, "first\nsecond\n")
+	}
+
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	Error("json")
+	if got := contents(errorLog); !strings.HasPrefix(got, `{"severity":"ERROR"`) || !strings.Contains(got, `"msg":"json"`) {
+		t.Errorf("ERROR log: got %q, want a full JSON line", got)
+	}
+}
+
+// Test that -log_no_header writes an empty message as an empty line.
+func TestNoHeaderEmptyMessage(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.noHeader = previous }(logging.noHeader)
+	logging.noHeader = true
+
+	Info("")
+	Infof("")
+	Infoln()
+	if got := contents(infoLog); got != "\n\n\n" {
+		t.Errorf("got %q, want three empty lines", got)
+	}
+}
+
+// Test that -log_error_stacks follows ERROR lines, and only those, with a
+// stack trace starting at the caller.
+func TestErrorStacks(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { *errorStacks = previous }(*errorStacks)
+	*errorStacks = true
+	defer logging.stderrThreshold.set(logging.stderrThreshold.get())
+	logging.stderrThreshold.set(fatalLog)
+
+	Info("info")
+	Error("error")
+
+	if got := contents(infoLog); strings.Count(got, "\n") != 1 {
+		t.Errorf("INFO line has more than one line: %q", got)
+	}
+	lines := strings.Split(contents(errorLog), "\n")
+	if len(lines) < 4 || !strings.HasSuffix(lines[0], "] error") || !strings.HasPrefix(lines[1], "goroutine ") {
+		t.Fatalf("ERROR line has no stack trace:\n%s", contents(errorLog))
+	}
+	if want := "glog.TestErrorStacks("; !strings.Contains(lines[2], want) {
+		t.Errorf("stack trace starts with %q, want the caller %q:\n%s", lines[2], want, contents(errorLog))
+	}
+	for _, glogFrame := range []string{"glog.stacks(", "glog.callerStack(", "output("} {
+		if strings.Contains(contents(errorLog), glogFrame) {
+			t.Errorf("stack trace has glog frame %q:\n%s", glogFrame, contents(errorLog))
+		}
+	}
+}
+
+// logAtDepth logs msg as if from its caller, for TestFuncName.
+func logAtDepth(msg string) {
+	InfoDepth(1, msg)
+}
+
+// Test that -log_func_name puts the name of the logging function in the
+// header and JSON lines, skipping the frames InfoDepth is told to.
+func TestFuncName(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.funcName = previous }(logging.funcName)
+	logging.funcName = true
+
+	const fn = "github.com/golang/glog.TestFuncName"
+	Info("direct")
+	logAtDepth("at depth")
+	if want := " " + fn + "] direct\n"; !contains(infoLog, want, t) {
+		t.Errorf("got %q, want %q", contents(infoLog), want)
+	}
+	if want := " " + fn + "] at depth\n"; !contains(infoLog, want, t) {
+		t.Errorf("got %q, want %q, for the caller of InfoDepth's caller", contents(infoLog), want)
+	}
+
+	logging.newBuffers()
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	Info("json")
+	var entry struct{ Func string }
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", contents(infoLog), err)
+	}
+	if entry.Func != fn {
+		t.Errorf("got func %q, want %q", entry.Func, fn)
+	}
+
+	logging.funcName = false
+	logging.format.set(textFormat)
+	logging.newBuffers()
+	Info("off")
+	if strings.Contains(contents(infoLog), "TestFuncName") {
+		t.Errorf("got %q, want no function name without -log_func_name", contents(infoLog))
+	}
+}
+
+// Test that -log_seq numbers lines one after another, in text and JSON.
+func TestSeq(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.seq = previous }(logging.seq)
+	logging.seq = true
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		Info("line ", i)
+	}
+	lines := strings.Split(strings.TrimSuffix(contents(infoLog), "\n"), "\n")
+	if len(lines) != n {
+		t.Fatalf("got %d lines, want %d: %q", len(lines), n, contents(infoLog))
+	}
+	var last uint64
+	for i, line := range lines {
+		j := strings.Index(line, " #")
+		if j < 0 {
+			t.Fatalf("no sequence number in %q", line)
+		}
+		field := line[j+2:]
+		seq, err := strconv.ParseUint(field[:strings.IndexByte(field, ' ')], 10, 64)
+		if err != nil {
+			t.Fatalf("bad sequence number in %q: %v", line, err)
+		}
+		if i > 0 && seq != last+1 {
+			t.Errorf("line %d has sequence number %d after %d, want %d", i, seq, last, last+1)
+		}
+		last = seq
+	}
+
+	logging.newBuffers()
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	Info("json")
+	var entry struct{ Seq uint64 }
+	if err := json.Unmarshal([]byte(contents(infoLog)), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", contents(infoLog), err)
+	}
+	if entry.Seq != last+1 {
+		t.Errorf("got seq %d, want %d", entry.Seq, last+1)
+	}
+
+	logging.seq = false
+	logging.newBuffers()
+	Info("off")
+	if strings.Contains(contents(infoLog), `"seq"`) {
+		t.Errorf("got %q, want no sequence number without -log_seq", contents(infoLog))
+	}
+}
+
+// Test that -log_goroutine_id tells apart the lines of different goroutines.
+func TestGoroutineID(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.goroutineID = previous }(logging.goroutineID)
+	logging.goroutineID = true
+
+	const n = 4
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Infof("goroutine %d", i)
+			Infof("goroutine %d again", i)
+		}(i)
+	}
+	wg.Wait()
+
+	ids := make(map[int]string) // The goroutine ID in the header of each i.
+	for _, line := range strings.Split(strings.TrimSuffix(contents(infoLog), "\n"), "\n") {
+		// I0102 15:04:05.067890    1234 g17 glog_test.go:12] goroutine 3
+		fields := strings.Fields(line)
+		if len(fields) < 7 || !strings.HasPrefix(fields[3], "g") {
+			t.Fatalf("no goroutine ID in %q", line)
+		}
+		id := fields[3]
+		var i int
+		if _, err := fmt.Sscanf(fields[6], "%d", &i); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		if previous, ok := ids[i]; ok && previous != id {
+			t.Errorf("goroutine %d logged as both %s and %s", i, previous, id)
+		}
+		ids[i] = id
+	}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		seen[id] = true
+	}
+	if len(ids) != n || len(seen) != n {
+		t.Errorf("got goroutine IDs %v, want %d distinct ones", ids, n)
+	}
+	if id := new(buffer).goroutineID(); id == 0 {
+		t.Error("goroutineID returned 0")
+	}
+}
+
+// Test that -log_utc puts both the header and the file name in UTC.
+func TestLogUTC(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous bool) { logging.utc = previous }(logging.utc)
+	logging.utc = true
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.FixedZone("UTC+5", 5*60*60))
+	timeNow = func() time.Time { return now }
+
+	Info("test")
+	if want := "I0102 10:04:05.067890 "; !strings.HasPrefix(contents(infoLog), want) {
+		t.Errorf("got %q, want prefix %q", contents(infoLog), want)
+	}
+	if name, _ := logName(severityName[infoLog], now); !strings.Contains(name, "[2006-01-02 10-04-05]") {
+		t.Errorf("logName: got %q, want the UTC time", name)
+	}
+
+	logging.utc = false
+	if name, _ := logName(severityName[infoLog], now); !strings.Contains(name, "[2006-01-02 15-04-05]") {
+		t.Errorf("logName without -log_utc: got %q, want the original zone", name)
+	}
+}
+
+// Test that -log_timezone puts the header, JSON lines and the file name in
+// the zone it names, overriding -log_utc, and rejects unknown zones.
+func TestLogTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous *time.Location) { logging.zone.v.Store(previous) }(logging.zone.get())
+	defer func(previous bool) { logging.utc = previous }(logging.utc)
+	logging.utc = true
+	if err := logging.zone.Set("America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 7, 2, 15, 4, 5, .067890e9, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	Info("summer")
+	if want := "I0702 11:04:05.067890 "; !strings.HasPrefix(contents(infoLog), want) {
+		t.Errorf("got %q, want prefix %q, at UTC-4", contents(infoLog), want)
+	}
+	now = time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.UTC)
+	Warning("winter")
+	if want := "W0102 10:04:05.067890 "; !strings.HasPrefix(contents(warningLog), want) {
+		t.Errorf("got %q, want prefix %q, at UTC-5", contents(warningLog), want)
+	}
+	if name, _ := logName(severityName[infoLog], now); !strings.Contains(name, "[2006-01-02 10-04-05]") {
+		t.Errorf("logName: got %q, want the time in New York", name)
+	}
+
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	Error("json")
+	if want := `"time":"2006-01-02T10:04:05.06789-05:00"`; !contains(errorLog, want, t) {
+		t.Errorf("got %q, want %s", contents(errorLog), want)
+	}
+
+	if err := logging.zone.Set("UTC"); err != nil || logging.zone.get() != time.UTC {
+		t.Errorf("Set(UTC): got %v, %v", logging.zone.get(), err)
+	}
+	if err := logging.zone.Set("Local"); err != nil || logging.zone.get() != time.Local {
+		t.Errorf("Set(Local): got %v, %v", logging.zone.get(), err)
+	}
+	if err := logging.zone.Set("Nowhere/Atlantis"); err == nil {
+		t.Error("Set(Nowhere/Atlantis) succeeded")
+	}
+}
+
+// Test that -log_timestamp_precision sets the number of fractional digits in
+// the header, without allocating.
+func TestTimestampPrecision(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.precision.set(logging.precision.get())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, 123456789, time.Local)
+	}
+	pid = 1234
+
+	for _, tc := range []struct {
+		precision string
+		want      string
+	}{
+		{"s", "I0102 15:04:05    1234 "},
+		{"ms", "I0102 15:04:05.123    1234 "},
+		{"us", "I0102 15:04:05.123456    1234 "},
+		{"ns", "I0102 15:04:05.123456789    1234 "},
+	} {
+		if err := logging.precision.Set(tc.precision); err != nil {
+			t.Fatalf("Set(%q): %v", tc.precision, err)
+		}
+		buf := logging.formatHeader(infoLog, "file.go", 12)
+		if got, want := buf.String(), tc.want+"file.go:12] "; got != want {
+			t.Errorf("%s: got %q, want %q", tc.precision, got, want)
+		}
+		logging.putBuffer(buf)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			logging.putBuffer(logging.formatHeader(infoLog, "file.go", 12))
+		})
+		if allocs != 0 {
+			t.Errorf("%s: formatHeader made %v allocations, want 0", tc.precision, allocs)
+		}
+	}
+	if err := logging.precision.Set("ps"); err == nil {
+		t.Error("Set(ps): got nil error, want an error")
+	}
+}
+
 // Test that an Error log goes to Warning and Info.
 // Even in the Info log, the source character will be E, so the data should
 // all be identical.
@@ -239,6 +865,22 @@ func TestV(t *testing.T) {
 	}
 }
 
+// Test that Enabled reports whether V logs, and that V logging that is off
+// allocates nothing.
+func TestVEnabled(t *testing.T) {
+	logging.verbosity.Set("2")
+	defer logging.verbosity.Set("0")
+	if !V(2).Enabled() {
+		t.Error("V(2) is not enabled at -v=2")
+	}
+	if V(3).Enabled() {
+		t.Error("V(3) is enabled at -v=2")
+	}
+	if n := testing.AllocsPerRun(100, func() { V(3).Info("off") }); n != 0 {
+		t.Errorf("V logging that is off made %v allocations, want 0", n)
+	}
+}
+
 // Test that a vmodule enables a log in this file.
 func TestVmoduleOn(t *testing.T) {
 	setFlags()
@@ -372,9 +1014,9 @@ func TestDeleteOldFile(t *testing.T) {
 	MaxSize = 512
 	MaxFileCount = 2
 	var logFileCount = 0
-	logFileCount, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
+	logFileCount, _, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
 	for logFileCount > MaxFileCount {
-		logFileCount, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
+		logFileCount, _, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
 	}
 
 	Info("x") // Be sure we have a file.
@@ -432,7 +1074,7 @@ func TestDeleteOldFile(t *testing.T) {
 		t.Errorf("info.f.Name did not change: %v", fname0)
 	}
 
-	logFileCount, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
+	logFileCount, _, err = deleteOldLogFile(severityName[infoLog], MaxFileCount)
 
 	if err != nil {
 		t.Fatalf("failed to delete old log file: %v", err)
@@ -486,6 +1128,91 @@ func BenchmarkHeader(b *testing.B) {
 	}
 }
 
+// BenchmarkHeaderPool compares formatting headers into pooled buffers with
+// allocating a new buffer for each.
+func BenchmarkHeaderPool(b *testing.B) {
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, _, _ := logging.header(infoLog, 0)
+			logging.putBuffer(buf)
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			logging.header(infoLog, 0)
+		}
+	})
+}
+
+func BenchmarkInfo(b *testing.B) {
+	setFlags()
+	discard := writerSink{ioutil.Discard}
+	defer logging.swap(logging.swap([maxSeverity]flushSyncWriter{discard, discard, discard, discard}))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Info("benchmark line")
+	}
+}
+
+// BenchmarkVDisabled measures V logging at a level that is off, which should
+// cost no allocations whether or not the line is guarded by Enabled.
+func BenchmarkVDisabled(b *testing.B) {
+	defer func(previous Level) { logging.verbosity.set(previous) }(logging.verbosity.get())
+	logging.verbosity.set(0)
+	b.Run("unguarded", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			V(5).Info("benchmark line")
+		}
+	})
+	b.Run("guarded", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if v := V(5); v.Enabled() {
+				v.Info("benchmark line ", i)
+			}
+		}
+	})
+}
+
+// Test that concurrent logging never shares a buffer between lines. Run with
+// -race.
+func TestBufferPoolConcurrent(t *testing.T) {
+	setFlags()
+	discard := writerSink{ioutil.Discard}
+	defer logging.swap(logging.swap([maxSeverity]flushSyncWriter{discard, discard, discard, discard}))
+	defer resetHooks(logging.hooks)
+	var mu sync.Mutex
+	var bad []string
+	AddHook(func(_ Severity, formatted []byte) {
+		line := string(formatted)
+		var g1, i, g2 int
+		n, err := fmt.Sscanf(line[strings.Index(line, "] ")+2:], "goroutine %d line %d goroutine %d\n", &g1, &i, &g2)
+		if n != 3 || err != nil || g1 != g2 {
+			mu.Lock()
+			bad = append(bad, line)
+			mu.Unlock()
+		}
+	})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				Infof("goroutine %d line %d goroutine %d", g, i, g)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if len(bad) > 0 {
+		t.Errorf("got %d corrupted lines, such as %q", len(bad), bad[0])
+	}
+}
+
 //entry logging
 type testLogEntry struct {
 	ActivityID string
@@ -535,3 +1262,525 @@ func TestInfoStructuredDepth(t *testing.T) {
 		t.Errorf("Wrong Message: %q", entry.Message)
 	}
 }
+
+// Test that -log_format=json writes one parseable JSON object per line.
+func TestJSONFormat(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	if err := logging.format.Set("json"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	now := time.Date(2006, 1, 2, 15, 4, 5, 67890, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	_, _, wantLine, _ := runtime.Caller(0)
+	Warning("first line\n\t\"second\" line")
+	Warningf("%s", "plain")
+
+	lines := strings.Split(strings.TrimSuffix(contents(warningLog), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), contents(warningLog))
+	}
+	var entry struct {
+		Severity string
+		Time     string
+		Pid      int
+		File     string
+		Line     int
+		Msg      string
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", lines[0], err)
+	}
+	if entry.Severity != "WARNING" {
+		t.Errorf("got severity %q, want WARNING", entry.Severity)
+	}
+	if entry.Time != now.Format(time.RFC3339Nano) {
+		t.Errorf("got time %q, want %q", entry.Time, now.Format(time.RFC3339Nano))
+	}
+	if entry.Pid != pid {
+		t.Errorf("got pid %d, want %d", entry.Pid, pid)
+	}
+	if entry.File != "glog_test.go" || entry.Line != wantLine+1 {
+		t.Errorf("got %s:%d, want glog_test.go:%d", entry.File, entry.Line, wantLine+1)
+	}
+	if want := "first line\n\t\"second\" line"; entry.Msg != want {
+		t.Errorf("got msg %q, want %q", entry.Msg, want)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", lines[1], err)
+	}
+	if entry.Msg != "plain" {
+		t.Errorf("got msg %q, want %q", entry.Msg, "plain")
+	}
+}
+
+// Test that -log_format=framed writes each line as a JSON object after its
+// 4-byte big-endian length, with no newlines between them, so that messages
+// holding newlines stay in one record.
+func TestFramedFormat(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	if err := logging.format.Set("framed"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"first line\nsecond line\n\nthird", "plain"}
+	for _, msg := range want {
+		Info(msg)
+	}
+	stream := []byte(contents(infoLog))
+	var got []string
+	for len(stream) > 0 {
+		if len(stream) < 4 {
+			t.Fatalf("%d bytes left over, too few for a length", len(stream))
+		}
+		n := binary.BigEndian.Uint32(stream)
+		if int(n) > len(stream)-4 {
+			t.Fatalf("record of %d bytes overruns the %d left", n, len(stream)-4)
+		}
+		record := stream[4 : 4+n]
+		stream = stream[4+n:]
+		var entry struct{ Severity, Msg string }
+		if err := json.Unmarshal(record, &entry); err != nil {
+			t.Fatalf("record %q is not JSON: %v", record, err)
+		}
+		if entry.Severity != "INFO" {
+			t.Errorf("got severity %q, want INFO", entry.Severity)
+		}
+		got = append(got, entry.Msg)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got messages %q, want %q", got, want)
+	}
+}
+
+// Test that -log_json_build_info adds the version and commit to JSON lines.
+func TestJSONBuildInfo(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	defer func(previous bool) { *jsonBuildInfo = previous }(*jsonBuildInfo)
+	defer SetBuildInfo("", "")
+	SetBuildInfo("1.2.3", "abc123")
+
+	Info("without")
+	*jsonBuildInfo = true
+	Info("with")
+	lines := strings.Split(strings.TrimSuffix(contents(infoLog), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q, want two lines", contents(infoLog))
+	}
+	if strings.Contains(lines[0], `"version"`) {
+		t.Errorf("got %q, want no version without -log_json_build_info", lines[0])
+	}
+	var entry struct{ Version, Commit string }
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", lines[1], err)
+	}
+	if entry.Version != "1.2.3" || entry.Commit != "abc123" {
+		t.Errorf("got version %q and commit %q in %q", entry.Version, entry.Commit, lines[1])
+	}
+}
+
+// Test that -log_label is in the header of text lines and a field of JSON
+// lines, and that SetLabel changes it while logging.
+func TestLabel(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetLabel(logLabel.get())
+	if err := logLabel.Set("shard-1"); err != nil { // As -log_label=shard-1.
+		t.Fatal(err)
+	}
+
+	Info("first")
+	SetLabel("shard-2")
+	Info("second")
+	SetLabel("")
+	Info("third")
+	if !contains(infoLog, " shard-1] first\n", t) {
+		t.Errorf("got %q, want the label shard-1 in the first header", contents(infoLog))
+	}
+	if !contains(infoLog, " shard-2] second\n", t) {
+		t.Errorf("got %q, want the label shard-2 in the second header", contents(infoLog))
+	}
+	if lines := strings.Split(contents(infoLog), "\n"); len(lines) < 3 || strings.Contains(lines[2], "shard") {
+		t.Errorf("got %q, want no label in the third header", contents(infoLog))
+	}
+
+	logging.newBuffers()
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	SetLabel("shard-3")
+	Info("json")
+	var entry struct{ Label, Msg string }
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(contents(infoLog), "\n")), &entry); err != nil {
+		t.Fatalf("%q is not JSON: %v", contents(infoLog), err)
+	}
+	if entry.Label != "shard-3" || entry.Msg != "json" {
+		t.Errorf("got label %q and msg %q, want shard-3 and json", entry.Label, entry.Msg)
+	}
+}
+
+// Test that an empty message is logged as a JSON line with an empty msg.
+func TestJSONEmptyMessage(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+
+	Info("")
+	Infof("")
+	lines := strings.Split(strings.TrimSuffix(contents(infoLog), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), contents(infoLog))
+	}
+	for _, line := range lines {
+		var entry struct{ Msg *string }
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("json.Unmarshal(%q): %v", line, err)
+		}
+		if entry.Msg == nil || *entry.Msg != "" {
+			t.Errorf("got %q, want an empty msg", line)
+		}
+	}
+}
+
+// Test that -log_format rejects unknown formats.
+func TestLogFormatSet(t *testing.T) {
+	var f logFormat
+	if err := f.Set("xml"); err == nil {
+		t.Error("Set(xml) succeeded")
+	}
+	if err := f.Set("JSON"); err != nil || f.get() != jsonFormat {
+		t.Errorf("Set(JSON): got %v, %v", f.get(), err)
+	}
+}
+
+// Test that -log_color=always colors the severity letter of lines on
+// standard error, by severity, and leaves the log files alone.
+func TestLogColor(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.color.set(logging.color.get())
+	if err := logging.color.Set("always"); err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous bool) { logging.alsoToStderr = previous }(logging.alsoToStderr)
+	logging.alsoToStderr = true
+
+	stderr := captureStderr(t)
+	Info("plain")
+	Warning("yellow")
+	Error("red")
+	got := stderr()
+
+	if !strings.HasPrefix(got, "I") || !strings.Contains(got, "\n"+colorYellow+"W"+colorReset) || !strings.Contains(got, "\n"+colorRed+"E"+colorReset) {
+		t.Errorf("stderr: got %q, want INFO plain, WARNING yellow and ERROR red", got)
+	}
+	for _, s := range []Severity{infoLog, warningLog, errorLog} {
+		if c := contents(s); strings.Contains(c, "\x1b[") {
+			t.Errorf("%s log: got %q, want no color", severityName[s], c)
+		}
+	}
+
+	logging.color.set(colorNever)
+	stderr = captureStderr(t)
+	Error("red")
+	if got := stderr(); strings.Contains(got, "\x1b[") {
+		t.Errorf("stderr with -log_color=never: got %q", got)
+	}
+	if err := logging.color.Set("sometimes"); err == nil {
+		t.Error("Set(sometimes) succeeded")
+	}
+}
+
+// Test that InfoKV appends key=value pairs in the text format.
+func TestInfoKV(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	InfoKV("request done", "status", 200, "path", "/a b", "empty", "")
+	if want := `] request done status=200 path="/a b" empty=""` + "\n"; !strings.HasSuffix(contents(infoLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(infoLog), want)
+	}
+}
+
+// Test that a trailing key without a value is logged with "(MISSING)".
+func TestInfoKVOddArgs(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	ErrorKV("oops", "code", 7, "dangling")
+	if want := "] oops code=7 dangling=(MISSING)\n"; !strings.HasSuffix(contents(errorLog), want) {
+		t.Errorf("got %q, want suffix %q", contents(errorLog), want)
+	}
+}
+
+// Test that InfoKV renders key/value pairs as fields in -log_format=json mode.
+func TestInfoKVJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	WarningKV("slow", "ms", 1500, "ok", true, "err", errors.New("timeout"), "dangling")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(contents(warningLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(warningLog), err)
+	}
+	for key, want := range map[string]interface{}{
+		"msg":      "slow",
+		"ms":       1500.0,
+		"ok":       true,
+		"err":      "timeout",
+		"dangling": "(MISSING)",
+	} {
+		if got := entry[key]; got != want {
+			t.Errorf("%s: got %#v, want %#v", key, got, want)
+		}
+	}
+}
+
+// wrappedError wraps err with msg, as fmt.Errorf("msg: %w", err) does.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e wrappedError) Error() string { return e.msg + ": " + e.err.Error() }
+func (e wrappedError) Unwrap() error { return e.err }
+
+// detailedError has more to say when formatted with %+v.
+type detailedError struct{}
+
+func (detailedError) Error() string { return "root" }
+func (e detailedError) Format(f fmt.State, verb rune) {
+	io.WriteString(f, e.Error())
+	if f.Flag('+') {
+		io.WriteString(f, " (at frame 1)")
+	}
+}
+
+// Test that ErrorErr logs every error of a chain, and only the message for a
+// nil error.
+func TestErrorErr(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	err := wrappedError{"outer", wrappedError{"middle", detailedError{}}}
+
+	ErrorErr("failed", err)
+	ErrorErr("no error", nil)
+	want := ` failed error="outer: middle: root" cause="middle: root" cause=root detail="root (at frame 1)"` + "\n"
+	lines := strings.SplitAfter(contents(errorLog), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "]"+want) {
+		t.Fatalf("got %q, want a first line ending in %q", contents(errorLog), want)
+	}
+	if !strings.HasSuffix(lines[1], "] no error\n") {
+		t.Errorf("nil error: got %q", lines[1])
+	}
+}
+
+// Test that ErrorErr logs the error chain as an object in JSON mode.
+func TestErrorErrJSON(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer logging.format.set(logging.format.get())
+	logging.format.set(jsonFormat)
+	ErrorErr("failed", wrappedError{"outer", errors.New("root")})
+
+	var entry struct {
+		Msg   string
+		Error errorFields
+	}
+	if err := json.Unmarshal([]byte(contents(errorLog)), &entry); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", contents(errorLog), err)
+	}
+	want := errorFields{Msg: "outer: root", Causes: []string{"root"}}
+	if entry.Msg != "failed" || !reflect.DeepEqual(entry.Error, want) {
+		t.Errorf("got %+v, want msg failed and error %+v", entry, want)
+	}
+}
+
+// Test that SetVerbosity takes effect for V and is safe to call concurrently
+// with logging. Run with -race.
+func TestSetVerbosity(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVerbosity(VerbosityLevel())
+
+	SetVerbosity(2)
+	if got := VerbosityLevel(); got != 2 {
+		t.Errorf("VerbosityLevel: got %d, want 2", got)
+	}
+	if !V(2) {
+		t.Error("V not enabled for 2")
+	}
+	SetVerbosity(1)
+	if V(2) {
+		t.Error("V enabled for 2 after lowering the level")
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					V(2).Info("test")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		SetVerbosity(i % 3)
+	}
+	close(done)
+	wg.Wait()
+}
+
+// Test that SetVModule changes per-file verbosity at runtime and leaves the
+// setting alone on a syntax error.
+func TestSetVModule(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVModule("")
+
+	if V(3) {
+		t.Fatal("V enabled for 3 before SetVModule")
+	}
+	if err := SetVModule("glog_test=3"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	if !V(3) {
+		t.Error("V not enabled for 3")
+	}
+	for _, bad := range []string{"glog_test", "glog_test=x", "=2", "glog_test=-1"} {
+		if err := SetVModule(bad); err == nil {
+			t.Errorf("SetVModule(%q) succeeded", bad)
+		}
+	}
+	if !V(3) {
+		t.Error("V no longer enabled for 3 after a failed SetVModule")
+	}
+	if err := SetVModule("notthisfile=3"); err != nil {
+		t.Fatalf("SetVModule: %v", err)
+	}
+	if V(1) {
+		t.Error("V enabled for 1 by another file's setting")
+	}
+}
+
+// Test that SetOutput sends formatted lines of every severity to a writer.
+func TestSetOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer func(previous func() time.Time) { timeNow = previous }(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2006, 1, 2, 15, 4, 5, .067890e9, time.Local)
+	}
+	defer func(previous int) { pid = previous }(pid)
+	pid = 1234
+
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	_, _, line, _ := runtime.Caller(0)
+	Info("test")
+	if want := fmt.Sprintf("I0102 15:04:05.067890    1234 glog_test.go:%d] test\n", line+1); buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+// Test that SetOutputBySeverity sends each severity to its own writer.
+func TestSetOutputBySeverity(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	var info, warning, errs bytes.Buffer
+	SetOutputBySeverity(InfoLevel, &info)
+	SetOutputBySeverity(WarningLevel, &warning)
+	SetOutputBySeverity(ErrorLevel, &errs)
+	Info("info")
+	Warning("warning")
+	Error("error")
+	for _, tc := range []struct {
+		buf  *bytes.Buffer
+		char string
+		msg  string
+	}{
+		{&info, "I", "info"},
+		{&warning, "W", "warning"},
+		{&errs, "E", "error"},
+	} {
+		got := tc.buf.String()
+		if strings.Count(got, "\n") != 1 || !strings.HasPrefix(got, tc.char) || !strings.HasSuffix(got, "] "+tc.msg+"\n") {
+			t.Errorf("%s writer got %q", tc.msg, got)
+		}
+	}
+}
+
+// Test that LineCounts counts each line written, and only those, once.
+func TestLineCounts(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	defer SetVerbosity(VerbosityLevel())
+	SetVerbosity(0)
+
+	infos0, warnings0, errs0, _ := LineCounts()
+	for i := 0; i < 3; i++ {
+		Info("info")
+	}
+	V(1).Info("filtered")
+	Warningf("warning")
+	Errorln("error")
+	ErrorKV("error")
+	infos, warnings, errs, _ := LineCounts()
+	if got := [3]uint64{infos - infos0, warnings - warnings0, errs - errs0}; got != [3]uint64{3, 1, 2} {
+		t.Errorf("got counts %v, want [3 1 2]", got)
+	}
+}
+
+// stallingWriter is a writer whose Flush blocks until release is closed.
+type stallingWriter struct {
+	release chan struct{}
+}
+
+func (w stallingWriter) Write(p []byte) (int, error) { return len(p), nil }
+func (w stallingWriter) Flush() error {
+	<-w.release
+	return nil
+}
+
+// Test that FlushTimeout gives up on a writer that does not flush in time,
+// and succeeds once the writers flush.
+func TestFlushTimeout(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+
+	if err := FlushTimeout(time.Second); err != nil {
+		t.Fatalf("FlushTimeout with nothing blocking: %v", err)
+	}
+	w := stallingWriter{make(chan struct{})}
+	SetOutput(w)
+	Info("test")
+	start := time.Now()
+	err := FlushTimeout(50 * time.Millisecond)
+	elapsed := time.Since(start)
+	close(w.release)
+	if err != context.DeadlineExceeded {
+		t.Errorf("FlushTimeout with a stalled writer = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("FlushTimeout took %v, want about 50ms", elapsed)
+	}
+	if err := FlushTimeout(5 * time.Second); err != nil {
+		t.Errorf("FlushTimeout after the writer is released: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.14
+
+// Sending log lines to the log of a Go test.
+
+package glog
+
+import "testing"
+
+// SetTestLogger sends every log line, formatted with its header, to t.Log
+// instead of the log files and standard error, for the rest of the test or
+// benchmark t, so that the lines of code under test appear with the test
+// that logged them, and only if it fails or runs with -v. A FATAL line, or
+// Exit, fails the test with t.Fatal rather than ending the process; like
+// t.Fatal, it must then be called from the goroutine running the test.
+//
+// The previous output is restored when t ends, after the lines queued by
+// -log_async are written. Since the output is shared by the whole program,
+// SetTestLogger is not for tests that run in parallel.
+func SetTestLogger(t testing.TB) {
+	previous, _ := testOutput.Load().(testSink)
+	testOutput.Store(testSink{t})
+	t.Cleanup(func() {
+		Flush()
+		testOutput.Store(previous)
+	})
+}
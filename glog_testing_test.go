@@ -0,0 +1,98 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.14
+
+package glog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeTB records what SetTestLogger sends to a test. Its Fatal ends the
+// calling goroutine, as that of testing.T does.
+type fakeTB struct {
+	testing.TB
+	logs     []string
+	fatal    string
+	cleanups []func()
+}
+
+func (f *fakeTB) Log(args ...interface{})   { f.logs = append(f.logs, fmt.Sprint(args...)) }
+func (f *fakeTB) Cleanup(fn func())         { f.cleanups = append(f.cleanups, fn) }
+func (f *fakeTB) Fatal(args ...interface{}) { f.fatal = fmt.Sprint(args...); runtime.Goexit() }
+
+// end runs the cleanups, as the testing package does when the test ends.
+func (f *fakeTB) end() {
+	for i := len(f.cleanups) - 1; i >= 0; i-- {
+		f.cleanups[i]()
+	}
+}
+
+// Test that SetTestLogger sends the lines to the test instead of the log
+// files, and restores the files when the test ends.
+func TestSetTestLogger(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	tb := &fakeTB{}
+	SetTestLogger(tb)
+	Info("to the test")
+	if len(tb.logs) != 1 || !strings.HasSuffix(tb.logs[0], "] to the test") {
+		t.Errorf("got test logs %q, want the line", tb.logs)
+	}
+	if contents(infoLog) != "" {
+		t.Errorf("got %q in the log file, want nothing", contents(infoLog))
+	}
+
+	tb.end()
+	Info("to the file")
+	if !contains(infoLog, "] to the file\n", t) || len(tb.logs) != 1 {
+		t.Errorf("after the test ended: got %q in the log file and test logs %q", contents(infoLog), tb.logs)
+	}
+
+	// The real testing.T shows the line only if this test fails.
+	SetTestLogger(t)
+	Info("to this test")
+	if strings.Contains(contents(infoLog), "to this test") {
+		t.Errorf("got %q in the log file, want the line in the test log", contents(infoLog))
+	}
+}
+
+// Test that under SetTestLogger, Fatal fails the test, with the line and a
+// stack trace in its log, rather than exiting.
+func TestSetTestLoggerFatal(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	tb := &fakeTB{}
+	SetTestLogger(tb)
+	defer tb.end()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		Fatal("fatal in a test")
+		t.Error("Fatal returned")
+	}()
+	<-done
+	if tb.fatal == "" {
+		t.Error("Fatal did not fail the test")
+	}
+	if len(tb.logs) != 2 || !strings.HasSuffix(tb.logs[0], "] fatal in a test") || !strings.Contains(tb.logs[1], "goroutine ") {
+		t.Errorf("got test logs %q, want the FATAL line and a stack trace", tb.logs)
+	}
+}
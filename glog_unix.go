@@ -0,0 +1,49 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+// Sending log lines to a collector over a Unix domain socket.
+
+package glog
+
+import (
+	"fmt"
+	"net"
+)
+
+// SetUnixSocketOutput sends every log line, formatted with its header, to
+// the collector listening on the Unix domain socket at path, as
+// SetNetworkOutput does for TCP and UDP. The socket may be of the stream
+// ("unix") or datagram ("unixgram") type; with the latter, each line is sent
+// as one datagram. Calling it with an empty path stops sending.
+func SetUnixSocketOutput(path string) error {
+	if path == "" {
+		setNetSink(nil)
+		return nil
+	}
+	network := "unix"
+	conn, err := net.Dial(network, path)
+	if err != nil {
+		network = "unixgram"
+		var gramErr error
+		if conn, gramErr = net.Dial(network, path); gramErr != nil {
+			return fmt.Errorf("log: cannot connect to collector: %v", err)
+		}
+	}
+	setNetSink(newNetSink(network, path, conn))
+	return nil
+}
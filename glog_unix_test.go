@@ -0,0 +1,124 @@
+// Go support for leveled logs, analogous to https://code.google.com/p/google-glog/
+//
+// Copyright 2013 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows && !plan9
+
+package glog
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that lines arrive at a collector on a stream Unix socket, and again
+// after it drops the connection.
+func TestUnixSocketOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "collector.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	if err := SetUnixSocketOutput(path); err != nil {
+		t.Fatalf("SetUnixSocketOutput: %v", err)
+	}
+	defer SetUnixSocketOutput("")
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Info("over the socket")
+	if line := readLine(t, bufio.NewReader(conn), conn); !strings.HasSuffix(line, "] over the socket\n") {
+		t.Errorf("collector got %q", line)
+	}
+	conn.Close()
+
+	// Log until a line is found to fail on the closed connection and
+	// the sink dials again.
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	deadline := time.After(10 * time.Second)
+	for {
+		Info("after reconnecting")
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			if line := readLine(t, bufio.NewReader(conn), conn); !strings.HasSuffix(line, "] after reconnecting\n") {
+				t.Errorf("collector got %q after reconnecting", line)
+			}
+			return
+		case <-deadline:
+			t.Fatal("the sink did not reconnect")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// Test that each line arrives as a datagram at a collector on a datagram
+// Unix socket.
+func TestUnixgramSocketOutput(t *testing.T) {
+	setFlags()
+	defer logging.swap(logging.newBuffers())
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "collector.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := SetUnixSocketOutput(path); err != nil {
+		t.Fatalf("SetUnixSocketOutput: %v", err)
+	}
+	defer SetUnixSocketOutput("")
+
+	Info("first datagram")
+	Warning("second datagram")
+	buf := make([]byte, 4096)
+	for _, want := range []string{"] first datagram\n", "] second datagram\n"} {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("reading from collector: %v", err)
+		}
+		if got := string(buf[:n]); !strings.HasSuffix(got, want) || strings.Count(got, "\n") != 1 {
+			t.Errorf("collector got datagram %q, want one line ending %q", got, want)
+		}
+	}
+}
+
+// Test that SetUnixSocketOutput reports a socket it cannot connect to.
+func TestSetUnixSocketOutputInvalid(t *testing.T) {
+	dir, cleanup := tempLogDir(t)
+	defer cleanup()
+	if err := SetUnixSocketOutput(filepath.Join(dir, "missing.sock")); err == nil {
+		SetUnixSocketOutput("")
+		t.Error("SetUnixSocketOutput succeeded with no collector")
+	}
+}
@@ -1,3 +1,8 @@
 module github.com/golang/glog
 
 go 1.11
+
+require (
+	github.com/go-logr/logr v1.4.2
+	golang.org/x/sys v0.5.0
+)